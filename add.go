@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// addOpts are the options of add
+type addOpts struct {
+	host    string
+	keyType string
+	key     string
+	comment string
+	stdin   bool
+	hash    bool
+	dryRun  bool
+}
+
+// parseHostSpec splits host[,ip][:port] into patterns and a port. Only
+// the last host may carry a port, as host:port or [host]:port, and it
+// applies to every host; bare IPv6 addresses have no port unless
+// bracketed.
+func parseHostSpec(spec string) (patterns []string, port int, err error) {
+	patterns = strings.Split(spec, ",")
+
+	for i, p := range patterns {
+		host, portText, ok := cutHostPort(p)
+		if !ok {
+			continue
+		}
+		if i != len(patterns)-1 {
+			return nil, 0, fmt.Errorf("only the last host of %q can have a port, it applies to every host", spec)
+		}
+		if port, err = strconv.Atoi(portText); err != nil || port < 1 || port > 65535 {
+			return nil, 0, fmt.Errorf("invalid port in %q", spec)
+		}
+		patterns[i] = host
+	}
+
+	return patterns, port, nil
+}
+
+// cutHostPort splits host:port and [host]:port. Bare IPv6 addresses and
+// hosts without a port are not split.
+func cutHostPort(s string) (host, port string, ok bool) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]:")
+		if end < 0 {
+			return s, "", false
+		}
+		return s[1:end], s[end+2:], true
+	}
+	if strings.Count(s, ":") != 1 {
+		return s, "", false
+	}
+
+	return strings.Cut(s, ":")
+}
+
+// addEntryFromArgs validates the command line entry of add
+func addEntryFromArgs(opt addOpts) (Entry, error) {
+	patterns, port, err := parseHostSpec(opt.host)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return recordToEntry(Record{
+		Patterns: patterns,
+		Port:     port,
+		KeyType:  opt.keyType,
+		Key:      opt.key,
+		Comment:  opt.comment,
+	})
+}
+
+// parseKeyscan reads ssh-keyscan output. Every key is validated and
+// nothing is returned unless all lines are valid.
+func parseKeyscan(data []byte) ([]Entry, error) {
+	var (
+		entries []Entry
+		errs    []error
+	)
+
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := ParseEntry(line)
+		if err == nil {
+			e, err = recordToEntry(Record{Marker: e.Marker, Patterns: e.Patterns, KeyType: e.KeyType, Key: e.Key, Comment: e.Comment})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no keys on stdin")
+	}
+
+	return entries, nil
+}
+
+// runAdd adds the entry given on the command line, or the ssh-keyscan
+// output read from stdin
+func runAdd(hosts []string, opt addOpts) {
+	var (
+		entries []Entry
+		err     error
+	)
+	if opt.stdin {
+		var data []byte
+		if data, err = readInput("-"); err == nil {
+			entries, err = parseKeyscan(data)
+		}
+	} else {
+		var e Entry
+		e, err = addEntryFromArgs(opt)
+		entries = []Entry{e}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Like ssh, start a known_hosts file only the user can read
+	if !opt.dryRun && !Exists() {
+		if err := CreateFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	report, err := addEntries(hosts, entries, cmdAdd, opt.hash || cfg.Hash == hashAlways, opt.dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printMergeReport(os.Stdout, report, opt.dryRun)
+	if len(report.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
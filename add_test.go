@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseHostSpec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		patterns []string
+		port     int
+		wantErr  bool
+	}{
+		{spec: "github.com", patterns: []string{"github.com"}},
+		{spec: "github.com,140.82.121.4", patterns: []string{"github.com", "140.82.121.4"}},
+		{spec: "db.example.com,10.0.0.5:2222", patterns: []string{"db.example.com", "10.0.0.5"}, port: 2222},
+		{spec: "[db.example.com]:2222", patterns: []string{"db.example.com"}, port: 2222},
+		{spec: "db.example.com,[::1]:2222", patterns: []string{"db.example.com", "::1"}, port: 2222},
+		{spec: "db.example.com:2222,10.0.0.5", wantErr: true},
+		{spec: "[db.example.com]:2222,10.0.0.5", wantErr: true},
+		{spec: "2001:db8::1", patterns: []string{"2001:db8::1"}},
+		{spec: "db.example.com:ssh", wantErr: true},
+		{spec: "db.example.com:70000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			patterns, port, err := parseHostSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHostSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(patterns, tt.patterns) || port != tt.port {
+				t.Errorf("parseHostSpec() = %v, %d, want %v, %d", patterns, port, tt.patterns, tt.port)
+			}
+		})
+	}
+}
+
+func TestAddEntryFromArgs(t *testing.T) {
+	keyType, key := testPublicKey(t)
+
+	tests := []struct {
+		name    string
+		opt     addOpts
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "port applies to every host",
+			opt:  addOpts{host: "db.example.com,10.0.0.5:2222", keyType: keyType, key: key},
+			want: "[db.example.com]:2222,[10.0.0.5]:2222 " + keyType + " " + key,
+		},
+		{
+			name: "bracketed port applies to every host",
+			opt:  addOpts{host: "db.example.com,[::1]:2222", keyType: keyType, key: key},
+			want: "[db.example.com]:2222,[::1]:2222 " + keyType + " " + key,
+		},
+		{name: "port on a leading host", opt: addOpts{host: "db.example.com:2222,10.0.0.5", keyType: keyType, key: key}, wantErr: true},
+		{
+			name: "comment",
+			opt:  addOpts{host: "github.com", keyType: keyType, key: key, comment: "deploy"},
+			want: "github.com " + keyType + " " + key + " deploy",
+		},
+		{name: "invalid base64", opt: addOpts{host: "github.com", keyType: keyType, key: "not base64!"}, wantErr: true},
+		{name: "type mismatch", opt: addOpts{host: "github.com", keyType: "ssh-rsa", key: key}, wantErr: true},
+		{name: "empty host", opt: addOpts{host: "a,,b", keyType: keyType, key: key}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addEntryFromArgs(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addEntryFromArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("addEntryFromArgs() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeyscan(t *testing.T) {
+	keyType, key := testPublicKey(t)
+
+	t.Run("ssh-keyscan output", func(t *testing.T) {
+		data := "# github.com:22 SSH-2.0-babeld-1\n" +
+			"github.com " + keyType + " " + key + "\n\n" +
+			"[db.example.com]:2222 " + keyType + " " + key + "\r\n"
+
+		got, err := parseKeyscan([]byte(data))
+		if err != nil {
+			t.Fatalf("parseKeyscan() error = %v", err)
+		}
+		if len(got) != 2 || got[0].Patterns[0] != "github.com" || got[1].Patterns[0] != "[db.example.com]:2222" {
+			t.Errorf("parseKeyscan() = %v", got)
+		}
+	})
+
+	t.Run("one bad key rejects everything", func(t *testing.T) {
+		data := "github.com " + keyType + " " + key + "\n" +
+			"gitlab.com ssh-rsa " + key + "\n"
+
+		_, err := parseKeyscan([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("parseKeyscan() error = %v, want line 2 error", err)
+		}
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		if _, err := parseKeyscan([]byte("# nothing\n")); err == nil {
+			t.Error("parseKeyscan() should fail without keys")
+		}
+	})
+}
+
+func TestAddEntries(t *testing.T) {
+	keyType, key := testPublicKey(t)
+	_, other := testPublicKey(t)
+
+	tmpDir := t.TempDir()
+	setConfig(t, Config{Files: []string{tmpDir + "/known_hosts"}, Hash: hashNever})
+
+	hosts := []string{"github.com " + keyType + " " + key}
+	if err := SaveFile(hosts); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	entries := []Entry{
+		{Patterns: []string{"github.com"}, KeyType: keyType, Key: key},
+		{Patterns: []string{"github.com"}, KeyType: keyType, Key: other},
+		{Patterns: []string{"gitlab.com"}, KeyType: keyType, Key: other},
+	}
+
+	report, err := addEntries(hosts, entries, cmdAdd, true, false)
+	if err != nil {
+		t.Fatalf("addEntries() error = %v", err)
+	}
+	if len(report.Added) != 1 || len(report.Duplicates) != 1 || len(report.Conflicts) != 1 {
+		t.Errorf("addEntries() report = %+v", report)
+	}
+
+	got, _ := ReadFile()
+	if len(got) != 2 {
+		t.Fatalf("known_hosts = %v, want one added line", got)
+	}
+	if e, _ := ParseEntry(got[1]); !e.Hashed() || !e.HasHost("gitlab.com") {
+		t.Errorf("added line = %q, want hashed gitlab.com", got[1])
+	}
+}
+
+func TestRunAddCreatesFile(t *testing.T) {
+	keyType, key := testPublicKey(t)
+
+	name := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+	setConfig(t, Config{Files: []string{name}, Hash: hashNever})
+
+	runAdd(nil, addOpts{host: "github.com", keyType: keyType, key: key})
+
+	got, err := ReadFile()
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "github.com " + keyType + " " + key; len(got) != 1 || got[0] != want {
+		t.Errorf("known_hosts = %v, want %q", got, want)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("known_hosts mode = %o, want 600", perm)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	optionFrom       = "from"
+	optionCommand    = "command"
+	optionRestrict   = "restrict"
+	optionExpiryTime = "expiry-time"
+
+	defaultAuthorizedKeys = "~/.ssh/authorized_keys"
+)
+
+// AuthorizedKey is a parsed authorized_keys line, see sshd(8):
+//
+//	[option[,option...]] keytype base64-key [comment]
+//
+// Options are kept as written, quotes included, so String round trips.
+type AuthorizedKey struct {
+	Options []string
+	KeyType string
+	Key     string
+	Comment string
+}
+
+// isKeyType reports whether s looks like an SSH key type rather than the
+// start of an options list
+func isKeyType(s string) bool {
+	for _, prefix := range []string{"ssh-", "ecdsa-sha2-", "sk-ssh-", "sk-ecdsa-sha2-"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitOptions splits the leading options of line, honoring double quotes,
+// and returns the remainder of the line
+func splitOptions(line string) (options []string, rest string, err error) {
+	var (
+		opt     strings.Builder
+		inQuote bool
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && inQuote && i+1 < len(line) && line[i+1] == '"':
+			opt.WriteString(`\"`)
+			i++
+		case c == '"':
+			inQuote = !inQuote
+			opt.WriteByte(c)
+		case c == ',' && !inQuote:
+			options = append(options, opt.String())
+			opt.Reset()
+		case (c == ' ' || c == '\t') && !inQuote:
+			options = append(options, opt.String())
+			return options, strings.TrimSpace(line[i:]), nil
+		default:
+			opt.WriteByte(c)
+		}
+	}
+
+	if inQuote {
+		return nil, "", fmt.Errorf("unterminated quote in options")
+	}
+
+	return nil, "", fmt.Errorf("missing key after options")
+}
+
+// ParseAuthorizedKey parses a single authorized_keys line
+func ParseAuthorizedKey(line string) (k AuthorizedKey, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return k, fmt.Errorf("not a key entry: '%s'", line)
+	}
+
+	rest := line
+	if fields := strings.Fields(line); !isKeyType(fields[0]) {
+		if k.Options, rest, err = splitOptions(line); err != nil {
+			return k, fmt.Errorf("invalid key: %v: '%s'", err, line)
+		}
+		for _, o := range k.Options {
+			if o == "" {
+				return k, fmt.Errorf("invalid key: empty option: '%s'", line)
+			}
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return k, fmt.Errorf("invalid key: '%s'", line)
+	}
+
+	k.KeyType = fields[0]
+	k.Key = fields[1]
+	k.Comment = strings.Join(fields[2:], " ")
+
+	return k, nil
+}
+
+// String formats the key as an authorized_keys line
+func (k AuthorizedKey) String() string {
+	fields := make([]string, 0, 4)
+	if len(k.Options) > 0 {
+		fields = append(fields, strings.Join(k.Options, ","))
+	}
+	fields = append(fields, k.KeyType, k.Key)
+	if k.Comment != "" {
+		fields = append(fields, k.Comment)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key
+func (k AuthorizedKey) Fingerprint() string {
+	return Entry{Key: k.Key}.Fingerprint()
+}
+
+// Option returns the unquoted value of the named option. Flag options such
+// as restrict have an empty value.
+func (k AuthorizedKey) Option(name string) (value string, ok bool) {
+	for _, o := range k.Options {
+		n, v, _ := strings.Cut(o, "=")
+		if !strings.EqualFold(n, name) {
+			continue
+		}
+
+		if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+			v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+		}
+		return v, true
+	}
+
+	return "", false
+}
+
+// From returns the patterns of the from= option
+func (k AuthorizedKey) From() []string {
+	v, ok := k.Option(optionFrom)
+	if !ok || v == "" {
+		return nil
+	}
+
+	return strings.Split(v, ",")
+}
+
+// Command returns the forced command of the command= option
+func (k AuthorizedKey) Command() string {
+	v, _ := k.Option(optionCommand)
+	return v
+}
+
+// Restrict reports whether the restrict option is set
+func (k AuthorizedKey) Restrict() bool {
+	_, ok := k.Option(optionRestrict)
+	return ok
+}
+
+// ExpiryTime returns the expiry-time= option
+func (k AuthorizedKey) ExpiryTime() (t time.Time, ok bool, err error) {
+	v, ok := k.Option(optionExpiryTime)
+	if !ok {
+		return t, false, nil
+	}
+
+	t, err = parseSSHTime(v)
+	return t, true, err
+}
+
+// parseSSHTime parses the YYYYMMDD[HHMM[SS]][Z] times used by sshd and
+// ssh-keygen options. Times are local unless they end in Z.
+func parseSSHTime(v string) (time.Time, error) {
+	loc := time.Local
+	s := v
+	if strings.HasSuffix(s, "Z") || strings.HasSuffix(s, "z") {
+		loc = time.UTC
+		s = s[:len(s)-1]
+	}
+
+	var layout string
+	switch len(s) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+
+	return t, nil
+}
+
+// optionSummary describes the options of k for listings
+func (k AuthorizedKey) optionSummary(now time.Time) []string {
+	var out []string
+	for _, o := range k.Options {
+		name, _, _ := strings.Cut(o, "=")
+		switch strings.ToLower(name) {
+		case optionFrom:
+			out = append(out, "from "+strings.Join(k.From(), ","))
+		case optionCommand:
+			out = append(out, "command "+k.Command())
+		case optionExpiryTime:
+			t, _, err := k.ExpiryTime()
+			switch {
+			case err != nil:
+				out = append(out, err.Error())
+			case t.Before(now):
+				out = append(out, "expired "+t.Format("2006-01-02 15:04"))
+			default:
+				out = append(out, "expires "+t.Format("2006-01-02 15:04"))
+			}
+		default:
+			out = append(out, o)
+		}
+	}
+
+	return out
+}
+
+// displayAuthorizedKey returns the listing label of an authorized_keys
+// line: comment, key type, fingerprint and options
+func displayAuthorizedKey(line string) string {
+	k, err := ParseAuthorizedKey(line)
+	if err != nil {
+		return line
+	}
+
+	comment := k.Comment
+	if comment == "" {
+		comment = "(no comment)"
+	}
+
+	s := fmt.Sprintf("%s %s %s", comment, k.KeyType, k.Fingerprint())
+	if opts := k.optionSummary(time.Now()); len(opts) > 0 {
+		s += " [" + strings.Join(opts, "; ") + "]"
+	}
+
+	return s
+}
+
+// SearchAuthorizedKeys finds keys whose comment, fingerprint, key type or
+// options contain pattern. Like Search it is case-insensitive.
+func SearchAuthorizedKeys(input []string, pattern string) []string {
+	var out []string
+	pattern = strings.ToLower(pattern)
+
+	for _, v := range input {
+		k, err := ParseAuthorizedKey(v)
+		if err != nil {
+			continue
+		}
+
+		fields := append([]string{k.Comment, k.Fingerprint(), k.KeyType}, k.Options...)
+		for _, f := range fields {
+			if strings.Contains(strings.ToLower(f), pattern) {
+				out = append(out, v)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// deleteAuthorizedKeys is the authorized_keys counterpart of deleteMatches.
+// SECURITY: pattern must equal the full line, the comment or the
+// fingerprint, so "alice" never removes "alice@laptop".
+func deleteAuthorizedKeys(input []string, pattern string) (remaining []string, removed []string) {
+	for _, v := range input {
+		if v == "" {
+			continue
+		}
+
+		if v == pattern {
+			removed = append(removed, v)
+			continue
+		}
+
+		if k, err := ParseAuthorizedKey(v); err == nil {
+			if k.Comment == pattern || k.Fingerprint() == pattern {
+				removed = append(removed, v)
+				continue
+			}
+		}
+
+		remaining = append(remaining, v)
+	}
+
+	return remaining, removed
+}
+
+func listAuthorizedKeys(keys []string) {
+	fmt.Println("Current authorized keys:")
+
+	for _, v := range keys {
+		if strings.HasPrefix(v, "#") {
+			continue
+		}
+		if _, err := ParseAuthorizedKey(v); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		fmt.Println(displayAuthorizedKey(v))
+	}
+}
+
+// printRemovedKeys lists the removed keys after verb, such as "Removed" or
+// "Dry run: would remove"
+func printRemovedKeys(w io.Writer, verb string, removed []string) {
+	fmt.Fprintf(w, "%s %d %s:\n", verb, len(removed), plural(len(removed), "key", "keys"))
+	for _, line := range removed {
+		fmt.Fprintf(w, "- %s\n", displayAuthorizedKey(line))
+	}
+}
+
+// removeAuthorizedKeys deletes the keys selected by the rm pattern. As in
+// runRemove, removing several keys needs confirmation unless --yes is
+// given.
+func removeAuthorizedKeys(keys []string, opt opts) {
+	remaining, removed := deleteAuthorizedKeys(keys, opt.host)
+	if len(removed) == 0 {
+		if opt.dryRun {
+			fmt.Println("Dry run: no matching keys would be removed for:", opt.host)
+		} else {
+			fmt.Println("No matching keys for:", opt.host)
+		}
+		return
+	}
+	if opt.dryRun {
+		printRemovedKeys(os.Stdout, "Dry run: would remove", removed)
+		return
+	}
+
+	matches := []removeMatch{{Pattern: opt.host, Lines: removed}}
+	if needsConfirmation(matches) && !opt.remove.yes {
+		printRemovedKeys(os.Stdout, "Would remove", removed)
+		question := fmt.Sprintf("Remove %d %s?", len(removed), plural(len(removed), "key", "keys"))
+		if !confirm(os.Stdin, os.Stdout, question) {
+			fmt.Println("Removal cancelled")
+			os.Exit(1)
+		}
+	}
+
+	if err := SaveFile(remaining); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to delete key: %v\n", err)
+		os.Exit(1)
+	}
+
+	printRemovedKeys(os.Stdout, "Removed", removed)
+}
+
+// runAuthorizedKeys runs ls, search, rm and tui on the authorized_keys file
+func runAuthorizedKeys(opt opts) {
+	name, err := GetFilePath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !Exists() {
+		fmt.Fprintf(os.Stderr, "Error: authorized_keys file not found in %s\n", name)
+		os.Exit(1)
+	}
+
+	keys, err := ReadFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch opt.operation {
+	case cmdList:
+		listAuthorizedKeys(keys)
+	case cmdSearch:
+		listAuthorizedKeys(SearchAuthorizedKeys(keys, opt.host))
+	case cmdRemove:
+		removeAuthorizedKeys(keys, opt)
+	case cmdTUI:
+		runTUI(keys, true, "")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseAuthorizedKey(t *testing.T) {
+	_, key := testPublicKey(t)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    AuthorizedKey
+		wantErr bool
+	}{
+		{
+			name: "plain key",
+			line: "ssh-ed25519 " + key + " alice@laptop",
+			want: AuthorizedKey{KeyType: "ssh-ed25519", Key: key, Comment: "alice@laptop"},
+		},
+		{
+			name: "no comment",
+			line: "ssh-ed25519 " + key,
+			want: AuthorizedKey{KeyType: "ssh-ed25519", Key: key},
+		},
+		{
+			name: "options with quoted spaces and commas",
+			line: `restrict,from="10.0.0.0/8,*.corp",command="echo \"a, b\"" ssh-ed25519 ` + key + " deploy key",
+			want: AuthorizedKey{
+				Options: []string{"restrict", `from="10.0.0.0/8,*.corp"`, `command="echo \"a, b\""`},
+				KeyType: "ssh-ed25519", Key: key, Comment: "deploy key",
+			},
+		},
+		{
+			name: "security key type",
+			line: "sk-ssh-ed25519@openssh.com AAAA yubikey",
+			want: AuthorizedKey{KeyType: "sk-ssh-ed25519@openssh.com", Key: "AAAA", Comment: "yubikey"},
+		},
+		{name: "comment line", line: "# keys", wantErr: true},
+		{name: "unterminated quote", line: `command="ls ssh-ed25519 ` + key, wantErr: true},
+		{name: "options without key", line: "restrict", wantErr: true},
+		{name: "empty option", line: "restrict,,pty ssh-ed25519 " + key, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAuthorizedKey(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAuthorizedKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAuthorizedKey() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.line {
+				t.Errorf("String() = %q, want %q", got.String(), tt.line)
+			}
+		})
+	}
+}
+
+func TestAuthorizedKeyOptions(t *testing.T) {
+	k, err := ParseAuthorizedKey(`restrict,from="10.0.0.0/8,*.corp",command="echo \"hi\"",expiry-time="20300102Z" ssh-ed25519 AAAA`)
+	if err != nil {
+		t.Fatalf("ParseAuthorizedKey() error = %v", err)
+	}
+
+	if !k.Restrict() {
+		t.Error("Restrict() = false, want true")
+	}
+	if got := k.From(); !reflect.DeepEqual(got, []string{"10.0.0.0/8", "*.corp"}) {
+		t.Errorf("From() = %v", got)
+	}
+	if got := k.Command(); got != `echo "hi"` {
+		t.Errorf("Command() = %q", got)
+	}
+
+	exp, ok, err := k.ExpiryTime()
+	if err != nil || !ok {
+		t.Fatalf("ExpiryTime() = %v, %v, %v", exp, ok, err)
+	}
+	if want := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC); !exp.Equal(want) {
+		t.Errorf("ExpiryTime() = %v, want %v", exp, want)
+	}
+
+	plain := AuthorizedKey{KeyType: "ssh-ed25519", Key: "AAAA"}
+	if plain.Restrict() || plain.From() != nil || plain.Command() != "" {
+		t.Error("key without options should report no options")
+	}
+	if _, ok, _ := plain.ExpiryTime(); ok {
+		t.Error("ExpiryTime() ok = true for key without expiry-time")
+	}
+
+	bad := AuthorizedKey{Options: []string{"expiry-time=2030"}}
+	if _, _, err := bad.ExpiryTime(); err == nil {
+		t.Error("ExpiryTime() should reject a malformed time")
+	}
+}
+
+func TestDisplayAuthorizedKey(t *testing.T) {
+	_, key := testPublicKey(t)
+	fp := Entry{Key: key}.Fingerprint()
+
+	got := displayAuthorizedKey(`restrict,from="10.0.0.1",expiry-time="20000101Z" ssh-ed25519 ` + key + " ci")
+	want := "ci ssh-ed25519 " + fp + " [restrict; from 10.0.0.1; expired 2000-01-01 00:00]"
+	if got != want {
+		t.Errorf("displayAuthorizedKey() = %q, want %q", got, want)
+	}
+
+	if got := displayAuthorizedKey("ssh-ed25519 " + key); !strings.HasPrefix(got, "(no comment) ") {
+		t.Errorf("displayAuthorizedKey() = %q, want placeholder comment", got)
+	}
+}
+
+func TestSearchAuthorizedKeys(t *testing.T) {
+	_, key1 := testPublicKey(t)
+	_, key2 := testPublicKey(t)
+	keys := []string{
+		"ssh-ed25519 " + key1 + " alice@laptop",
+		`from="10.0.0.0/8" ssh-ed25519 ` + key2 + " deploy",
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"alice", keys[:1]},
+		{"10.0.0.0", keys[1:]},
+		{Entry{Key: key2}.Fingerprint(), keys[1:]},
+		{"ssh-ed25519", keys},
+		{"ALICE", keys[:1]},
+		{"bob", nil},
+	}
+
+	for _, tt := range tests {
+		if got := SearchAuthorizedKeys(keys, tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchAuthorizedKeys(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteAuthorizedKeys(t *testing.T) {
+	_, key1 := testPublicKey(t)
+	_, key2 := testPublicKey(t)
+	keys := []string{
+		"ssh-ed25519 " + key1 + " alice@laptop",
+		"ssh-ed25519 " + key2 + " alice@desktop",
+	}
+
+	tests := []struct {
+		name        string
+		pattern     string
+		wantRemoved []string
+	}{
+		{name: "full line", pattern: keys[0], wantRemoved: keys[:1]},
+		{name: "comment", pattern: "alice@desktop", wantRemoved: keys[1:]},
+		{name: "fingerprint", pattern: Entry{Key: key1}.Fingerprint(), wantRemoved: keys[:1]},
+		{name: "partial comment never matches", pattern: "alice"},
+		{name: "partial fingerprint never matches", pattern: "SHA256:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, removed := deleteAuthorizedKeys(keys, tt.pattern)
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("deleteAuthorizedKeys() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if len(remaining)+len(removed) != len(keys) {
+				t.Errorf("deleteAuthorizedKeys() lost lines: %v", remaining)
+			}
+		})
+	}
+}
+
+func TestRemoveAuthorizedKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	name := filepath.Join(tmpDir, "authorized_keys")
+	setConfig(t, Config{Files: []string{name}})
+
+	_, key1 := testPublicKey(t)
+	_, key2 := testPublicKey(t)
+	_, key3 := testPublicKey(t)
+	keys := []string{
+		"ssh-ed25519 " + key1 + " alice@laptop",
+		"ssh-ed25519 " + key2 + " deploy",
+		"ssh-ed25519 " + key3 + " deploy",
+	}
+	content := strings.Join(keys, "\n") + "\n"
+	writeTestFile(t, name, content)
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	removeAuthorizedKeys(keys, opts{host: "alice"})
+	before, _ := os.ReadFile(name)
+	removeAuthorizedKeys(keys, opts{host: "deploy", remove: removeOpts{yes: true}})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	for _, want := range []string{"No matching keys for: alice", "Removed 2 keys:"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("removeAuthorizedKeys() output should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	if string(before) != content {
+		t.Errorf("removeAuthorizedKeys() rewrote the file without a match: %q", before)
+	}
+	got, _ := ReadFile()
+	if !reflect.DeepEqual(got, keys[:1]) {
+		t.Errorf("authorized_keys = %v, want only alice", got)
+	}
+}
+
+func TestTUIAuthorizedKeys(t *testing.T) {
+	_, key1 := testPublicKey(t)
+	_, key2 := testPublicKey(t)
+	keys := []string{
+		"ssh-ed25519 " + key1 + " alice@laptop",
+		`restrict ssh-ed25519 ` + key2 + " deploy",
+	}
+
+	m := Model{hosts: keys, filtered: keys, mode: viewList, authorized: true}
+
+	view := m.View()
+	for _, want := range []string{"Authorized Keys Manager", "alice@laptop", "deploy", "[restrict]"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() missing %q:\n%s", want, view)
+		}
+	}
+
+	m.search = "deploy"
+	m.filterHosts()
+	if !reflect.DeepEqual(m.filtered, keys[1:]) {
+		t.Fatalf("filterHosts() = %v, want deploy key", m.filtered)
+	}
+
+	next, _ := m.handleConfirmKeyMsg(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(Model)
+	if !reflect.DeepEqual(m.hosts, keys[:1]) {
+		t.Errorf("delete left %v, want only alice", m.hosts)
+	}
+}
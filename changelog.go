@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// changeLogPath returns the change log file, by default known_hosts.log
+// next to the first known_hosts file
+func changeLogPath() (string, error) {
+	if cfg.ChangeLog != "" {
+		return expandPath(cfg.ChangeLog)
+	}
+
+	name, err := GetFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(name), filepath.Base(name)+".log"), nil
+}
+
+// logChange appends a timestamped line describing a change made to
+// known_hosts to the change log
+func logChange(action, detail string) error {
+	name, err := changeLogPath()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open change log: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "%s %s %s%s", time.Now().UTC().Format(time.RFC3339), action, detail, getLinebreak())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write change log: %w", err)
+	}
+
+	return nil
+}
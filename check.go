@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Classification of a host key by check
+const (
+	checkUnchanged    = "unchanged"
+	checkChanged      = "changed"
+	checkNewAlgorithm = "new-algorithm"
+	checkUnreachable  = "unreachable"
+)
+
+// Exit codes of check, following the monitoring plugin convention
+const (
+	exitOK       = 0
+	exitWarning  = 1 // a new algorithm is offered
+	exitCritical = 2 // a stored key changed
+	exitUnknown  = 3 // a host couldn't be reached
+)
+
+// hostCheck is the result for one host pattern and key type
+type hostCheck struct {
+	Pattern string
+	KeyType string
+	Status  string
+	Old     string // fingerprint of the stored key
+	New     string // fingerprint of the offered key
+	Err     error
+}
+
+// String formats c for the check output
+func (c hostCheck) String() string {
+	switch c.Status {
+	case checkUnreachable:
+		return fmt.Sprintf("%-13s %s: %v", c.Status, c.Pattern, c.Err)
+	case checkChanged:
+		return fmt.Sprintf("%-13s %s %s %s -> %s", c.Status, c.Pattern, c.KeyType, c.Old, c.New)
+	case checkNewAlgorithm:
+		return fmt.Sprintf("%-13s %s %s %s", c.Status, c.Pattern, c.KeyType, c.New)
+	}
+
+	return fmt.Sprintf("%-13s %s %s %s", c.Status, c.Pattern, c.KeyType, c.Old)
+}
+
+// checkTarget is a host pattern to connect to and its stored keys
+type checkTarget struct {
+	Pattern string
+	Target  scanTarget
+	Stored  []Entry
+}
+
+// checkTargets selects the hosts to check. Without hosts every plain,
+// unmarked pattern is checked; hashed and wildcard patterns can't be
+// connected to.
+func checkTargets(lines []string, hosts []string) ([]checkTarget, error) {
+	var entries []Entry
+	for _, line := range lines {
+		if e, err := ParseEntry(line); err == nil && e.Marker == "" {
+			entries = append(entries, e)
+		}
+	}
+
+	var patterns []string
+	if len(hosts) > 0 {
+		for _, h := range hosts {
+			t, err := parseScanTarget(h)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, hostPattern(t.Host, t.Port))
+		}
+	} else {
+		for _, e := range entries {
+			for _, p := range e.Patterns {
+				if !strings.HasPrefix(p, hashPrefix) && !strings.ContainsAny(p, "*?!") {
+					patterns = append(patterns, p)
+				}
+			}
+		}
+	}
+
+	var targets []checkTarget
+	for _, p := range patterns {
+		if slices.ContainsFunc(targets, func(t checkTarget) bool { return t.Pattern == p }) {
+			continue
+		}
+
+		host, port := splitHostPattern(p)
+		t := checkTarget{Pattern: p, Target: scanTarget{Host: host, Port: port}}
+		for _, e := range entries {
+			if e.HasHost(p) {
+				t.Stored = append(t.Stored, e)
+			}
+		}
+		if len(t.Stored) == 0 {
+			return nil, fmt.Errorf("no entry for %s", p)
+		}
+		targets = append(targets, t)
+	}
+
+	return targets, nil
+}
+
+// classifyKeys compares the stored keys of a host with the keys it offered
+func classifyKeys(pattern string, stored []Entry, offered []Entry) []hostCheck {
+	var checks []hostCheck
+
+	for _, o := range offered {
+		c := hostCheck{Pattern: pattern, KeyType: o.KeyType, New: o.Fingerprint()}
+
+		var same []Entry
+		for _, s := range stored {
+			if s.KeyType == o.KeyType {
+				same = append(same, s)
+			}
+		}
+
+		switch {
+		case len(same) == 0:
+			c.Status = checkNewAlgorithm
+		case slices.ContainsFunc(same, func(s Entry) bool { return s.Key == o.Key }):
+			c.Status, c.Old = checkUnchanged, o.Fingerprint()
+		default:
+			c.Status, c.Old = checkChanged, same[0].Fingerprint()
+		}
+		checks = append(checks, c)
+	}
+
+	return checks
+}
+
+// CheckHosts connects to each target and classifies the keys it offers
+func CheckHosts(targets []checkTarget, opt scanOpts) []hostCheck {
+	scanTargets := make([]scanTarget, len(targets))
+	for i, t := range targets {
+		scanTargets[i] = t.Target
+	}
+
+	opt.types = slices.Clone(defaultScanTypes)
+	for _, t := range targets {
+		for _, e := range t.Stored {
+			if e.KeyType == "ssh-dss" && !slices.Contains(opt.types, "dsa") {
+				opt.types = append(opt.types, "dsa")
+			}
+		}
+	}
+
+	offered, failed := make(map[scanTarget][]Entry), make(map[scanTarget]error)
+	for _, r := range scanHosts(scanTargets, opt) {
+		if r.Err != nil {
+			failed[r.Target] = r.Err
+			continue
+		}
+		offered[r.Target] = append(offered[r.Target], entryFromPublicKey(nil, r.Key))
+	}
+
+	var checks []hostCheck
+	for _, t := range targets {
+		keys, ok := offered[t.Target]
+		if !ok {
+			err := failed[t.Target]
+			if err == nil {
+				err = fmt.Errorf("no supported host key offered")
+			}
+			checks = append(checks, hostCheck{Pattern: t.Pattern, Status: checkUnreachable, Err: err})
+			continue
+		}
+		checks = append(checks, classifyKeys(t.Pattern, t.Stored, keys)...)
+	}
+
+	return checks
+}
+
+// seenEntries returns the stored entries whose key a host offered
+func seenEntries(targets []checkTarget, checks []hostCheck) []Entry {
+	var seen []Entry
+	for _, c := range checks {
+		if c.Status != checkUnchanged {
+			continue
+		}
+		for _, t := range targets {
+			if t.Pattern != c.Pattern {
+				continue
+			}
+			for _, e := range t.Stored {
+				if e.Fingerprint() == c.Old && !slices.ContainsFunc(seen, func(x Entry) bool { return metaKey(x) == metaKey(e) }) {
+					seen = append(seen, e)
+				}
+			}
+		}
+	}
+
+	return seen
+}
+
+// entriesFrom keeps the entries that are written in source. Only the
+// first configured file has a metadata file to record them in.
+func entriesFrom(entries []Entry, lines []sourceLine, source string) []Entry {
+	keys := make(map[string]bool)
+	for _, sl := range lines {
+		if sl.Source != source {
+			continue
+		}
+		if e, err := ParseEntry(sl.Text); err == nil {
+			keys[metaKey(e)] = true
+		}
+	}
+
+	var out []Entry
+	for _, e := range entries {
+		if keys[metaKey(e)] {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// checkExitCode returns the most severe exit code of checks
+func checkExitCode(checks []hostCheck) int {
+	code := exitOK
+	for _, c := range checks {
+		switch c.Status {
+		case checkChanged:
+			return exitCritical
+		case checkUnreachable:
+			code = exitUnknown
+		case checkNewAlgorithm:
+			if code == exitOK {
+				code = exitWarning
+			}
+		}
+	}
+
+	return code
+}
+
+// runCheck prints the classification of every checked key and exits with
+// checkExitCode
+func runCheck(lines []sourceLine, opt scanOpts) {
+	texts := make([]string, len(lines))
+	for i, sl := range lines {
+		texts[i] = sl.Text
+	}
+
+	targets, err := checkTargets(texts, opt.targets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUnknown)
+	}
+
+	checks := CheckHosts(targets, opt)
+	for _, c := range checks {
+		fmt.Println(c)
+	}
+
+	// A failure to record the last-seen dates doesn't change the result
+	if name, err := GetFilePath(); err == nil {
+		seen := entriesFrom(seenEntries(targets, checks), lines, name)
+		if err := touchMeta(seen, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record last-seen dates: %v\n", err)
+		}
+	}
+
+	os.Exit(checkExitCode(checks))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCheckTargets(t *testing.T) {
+	_, key := testPublicKey(t)
+	lines := []string{
+		"a.example.com,10.0.0.1 ssh-ed25519 " + key,
+		"[b.example.com]:2222 ssh-ed25519 " + key,
+		"|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs= ssh-ed25519 " + key,
+		"*.example.com ssh-ed25519 " + key,
+		"@cert-authority ca.example.com ssh-ed25519 " + key,
+		"a.example.com ssh-rsa AAAA",
+	}
+
+	t.Run("all hosts", func(t *testing.T) {
+		targets, err := checkTargets(lines, nil)
+		if err != nil {
+			t.Fatalf("checkTargets() error = %v", err)
+		}
+
+		var got []string
+		for _, tg := range targets {
+			got = append(got, tg.Pattern+"="+strconv.Itoa(len(tg.Stored)))
+		}
+		want := []string{"a.example.com=2", "10.0.0.1=1", "[b.example.com]:2222=1"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("checkTargets() = %v, want %v", got, want)
+		}
+		if targets[2].Target != (scanTarget{"b.example.com", 2222}) {
+			t.Errorf("checkTargets() target = %+v", targets[2].Target)
+		}
+	})
+
+	t.Run("selected hosts match hashed entries", func(t *testing.T) {
+		targets, err := checkTargets(lines, []string{"localhost", "b.example.com:2222"})
+		if err != nil {
+			t.Fatalf("checkTargets() error = %v", err)
+		}
+		if len(targets) != 2 || targets[0].Pattern != "localhost" || targets[1].Pattern != "[b.example.com]:2222" {
+			t.Errorf("checkTargets() = %+v", targets)
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		if _, err := checkTargets(lines, []string{"c.example.com"}); err == nil {
+			t.Error("checkTargets() should reject hosts without entries")
+		}
+	})
+}
+
+func TestCheckHosts(t *testing.T) {
+	ed, _ := testSigner(t)
+	ec := testECDSASigner(t)
+	rotated, _ := testSigner(t)
+
+	stable := startSSHServer(t, ed)
+	grown := startSSHServer(t, ed, ec)
+	rebuilt := startSSHServer(t, rotated)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	down := scanTarget{"127.0.0.1", l.Addr().(*net.TCPAddr).Port}
+	l.Close()
+
+	pattern := func(t scanTarget) string { return hostPattern(t.Host, t.Port) }
+	edEntry := func(t scanTarget) string {
+		return entryFromPublicKey([]string{pattern(t)}, ed.PublicKey()).String()
+	}
+	lines := []string{edEntry(stable), edEntry(grown), edEntry(rebuilt), edEntry(down)}
+
+	targets, err := checkTargets(lines, nil)
+	if err != nil {
+		t.Fatalf("checkTargets() error = %v", err)
+	}
+	checks := CheckHosts(targets, testScanOpts())
+
+	type result struct{ pattern, keyType, status string }
+	var got []result
+	for _, c := range checks {
+		got = append(got, result{c.Pattern, c.KeyType, c.Status})
+	}
+	want := []result{
+		{pattern(stable), "ssh-ed25519", checkUnchanged},
+		{pattern(grown), "ecdsa-sha2-nistp384", checkNewAlgorithm},
+		{pattern(grown), "ssh-ed25519", checkUnchanged},
+		{pattern(rebuilt), "ssh-ed25519", checkChanged},
+		{pattern(down), "", checkUnreachable},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CheckHosts() = %v, want %v", got, want)
+	}
+
+	changed := checks[3]
+	if changed.Old != entryFromPublicKey(nil, ed.PublicKey()).Fingerprint() ||
+		changed.New != entryFromPublicKey(nil, rotated.PublicKey()).Fingerprint() {
+		t.Errorf("CheckHosts() changed fingerprints = %s -> %s", changed.Old, changed.New)
+	}
+
+	if code := checkExitCode(checks); code != exitCritical {
+		t.Errorf("checkExitCode() = %d, want %d", code, exitCritical)
+	}
+}
+
+func TestEntriesFrom(t *testing.T) {
+	lines := []sourceLine{
+		{Text: "a.example ssh-ed25519 key1", Source: "/home/u/.ssh/known_hosts"},
+		{Text: "b.example ssh-ed25519 key2", Source: "/etc/ssh/ssh_known_hosts"},
+	}
+	var entries []Entry
+	for _, sl := range lines {
+		e, err := ParseEntry(sl.Text)
+		if err != nil {
+			t.Fatalf("ParseEntry() error = %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	got := entriesFrom(entries, lines, "/home/u/.ssh/known_hosts")
+	if len(got) != 1 || got[0].String() != lines[0].Text {
+		t.Errorf("entriesFrom() = %v, want only a.example", got)
+	}
+}
+
+func TestCheckExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     int
+	}{
+		{name: "nothing checked", want: exitOK},
+		{name: "unchanged", statuses: []string{checkUnchanged}, want: exitOK},
+		{name: "new algorithm", statuses: []string{checkUnchanged, checkNewAlgorithm}, want: exitWarning},
+		{name: "unreachable", statuses: []string{checkNewAlgorithm, checkUnreachable}, want: exitUnknown},
+		{name: "changed wins", statuses: []string{checkUnreachable, checkChanged, checkNewAlgorithm}, want: exitCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checks []hostCheck
+			for _, s := range tt.statuses {
+				checks = append(checks, hostCheck{Status: s})
+			}
+			if got := checkExitCode(checks); got != tt.want {
+				t.Errorf("checkExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	hashNever  = "never"
+	hashAlways = "always"
+
+	formatText     = "text"
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatTSV      = "tsv"
+	formatTemplate = "template"
+)
+
+// Config holds the user defaults read from config.toml.
+//
+// Every field has a built-in default (see defaultConfig), values from the
+// config file override the defaults and command line flags override both.
+type Config struct {
+	// Files are the known_hosts files to read, the first one is modified
+	Files []string `toml:"files"`
+	// Format is the output format of ls and search
+	Format string `toml:"format"`
+	// Template is the text/template used by the template format
+	Template string `toml:"template"`
+	// Hash is the hashing policy of the entries written by add, scan,
+	// import and sync, --hash hashes them regardless
+	Hash string `toml:"hash"`
+	// AllowedSigners is the ssh-keygen allowed signers file used by
+	// --require-signature
+	AllowedSigners string `toml:"allowed_signers"`
+	// Resolver is the DNS server (host[:port]) used by verify-dns and
+	// stale. When empty verify-dns asks the DNS server of the system, see
+	// systemNameserver, and stale the system resolver.
+	Resolver string `toml:"resolver"`
+	// ChangeLog records every key replacement, known_hosts.log next to the
+	// first file when empty
+	ChangeLog string `toml:"change_log"`
+	// Metadata holds the tags, notes and dates of entries,
+	// known_hosts.meta.json next to the first file when empty
+	Metadata string       `toml:"metadata"`
+	Backup   BackupConfig `toml:"backup"`
+	Colors   ColorConfig  `toml:"colors"`
+	Keys     KeyConfig    `toml:"keys"`
+}
+
+// BackupConfig controls the backups written before known_hosts is modified
+type BackupConfig struct {
+	// Retain is the number of backups to keep, 0 disables backups
+	Retain int `toml:"retain"`
+}
+
+// ColorConfig holds the TUI colors, any value accepted by lipgloss.Color
+type ColorConfig struct {
+	TitleForeground string `toml:"title_foreground"`
+	TitleBackground string `toml:"title_background"`
+	Selected        string `toml:"selected"`
+	Normal          string `toml:"normal"`
+	Error           string `toml:"error"`
+	Search          string `toml:"search"`
+	Match           string `toml:"match"`
+	Status          string `toml:"status"`
+	Footer          string `toml:"footer"`
+}
+
+// KeyConfig holds the TUI key bindings, using bubbletea key names
+// such as "up", "ctrl+c" or "d"
+type KeyConfig struct {
+	Up       []string `toml:"up"`
+	Down     []string `toml:"down"`
+	PageUp   []string `toml:"page_up"`
+	PageDown []string `toml:"page_down"`
+	Top      []string `toml:"top"`
+	Bottom   []string `toml:"bottom"`
+	Delete   []string `toml:"delete"`
+	Search   []string `toml:"search"`
+	Quit     []string `toml:"quit"`
+	// Tree switches between the flat list and the domain tree view
+	Tree     []string `toml:"tree"`
+	Expand   []string `toml:"expand"`
+	Collapse []string `toml:"collapse"`
+}
+
+// cfg is the effective configuration of the running process
+var cfg = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Files:  []string{filepath.Join("~", ".ssh", "known_hosts")},
+		Format: formatText,
+		Hash:   hashNever,
+		Colors: ColorConfig{
+			TitleForeground: "#FAFAFA",
+			TitleBackground: "#7D56F4",
+			Selected:        "#7D56F4",
+			Normal:          "#FAFAFA",
+			Error:           "#FF5F87",
+			Search:          "#7D56F4",
+			Match:           "#EE6FF8",
+			Status:          "#04B575",
+			Footer:          "#626262",
+		},
+		Keys: KeyConfig{
+			Up:       []string{"up"},
+			Down:     []string{"down"},
+			PageUp:   []string{"pgup"},
+			PageDown: []string{"pgdown"},
+			Top:      []string{"home"},
+			Bottom:   []string{"end"},
+			Delete:   []string{"d"},
+			Search:   []string{"/"},
+			Quit:     []string{"q", "esc", "ctrl+c"},
+
+			Tree:     []string{"t"},
+			Expand:   []string{"right"},
+			Collapse: []string{"left"},
+		},
+	}
+}
+
+// GetConfigPath returns the path of config.toml, honoring XDG_CONFIG_HOME
+func GetConfigPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "known_hosts", "config.toml"), nil
+	}
+
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(h, ".config", "known_hosts", "config.toml"), nil
+}
+
+// LoadConfig returns the defaults merged with the config file at path.
+// An empty path means the default location, which is allowed to be missing.
+func LoadConfig(path string) (Config, error) {
+	c := defaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		p, err := GetConfigPath()
+		if err != nil {
+			return c, fmt.Errorf("failed to get config path: %w", err)
+		}
+		path = p
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if !explicit && os.IsNotExist(err) {
+			return c, nil
+		}
+		return c, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	md, err := toml.DecodeFile(path, &c)
+	if err != nil {
+		return c, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return c, fmt.Errorf("unknown config key %q in %s", undecoded[0].String(), path)
+	}
+
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+func (c Config) validate() error {
+	if len(c.Files) == 0 {
+		return fmt.Errorf("files cannot be empty")
+	}
+	for _, f := range c.Files {
+		if strings.TrimSpace(f) == "" {
+			return fmt.Errorf("files cannot contain an empty path")
+		}
+	}
+
+	if !slices.Contains(supportedFormats, c.Format) {
+		return fmt.Errorf("unsupported format %q (want one of %s)", c.Format, strings.Join(supportedFormats, ", "))
+	}
+	if c.Format == formatTemplate && c.Template == "" {
+		return fmt.Errorf("format %s requires a template", formatTemplate)
+	}
+
+	if c.Hash != hashNever && c.Hash != hashAlways {
+		return fmt.Errorf("unsupported hash policy %q (want %s or %s)", c.Hash, hashNever, hashAlways)
+	}
+
+	if c.Backup.Retain < 0 {
+		return fmt.Errorf("backup.retain cannot be negative")
+	}
+
+	return nil
+}
+
+// supportedFormats lists the output formats accepted by format
+var supportedFormats = []string{formatText, formatJSON, formatCSV, formatTSV, formatTemplate}
+
+// expandPath expands a leading ~ to the user home directory
+func expandPath(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path, nil
+	}
+
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(h, path[1:]), nil
+}
+
+// writeConfig prints c in the config.toml format
+func writeConfig(w io.Writer, c Config) error {
+	return toml.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetConfigPath(t *testing.T) {
+	t.Run("XDG_CONFIG_HOME wins", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", dir)
+
+		got, err := GetConfigPath()
+		if err != nil {
+			t.Fatalf("GetConfigPath() error = %v", err)
+		}
+		want := filepath.Join(dir, "known_hosts", "config.toml")
+		if got != want {
+			t.Errorf("GetConfigPath() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("falls back to ~/.config", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", "")
+		restoreHome := setHomeDir(t, dir)
+		defer restoreHome()
+
+		got, err := GetConfigPath()
+		if err != nil {
+			t.Fatalf("GetConfigPath() error = %v", err)
+		}
+		want := filepath.Join(dir, ".config", "known_hosts", "config.toml")
+		if got != want {
+			t.Errorf("GetConfigPath() = %q, want %q", got, want)
+		}
+	})
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("missing default config returns defaults", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+		got, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, defaultConfig()) {
+			t.Errorf("LoadConfig() = %+v, want defaults", got)
+		}
+	})
+
+	t.Run("missing explicit config is an error", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "nope.toml"))
+		if err == nil {
+			t.Fatal("LoadConfig() error = nil, want error for missing explicit file")
+		}
+	})
+
+	t.Run("file values override defaults", func(t *testing.T) {
+		path := writeTestConfig(t, `
+files = ["/tmp/a_known_hosts", "/tmp/b_known_hosts"]
+hash = "always"
+
+[backup]
+retain = 3
+
+[colors]
+selected = "#00FF00"
+
+[keys]
+up = ["up", "k"]
+`)
+
+		got, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		want := defaultConfig()
+		want.Files = []string{"/tmp/a_known_hosts", "/tmp/b_known_hosts"}
+		want.Hash = hashAlways
+		want.Backup.Retain = 3
+		want.Colors.Selected = "#00FF00"
+		want.Keys.Up = []string{"up", "k"}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadConfig() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("XDG config is picked up", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", dir)
+		if err := os.MkdirAll(filepath.Join(dir, "known_hosts"), 0755); err != nil {
+			t.Fatalf("Failed to create config dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "known_hosts", "config.toml"), []byte("hash = \"always\"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		got, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if got.Hash != hashAlways {
+			t.Errorf("LoadConfig() hash = %q, want %q", got.Hash, hashAlways)
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", "colour = \"red\"\n", "unknown config key"},
+		{"bad format", "format = \"yaml\"\n", "unsupported format"},
+		{"bad hash policy", "hash = \"sometimes\"\n", "unsupported hash policy"},
+		{"negative retain", "[backup]\nretain = -1\n", "cannot be negative"},
+		{"empty files", "files = []\n", "files cannot be empty"},
+		{"invalid toml", "hash = \n", "failed to parse config"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeTestConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	dir := t.TempDir()
+	restoreHome := setHomeDir(t, dir)
+	defer restoreHome()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"~", dir},
+		{filepath.Join("~", ".ssh", "known_hosts"), filepath.Join(dir, ".ssh", "known_hosts")},
+		{"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts"},
+		{"~user/known_hosts", "~user/known_hosts"},
+	}
+
+	for _, tt := range tests {
+		got, err := expandPath(tt.input)
+		if err != nil {
+			t.Fatalf("expandPath(%q) error = %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("expandPath(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, defaultConfig()); err != nil {
+		t.Fatalf("writeConfig() error = %v", err)
+	}
+
+	// The printed config must load back to the same values
+	path := writeTestConfig(t, buf.String())
+	got, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() of printed config error = %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(got, defaultConfig()) {
+		t.Errorf("round trip = %+v, want defaults", got)
+	}
+
+	for _, want := range []string{"files = ", "[backup]", "[colors]", "[keys]"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("writeConfig() output should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
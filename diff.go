@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// diffKey identifies what a key is trusted for
+type diffKey struct {
+	Marker  string
+	Host    string
+	KeyType string
+}
+
+// hostFact is one key trusted for a diffKey and the line it came from
+type hostFact struct {
+	Key     string
+	Line    int
+	Group   []string // resolved patterns of the line
+	Hashed  bool
+	Comment string
+}
+
+// DiffItem is a host key present on one side only
+type DiffItem struct {
+	Marker      string `json:"marker,omitempty"`
+	Host        string `json:"host"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+	Line        int    `json:"line"`
+}
+
+// DiffChange is a host whose key of a given type changed
+type DiffChange struct {
+	Marker         string `json:"marker,omitempty"`
+	Host           string `json:"host"`
+	KeyType        string `json:"key_type"`
+	OldFingerprint string `json:"old_fingerprint"`
+	NewFingerprint string `json:"new_fingerprint"`
+	OldLine        int    `json:"old_line"`
+	NewLine        int    `json:"new_line"`
+}
+
+// DiffMove is an unchanged host key whose line now holds other patterns
+type DiffMove struct {
+	Host     string   `json:"host"`
+	KeyType  string   `json:"key_type"`
+	From     []string `json:"from"`
+	To       []string `json:"to"`
+	FromLine int      `json:"from_line"`
+	ToLine   int      `json:"to_line"`
+}
+
+// DiffResult is the semantic difference between two known_hosts files
+type DiffResult struct {
+	Added   []DiffItem   `json:"added"`
+	Removed []DiffItem   `json:"removed"`
+	Changed []DiffChange `json:"changed"`
+	Moved   []DiffMove   `json:"moved"`
+}
+
+// Empty reports whether the files hold the same entries
+func (d DiffResult) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Moved) == 0
+}
+
+// plainHosts returns the non-hashed patterns of lines, the names a hashed
+// pattern can be resolved to
+func plainHosts(lines []sourceLine) []string {
+	var hosts []string
+	for _, sl := range lines {
+		e, err := ParseEntry(sl.Text)
+		if err != nil {
+			continue
+		}
+		for _, p := range e.Patterns {
+			if !strings.HasPrefix(p, hashPrefix) {
+				hosts = append(hosts, p)
+			}
+		}
+	}
+
+	return hosts
+}
+
+// collectFacts expands lines into one fact per host pattern. Hashed
+// patterns are resolved against candidates when possible.
+func collectFacts(lines []sourceLine, candidates []string) map[diffKey][]hostFact {
+	facts := make(map[diffKey][]hostFact)
+
+	for _, sl := range lines {
+		e, err := ParseEntry(sl.Text)
+		if err != nil {
+			continue
+		}
+
+		group := make([]string, len(e.Patterns))
+		for i, p := range e.Patterns {
+			group[i] = p
+			if strings.HasPrefix(p, hashPrefix) {
+				for _, c := range candidates {
+					if hashMatches(p, c) {
+						group[i] = c
+						break
+					}
+				}
+			}
+		}
+
+		for _, host := range group {
+			k := diffKey{Marker: e.Marker, Host: host, KeyType: e.KeyType}
+			facts[k] = append(facts[k], hostFact{
+				Key:     e.Key,
+				Line:    sl.Line,
+				Group:   group,
+				Hashed:  e.Hashed(),
+				Comment: e.Comment,
+			})
+		}
+	}
+
+	return facts
+}
+
+func factKeys(facts []hostFact) []string {
+	keys := make([]string, 0, len(facts))
+	for _, f := range facts {
+		keys = append(keys, f.Key)
+	}
+	slices.Sort(keys)
+
+	return slices.Compact(keys)
+}
+
+func findFact(facts []hostFact, key string) (hostFact, bool) {
+	for _, f := range facts {
+		if f.Key == key {
+			return f, true
+		}
+	}
+
+	return hostFact{}, false
+}
+
+func fingerprint(key string) string {
+	return Entry{Key: key}.Fingerprint()
+}
+
+// Diff compares two known_hosts files entry by entry, ignoring order,
+// whitespace, comments and hashing where the plain name is known
+func Diff(a, b []sourceLine) (d DiffResult) {
+	candidates := append(plainHosts(a), plainHosts(b)...)
+	factsA := collectFacts(a, candidates)
+	factsB := collectFacts(b, candidates)
+
+	for k, fa := range factsA {
+		fb, ok := factsB[k]
+		if !ok {
+			for _, f := range fa {
+				d.Removed = append(d.Removed, DiffItem{k.Marker, k.Host, k.KeyType, fingerprint(f.Key), f.Line})
+			}
+			continue
+		}
+
+		keysA, keysB := factKeys(fa), factKeys(fb)
+		if !slices.Equal(keysA, keysB) {
+			// A single key replaced by another is a change, anything
+			// more involved is reported as removals and additions
+			if len(keysA) == 1 && len(keysB) == 1 {
+				d.Changed = append(d.Changed, DiffChange{
+					Marker: k.Marker, Host: k.Host, KeyType: k.KeyType,
+					OldFingerprint: fingerprint(keysA[0]), NewFingerprint: fingerprint(keysB[0]),
+					OldLine: fa[0].Line, NewLine: fb[0].Line,
+				})
+				continue
+			}
+			for _, key := range keysA {
+				if !slices.Contains(keysB, key) {
+					f, _ := findFact(fa, key)
+					d.Removed = append(d.Removed, DiffItem{k.Marker, k.Host, k.KeyType, fingerprint(key), f.Line})
+				}
+			}
+			for _, key := range keysB {
+				if !slices.Contains(keysA, key) {
+					f, _ := findFact(fb, key)
+					d.Added = append(d.Added, DiffItem{k.Marker, k.Host, k.KeyType, fingerprint(key), f.Line})
+				}
+			}
+			continue
+		}
+
+		for _, key := range keysA {
+			from, _ := findFact(fa, key)
+			to, _ := findFact(fb, key)
+
+			// Hashing splits lines, that alone isn't a move
+			if from.Hashed || to.Hashed || sameGroup(from.Group, to.Group) {
+				continue
+			}
+			d.Moved = append(d.Moved, DiffMove{
+				Host: k.Host, KeyType: k.KeyType,
+				From: from.Group, To: to.Group,
+				FromLine: from.Line, ToLine: to.Line,
+			})
+		}
+	}
+
+	for k, fb := range factsB {
+		if _, ok := factsA[k]; ok {
+			continue
+		}
+		for _, f := range fb {
+			d.Added = append(d.Added, DiffItem{k.Marker, k.Host, k.KeyType, fingerprint(f.Key), f.Line})
+		}
+	}
+
+	sortDiff(&d)
+	return d
+}
+
+func sameGroup(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+
+	return slices.Equal(a, b)
+}
+
+func sortDiff(d *DiffResult) {
+	itemLess := func(items []DiffItem) func(i, j int) bool {
+		return func(i, j int) bool {
+			if items[i].Host != items[j].Host {
+				return items[i].Host < items[j].Host
+			}
+			if items[i].KeyType != items[j].KeyType {
+				return items[i].KeyType < items[j].KeyType
+			}
+			return items[i].Fingerprint < items[j].Fingerprint
+		}
+	}
+	sort.Slice(d.Added, itemLess(d.Added))
+	sort.Slice(d.Removed, itemLess(d.Removed))
+	sort.Slice(d.Changed, func(i, j int) bool {
+		if d.Changed[i].Host != d.Changed[j].Host {
+			return d.Changed[i].Host < d.Changed[j].Host
+		}
+		return d.Changed[i].KeyType < d.Changed[j].KeyType
+	})
+	sort.Slice(d.Moved, func(i, j int) bool {
+		if d.Moved[i].Host != d.Moved[j].Host {
+			return d.Moved[i].Host < d.Moved[j].Host
+		}
+		return d.Moved[i].KeyType < d.Moved[j].KeyType
+	})
+}
+
+func markerPrefix(marker string) string {
+	if marker == "" {
+		return ""
+	}
+
+	return marker + " "
+}
+
+// writeDiff prints d in text or json format
+func writeDiff(w io.Writer, d DiffResult, format string) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "No differences")
+		return err
+	}
+
+	for _, it := range d.Removed {
+		fmt.Fprintf(w, "- %s%s %s %s\n", markerPrefix(it.Marker), it.Host, it.KeyType, it.Fingerprint)
+	}
+	for _, it := range d.Added {
+		fmt.Fprintf(w, "+ %s%s %s %s\n", markerPrefix(it.Marker), it.Host, it.KeyType, it.Fingerprint)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "~ %s%s %s %s -> %s\n", markerPrefix(c.Marker), c.Host, c.KeyType, c.OldFingerprint, c.NewFingerprint)
+	}
+	for _, m := range d.Moved {
+		fmt.Fprintf(w, "> %s %s moved from line %d (%s) to line %d (%s)\n",
+			m.Host, m.KeyType, m.FromLine, strings.Join(m.From, ","), m.ToLine, strings.Join(m.To, ","))
+	}
+
+	return nil
+}
+
+// runDiff compares two files, the second defaulting to the configured
+// known_hosts. Like diff(1) it exits with 1 when the files differ.
+func runDiff(opt diffOpts) {
+	if opt.b == "" {
+		name, err := GetFilePath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.b = name
+	}
+
+	var sides [2][]sourceLine
+	for i, name := range []string{opt.a, opt.b} {
+		lines, err := readSourceLines(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		sides[i] = lines
+	}
+
+	d := Diff(sides[0], sides[1])
+	if err := writeDiff(os.Stdout, d, opt.format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !d.Empty() {
+		os.Exit(1)
+	}
+}
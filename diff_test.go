@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func toSourceLines(lines []string) []sourceLine {
+	out := make([]sourceLine, len(lines))
+	for i, l := range lines {
+		out[i] = sourceLine{Text: l, Source: "test", Line: i + 1}
+	}
+
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	_, keyA := testPublicKey(t)
+	_, keyB := testPublicKey(t)
+	hashedLocalhost := "|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs="
+
+	tests := []struct {
+		name        string
+		a           []string
+		b           []string
+		wantAdded   []string
+		wantRemoved []string
+		wantChanged []string
+		wantMoved   []string
+	}{
+		{
+			name: "identical modulo order, whitespace and comments",
+			a:    []string{"a ssh-ed25519 " + keyA, "b ssh-ed25519 " + keyB},
+			b:    []string{"# comment", "b  ssh-ed25519\t" + keyB + " note", "a ssh-ed25519 " + keyA},
+		},
+		{
+			name:        "added and removed hosts",
+			a:           []string{"a ssh-ed25519 " + keyA},
+			b:           []string{"b ssh-ed25519 " + keyB},
+			wantAdded:   []string{"b"},
+			wantRemoved: []string{"a"},
+		},
+		{
+			name:        "changed key",
+			a:           []string{"a ssh-ed25519 " + keyA},
+			b:           []string{"a ssh-ed25519 " + keyB},
+			wantChanged: []string{"a"},
+		},
+		{
+			name:      "different key type is an addition",
+			a:         []string{"a ssh-ed25519 " + keyA},
+			b:         []string{"a ssh-ed25519 " + keyA, "a ssh-rsa AAAA"},
+			wantAdded: []string{"a"},
+		},
+		{
+			name:      "pattern moved to its own line",
+			a:         []string{"a,10.0.0.1 ssh-ed25519 " + keyA},
+			b:         []string{"a ssh-ed25519 " + keyA, "10.0.0.1 ssh-ed25519 " + keyA},
+			wantMoved: []string{"10.0.0.1", "a"},
+		},
+		{
+			name: "pattern order is not a move",
+			a:    []string{"a,10.0.0.1 ssh-ed25519 " + keyA},
+			b:    []string{"10.0.0.1,a ssh-ed25519 " + keyA},
+		},
+		{
+			name: "hashed and plain are the same host",
+			a:    []string{"localhost ssh-ed25519 " + keyA},
+			b:    []string{hashedLocalhost + " ssh-ed25519 " + keyA},
+		},
+		{
+			name:        "hashed host with changed key",
+			a:           []string{"localhost ssh-ed25519 " + keyA},
+			b:           []string{hashedLocalhost + " ssh-ed25519 " + keyB},
+			wantChanged: []string{"localhost"},
+		},
+		{
+			name:      "unknown hashed host stays hashed",
+			a:         nil,
+			b:         []string{hashedLocalhost + " ssh-ed25519 " + keyA},
+			wantAdded: []string{hashedLocalhost},
+		},
+		{
+			name:        "marker is part of the identity",
+			a:           []string{"@revoked a ssh-ed25519 " + keyA},
+			b:           []string{"a ssh-ed25519 " + keyA},
+			wantAdded:   []string{"a"},
+			wantRemoved: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Diff(toSourceLines(tt.a), toSourceLines(tt.b))
+
+			var added, removed, changed, moved []string
+			for _, it := range d.Added {
+				added = append(added, it.Host)
+			}
+			for _, it := range d.Removed {
+				removed = append(removed, it.Host)
+			}
+			for _, c := range d.Changed {
+				changed = append(changed, c.Host)
+			}
+			for _, m := range d.Moved {
+				moved = append(moved, m.Host)
+			}
+
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("Diff() added = %v, want %v", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("Diff() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("Diff() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !reflect.DeepEqual(moved, tt.wantMoved) {
+				t.Errorf("Diff() moved = %v, want %v", moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	_, keyA := testPublicKey(t)
+	_, keyB := testPublicKey(t)
+	d := Diff(
+		toSourceLines([]string{"a ssh-ed25519 " + keyA, "b ssh-ed25519 " + keyA}),
+		toSourceLines([]string{"a ssh-ed25519 " + keyB, "c ssh-ed25519 " + keyA}),
+	)
+	fpA := Entry{Key: keyA}.Fingerprint()
+	fpB := Entry{Key: keyB}.Fingerprint()
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeDiff(&buf, d, formatText); err != nil {
+			t.Fatalf("writeDiff() error = %v", err)
+		}
+
+		want := "- b ssh-ed25519 " + fpA + "\n" +
+			"+ c ssh-ed25519 " + fpA + "\n" +
+			"~ a ssh-ed25519 " + fpA + " -> " + fpB + "\n"
+		if buf.String() != want {
+			t.Errorf("writeDiff() = %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeDiff(&buf, d, formatJSON); err != nil {
+			t.Fatalf("writeDiff() error = %v", err)
+		}
+
+		var got DiffResult
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("writeDiff() invalid json: %v", err)
+		}
+		if !reflect.DeepEqual(got, d) {
+			t.Errorf("writeDiff() round trip = %+v, want %+v", got, d)
+		}
+	})
+
+	t.Run("no differences", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeDiff(&buf, DiffResult{}, formatText); err != nil {
+			t.Fatalf("writeDiff() error = %v", err)
+		}
+		if strings.TrimSpace(buf.String()) != "No differences" {
+			t.Errorf("writeDiff() = %q", buf.String())
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dnsTypeSSHFP is the SSHFP resource record type, RFC 4255
+	dnsTypeSSHFP dnsmessage.Type = 44
+
+	defaultDNSTimeout = 5 * time.Second
+	resolvConf        = "/etc/resolv.conf"
+)
+
+// nameserverLookup finds the DNS server of the system, see
+// systemNameserver
+var nameserverLookup = systemNameserver
+
+// dnsClient sends queries to a single DNS server. Go's resolver can't look
+// up SSHFP records, so queries are built with dnsmessage.
+type dnsClient struct {
+	server  string
+	timeout time.Duration
+}
+
+// newDNSClient returns a client for server (host or host:port), the DNS
+// server of the system when server is empty
+func newDNSClient(server string, timeout time.Duration) (*dnsClient, error) {
+	if server == "" {
+		s, err := nameserverLookup()
+		if err != nil {
+			return nil, fmt.Errorf("no resolver configured (%w), pass --resolver or set resolver in the config", err)
+		}
+		server = s
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+
+	return &dnsClient{server: server, timeout: timeout}, nil
+}
+
+// systemResolver returns the first nameserver listed in the resolv.conf
+// file name
+func systemResolver(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no nameserver in %s", name)
+}
+
+// exchange sends a query for name and returns the answer. Truncated UDP
+// answers are retried over TCP.
+func (c *dnsClient) exchange(name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS name %q: %w", name, err)
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	q := dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               binary.BigEndian.Uint16(id[:]),
+			RecursionDesired: true,
+			// Ask the resolver to tell whether it validated the answer
+			AuthenticData: true,
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.roundTrip("udp", packed)
+	if err == nil && resp.Truncated {
+		resp, err = c.roundTrip("tcp", packed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", name, err)
+	}
+
+	if resp.ID != query.ID || !resp.Response || len(resp.Questions) != 1 || resp.Questions[0] != q {
+		return nil, fmt.Errorf("query %s: mismatched response", name)
+	}
+
+	return resp, nil
+}
+
+func (c *dnsClient) roundTrip(network string, query []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, c.server, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	var n int
+	if network == "tcp" {
+		// DNS over TCP prefixes messages with their length
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return nil, err
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// lookupSSHFP returns the SSHFP records of host and whether the resolver
+// validated them with DNSSEC. A name without records isn't an error.
+func (c *dnsClient) lookupSSHFP(host string) (records []sshfpRecord, authenticated bool, err error) {
+	resp, err := c.exchange(host, dnsTypeSSHFP)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, false, fmt.Errorf("query %s: %s", host, resp.RCode)
+	}
+
+	for _, a := range resp.Answers {
+		if a.Header.Type != dnsTypeSSHFP {
+			continue
+		}
+
+		body, ok := a.Body.(*dnsmessage.UnknownResource)
+		if !ok || len(body.Data) < 3 {
+			return nil, false, fmt.Errorf("query %s: malformed SSHFP record", host)
+		}
+		records = append(records, sshfpRecord{
+			Host:        host,
+			Algorithm:   body.Data[0],
+			Type:        body.Data[1],
+			Fingerprint: hex.EncodeToString(body.Data[2:]),
+		})
+	}
+
+	return records, resp.AuthenticData, nil
+}
+
+// lookupAddrs returns the IPv4 and IPv6 addresses of host. A name without
+// addresses isn't an error.
+func (c *dnsClient) lookupAddrs(host string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		resp, err := c.exchange(host, qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+		default:
+			return nil, fmt.Errorf("query %s: %s", host, resp.RCode)
+		}
+
+		// CNAME answers are followed by the records of their target
+		for _, a := range resp.Answers {
+			switch body := a.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, netip.AddrFrom4(body.A))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+			}
+		}
+	}
+
+	return addrs, nil
+}
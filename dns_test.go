@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubZone maps lowercase FQDNs to their SSHFP records
+type stubZone map[string][]sshfpRecord
+
+// stubDNS is a local DNS server answering SSHFP queries from a zone and
+// address queries from addrs
+type stubDNS struct {
+	zone     stubZone
+	addrs    map[string][]netip.Addr
+	servfail bool
+	truncate bool // answer UDP queries with TC set
+	ad       bool
+}
+
+func (s *stubDNS) answer(t *testing.T, query []byte, udp bool) []byte {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil {
+		t.Errorf("stub DNS got invalid query: %v", err)
+		return nil
+	}
+
+	h := dnsmessage.Header{ID: q.ID, Response: true, RecursionDesired: q.RecursionDesired, AuthenticData: s.ad}
+	name := strings.ToLower(q.Questions[0].Name.String())
+	records, ok := s.zone[name]
+	addrs, hasAddrs := s.addrs[name]
+	ok = ok || hasAddrs
+	switch {
+	case s.servfail:
+		h.RCode = dnsmessage.RCodeServerFailure
+	case !ok:
+		h.RCode = dnsmessage.RCodeNameError
+	case udp && s.truncate:
+		h.Truncated = true
+		records, addrs = nil, nil
+	}
+
+	b := dnsmessage.NewBuilder(nil, h)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(q.Questions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		rh := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Class: dnsmessage.ClassINET, TTL: 60}
+		var err error
+		switch {
+		case q.Questions[0].Type == dnsmessage.TypeA && addr.Is4():
+			rh.Type = dnsmessage.TypeA
+			err = b.AResource(rh, dnsmessage.AResource{A: addr.As4()})
+		case q.Questions[0].Type == dnsmessage.TypeAAAA && addr.Is6():
+			rh.Type = dnsmessage.TypeAAAA
+			err = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: addr.As16()})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range records {
+		if q.Questions[0].Type != dnsTypeSSHFP {
+			continue
+		}
+		fp, err := hex.DecodeString(r.Fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rh := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsTypeSSHFP, Class: dnsmessage.ClassINET, TTL: 60}
+		data := append([]byte{r.Algorithm, r.Type}, fp...)
+		if err := b.UnknownResource(rh, dnsmessage.UnknownResource{Type: dnsTypeSSHFP, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+// start serves s over UDP and TCP on a local port and returns its address
+func (s *stubDNS) start(t *testing.T) string {
+	t.Helper()
+
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { tl.Close() })
+
+	ul, err := net.ListenPacket("udp", tl.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ul.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := ul.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			ul.WriteTo(s.answer(t, buf[:n], true), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := s.answer(t, query, false)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}()
+		}
+	}()
+
+	return tl.Addr().String()
+}
+
+// testSSHFPZone publishes the records ssh-keygen -r prints for
+// testSignerKey as server.example.com
+func testSSHFPZone() stubZone {
+	return stubZone{
+		"server.example.com.": {
+			{"server.example.com", 4, 1, "9e60c0aa81119f41de82de59db993c340772d593"},
+			{"server.example.com", 4, 2, "8734cc6263fe1ec7be58c06493847a0e068af3073db79fedca54c4d4fb52da71"},
+		},
+		"db.example.com.": {
+			{"db.example.com", 4, 2, strings.Repeat("00", 32)},
+		},
+	}
+}
+
+func TestLookupSSHFP(t *testing.T) {
+	t.Run("records", func(t *testing.T) {
+		stub := &stubDNS{zone: testSSHFPZone(), ad: true}
+		c, err := newDNSClient(stub.start(t), time.Second)
+		if err != nil {
+			t.Fatalf("newDNSClient() error = %v", err)
+		}
+
+		records, authenticated, err := c.lookupSSHFP("Server.Example.com")
+		if err != nil {
+			t.Fatalf("lookupSSHFP() error = %v", err)
+		}
+		want := testSSHFPZone()["server.example.com."]
+		for i := range want {
+			want[i].Host = "Server.Example.com"
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("lookupSSHFP() = %v, want %v", records, want)
+		}
+		if !authenticated {
+			t.Error("lookupSSHFP() authenticated = false, want resolver AD bit")
+		}
+	})
+
+	t.Run("nxdomain", func(t *testing.T) {
+		stub := &stubDNS{zone: testSSHFPZone()}
+		c, _ := newDNSClient(stub.start(t), time.Second)
+
+		records, _, err := c.lookupSSHFP("unknown.example.com")
+		if err != nil || len(records) != 0 {
+			t.Errorf("lookupSSHFP() = %v, %v, want no records", records, err)
+		}
+	})
+
+	t.Run("servfail", func(t *testing.T) {
+		stub := &stubDNS{zone: testSSHFPZone(), servfail: true}
+		c, _ := newDNSClient(stub.start(t), time.Second)
+
+		if _, _, err := c.lookupSSHFP("server.example.com"); err == nil {
+			t.Error("lookupSSHFP() should fail on SERVFAIL")
+		}
+	})
+
+	t.Run("truncated answer retried over tcp", func(t *testing.T) {
+		stub := &stubDNS{zone: testSSHFPZone(), truncate: true}
+		c, _ := newDNSClient(stub.start(t), time.Second)
+
+		records, _, err := c.lookupSSHFP("server.example.com")
+		if err != nil || len(records) != 2 {
+			t.Errorf("lookupSSHFP() = %v, %v, want 2 records over tcp", records, err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer pc.Close()
+
+		c, _ := newDNSClient(pc.LocalAddr().String(), 50*time.Millisecond)
+		if _, _, err := c.lookupSSHFP("server.example.com"); err == nil {
+			t.Error("lookupSSHFP() should time out")
+		}
+	})
+}
+
+func TestNewDNSClient(t *testing.T) {
+	c, err := newDNSClient("192.0.2.1", 0)
+	if err != nil {
+		t.Fatalf("newDNSClient() error = %v", err)
+	}
+	if c.server != "192.0.2.1:53" || c.timeout != defaultDNSTimeout {
+		t.Errorf("newDNSClient() = %+v", c)
+	}
+
+	if c, _ := newDNSClient("[2001:db8::1]", time.Second); c.server != "[2001:db8::1]:53" {
+		t.Errorf("newDNSClient() server = %s", c.server)
+	}
+}
+
+func TestNewDNSClientWithoutSystemResolver(t *testing.T) {
+	old := nameserverLookup
+	defer func() { nameserverLookup = old }()
+
+	nameserverLookup = func() (string, error) { return "10.0.0.53", nil }
+	if c, err := newDNSClient("", 0); err != nil || c.server != "10.0.0.53:53" {
+		t.Errorf("newDNSClient() = %+v, %v, want the system resolver", c, err)
+	}
+
+	nameserverLookup = func() (string, error) { return "", os.ErrNotExist }
+	_, err := newDNSClient("", 0)
+	if err == nil || !strings.Contains(err.Error(), "--resolver") || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("newDNSClient() error = %v, want a hint to pass --resolver", err)
+	}
+}
+
+func TestSystemResolver(t *testing.T) {
+	dir := t.TempDir()
+
+	conf := filepath.Join(dir, "resolv.conf")
+	writeTestFile(t, conf, "# generated\nsearch corp\nnameserver 10.0.0.53\nnameserver 10.0.0.54\n")
+	if got, err := systemResolver(conf); err != nil || got != "10.0.0.53" {
+		t.Errorf("systemResolver() = %q, %v", got, err)
+	}
+
+	empty := filepath.Join(dir, "empty.conf")
+	writeTestFile(t, empty, "search corp\n")
+	if _, err := systemResolver(empty); err == nil {
+		t.Error("systemResolver() should fail without nameservers")
+	}
+
+	if _, err := systemResolver(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("systemResolver() error = %v, want not exist", err)
+	}
+}
+
+func TestLookupAddrs(t *testing.T) {
+	stub := &stubDNS{addrs: map[string][]netip.Addr{
+		"web.example.com.": {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("2001:db8::5")},
+	}}
+	c, err := newDNSClient(stub.start(t), time.Second)
+	if err != nil {
+		t.Fatalf("newDNSClient() error = %v", err)
+	}
+
+	got, err := c.lookupAddrs("web.example.com")
+	if err != nil {
+		t.Fatalf("lookupAddrs() error = %v", err)
+	}
+	if want := stub.addrs["web.example.com."]; !reflect.DeepEqual(got, want) {
+		t.Errorf("lookupAddrs() = %v, want %v", got, want)
+	}
+
+	if got, err := c.lookupAddrs("gone.example.com"); err != nil || len(got) != 0 {
+		t.Errorf("lookupAddrs() = %v, %v, want no addresses", got, err)
+	}
+
+	failing := &stubDNS{addrs: stub.addrs, servfail: true}
+	c, _ = newDNSClient(failing.start(t), time.Second)
+	if _, err := c.lookupAddrs("web.example.com"); err == nil {
+		t.Error("lookupAddrs() should fail on SERVFAIL")
+	}
+}
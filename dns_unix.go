@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// systemNameserver returns the first nameserver of resolv.conf
+func systemNameserver() (string, error) {
+	return systemResolver(resolvConf)
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemNameserver returns the first DNS server of the network adapters
+// that are up
+func systemNameserver() (string, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_UNICAST|windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST, 0, aa, &size)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, windows.ERROR_BUFFER_OVERFLOW) {
+			return "", os.NewSyscallError("GetAdaptersAddresses", err)
+		}
+	}
+
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			ip := dns.Address.IP()
+			// Skip the deprecated site-local fec0::/10 defaults Windows
+			// lists for adapters without IPv6 DNS servers
+			if ip == nil || (len(ip) == 16 && ip[0] == 0xfe && ip[1]&0xc0 == 0xc0) {
+				continue
+			}
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no DNS server on the network adapters")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	markerCertAuthority = "@cert-authority"
+	markerRevoked       = "@revoked"
+
+	hashPrefix     = "|1|"
+	defaultSSHPort = 22
+)
+
+// Entry is a parsed known_hosts line. Unlike Host it understands the full
+// sshd(8) format:
+//
+//	[marker] pattern[,pattern...] keytype base64-key [comment]
+//
+// Patterns are kept as written, including [host]:port brackets, hashed
+// hosts (|1|salt|hash), wildcards and negations.
+type Entry struct {
+	Marker   string
+	Patterns []string
+	KeyType  string
+	Key      string
+	Comment  string
+}
+
+// ParseEntry parses a single known_hosts line
+func ParseEntry(line string) (e Entry, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return e, fmt.Errorf("not a host entry: '%s'", line)
+	}
+
+	if strings.HasPrefix(fields[0], "@") {
+		if fields[0] != markerCertAuthority && fields[0] != markerRevoked {
+			return e, fmt.Errorf("unknown marker %s: '%s'", fields[0], line)
+		}
+		e.Marker = fields[0]
+		fields = fields[1:]
+	}
+
+	if len(fields) < 3 {
+		return e, fmt.Errorf("invalid host: '%s'", line)
+	}
+
+	e.Patterns = strings.Split(fields[0], ",")
+	e.KeyType = fields[1]
+	e.Key = fields[2]
+	e.Comment = strings.Join(fields[3:], " ")
+
+	return e, nil
+}
+
+// String formats the entry as a known_hosts line
+func (e Entry) String() string {
+	fields := make([]string, 0, 5)
+	if e.Marker != "" {
+		fields = append(fields, e.Marker)
+	}
+	fields = append(fields, strings.Join(e.Patterns, ","), e.KeyType, e.Key)
+	if e.Comment != "" {
+		fields = append(fields, e.Comment)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Hashed reports whether the host patterns are hashed (HashKnownHosts)
+func (e Entry) Hashed() bool {
+	return len(e.Patterns) == 1 && strings.HasPrefix(e.Patterns[0], hashPrefix)
+}
+
+// Wildcard reports whether any pattern uses *, ? or ! matching
+func (e Entry) Wildcard() bool {
+	for _, p := range e.Patterns {
+		if strings.ContainsAny(p, "*?!") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key in ssh-keygen -l
+// format, or an empty string when the key isn't valid base64
+func (e Entry) Fingerprint() string {
+	blob, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// HasHost reports whether one of the patterns is exactly host, given in
+// known_hosts form (see hostPattern). Hashed patterns are compared by
+// hashing host with their salt; wildcards never match.
+func (e Entry) HasHost(host string) bool {
+	for _, p := range e.Patterns {
+		if p == host {
+			return true
+		}
+		if strings.HasPrefix(p, hashPrefix) && hashMatches(p, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostPattern returns host in known_hosts form, adding [host]:port
+// brackets for non-default ports
+func hostPattern(host string, port int) string {
+	if port == 0 || port == defaultSSHPort {
+		return host
+	}
+
+	return "[" + host + "]:" + strconv.Itoa(port)
+}
+
+// splitHostPattern is the inverse of hostPattern
+func splitHostPattern(pattern string) (host string, port int) {
+	if strings.HasPrefix(pattern, "[") {
+		if h, p, err := net.SplitHostPort(pattern); err == nil {
+			if n, err := strconv.Atoi(p); err == nil {
+				return h, n
+			}
+		}
+	}
+
+	return pattern, defaultSSHPort
+}
+
+// hashHost hashes host with salt the way ssh-keygen -H does
+func hashHost(host string, salt []byte) string {
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+
+	return hashPrefix + base64.StdEncoding.EncodeToString(salt) + "|" +
+		base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newHashedHost hashes host with a random salt
+func newHashedHost(host string) (string, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	return hashHost(host, salt), nil
+}
+
+func hashMatches(hashed, host string) bool {
+	parts := strings.Split(strings.TrimPrefix(hashed, hashPrefix), "|")
+	if len(parts) != 2 {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(hashHost(host, salt)), []byte(hashed))
+}
+
+// hashEntry returns e with one hashed line per pattern, as ssh-keygen -H
+// writes them. Already hashed entries are returned unchanged.
+func hashEntry(e Entry) ([]Entry, error) {
+	if e.Hashed() {
+		return []Entry{e}, nil
+	}
+
+	out := make([]Entry, 0, len(e.Patterns))
+	for _, p := range e.Patterns {
+		hashed, err := newHashedHost(p)
+		if err != nil {
+			return nil, err
+		}
+
+		h := e
+		h.Patterns = []string{hashed}
+		out = append(out, h)
+	}
+
+	return out, nil
+}
+
+// validateKey checks that key is a well formed base64 SSH public key blob
+// of type keyType
+func validateKey(keyType, key string) error {
+	blob, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid base64 key: %w", err)
+	}
+
+	pub, err := ssh.ParsePublicKey(blob)
+	if err != nil {
+		return fmt.Errorf("invalid %s key: %w", keyType, err)
+	}
+
+	if pub.Type() != keyType {
+		return fmt.Errorf("key type mismatch: line says %s, key is %s", keyType, pub.Type())
+	}
+
+	return nil
+}
+
+// entryFromPublicKey builds an unmarked entry for pub
+func entryFromPublicKey(patterns []string, pub ssh.PublicKey) Entry {
+	return Entry{
+		Patterns: patterns,
+		KeyType:  pub.Type(),
+		Key:      base64.StdEncoding.EncodeToString(pub.Marshal()),
+	}
+}
+
+// wildcardMatch matches s against an ssh style pattern where * matches any
+// run of characters and ? a single one
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if wildcardMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return s == ""
+}
+
+// matchPatternList matches s against a comma separated list of wildcard
+// patterns. A matching negated (!) pattern always rejects s.
+func matchPatternList(list, s string) bool {
+	matched := false
+	for _, p := range strings.Split(list, ",") {
+		if negated := strings.HasPrefix(p, "!"); negated {
+			if wildcardMatch(p[1:], s) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(p, s) {
+			matched = true
+		}
+	}
+
+	return matched
+}
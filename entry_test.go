@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testPublicKey returns a fresh Ed25519 key in known_hosts base64 form
+func testPublicKey(t *testing.T) (keyType, key string) {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert key: %v", err)
+	}
+
+	e := entryFromPublicKey(nil, sshPub)
+	return e.KeyType, e.Key
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Entry
+		wantErr bool
+	}{
+		{
+			name:  "plain host",
+			input: "github.com ssh-rsa AAAA",
+			want:  Entry{Patterns: []string{"github.com"}, KeyType: "ssh-rsa", Key: "AAAA"},
+		},
+		{
+			name:  "several patterns with port and comment",
+			input: "myserver,[10.0.0.1]:2222 ssh-ed25519 AAAA added by hand",
+			want: Entry{
+				Patterns: []string{"myserver", "[10.0.0.1]:2222"},
+				KeyType:  "ssh-ed25519",
+				Key:      "AAAA",
+				Comment:  "added by hand",
+			},
+		},
+		{
+			name:  "cert authority marker",
+			input: "@cert-authority *.example.com ssh-rsa AAAA",
+			want:  Entry{Marker: markerCertAuthority, Patterns: []string{"*.example.com"}, KeyType: "ssh-rsa", Key: "AAAA"},
+		},
+		{
+			name:  "tabs between fields",
+			input: "@revoked\tgithub.com\tssh-rsa\tAAAA",
+			want:  Entry{Marker: markerRevoked, Patterns: []string{"github.com"}, KeyType: "ssh-rsa", Key: "AAAA"},
+		},
+		{name: "comment line", input: "# a comment", wantErr: true},
+		{name: "empty line", input: "   ", wantErr: true},
+		{name: "unknown marker", input: "@trusted github.com ssh-rsa AAAA", wantErr: true},
+		{name: "missing key", input: "github.com ssh-rsa", wantErr: true},
+		{name: "marker only", input: "@revoked github.com ssh-rsa", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEntry(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	lines := []string{
+		"github.com ssh-rsa AAAA",
+		"myserver,[10.0.0.1]:2222 ssh-ed25519 AAAA added by hand",
+		"@revoked github.com ssh-rsa AAAA",
+	}
+
+	for _, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil {
+			t.Fatalf("ParseEntry(%q) error = %v", line, err)
+		}
+		if got := e.String(); got != line {
+			t.Errorf("String() = %q, want %q", got, line)
+		}
+	}
+}
+
+func TestHostPattern(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"github.com", 22, "github.com"},
+		{"github.com", 0, "github.com"},
+		{"github.com", 2222, "[github.com]:2222"},
+		{"2001:db8::1", 2222, "[2001:db8::1]:2222"},
+	}
+
+	for _, tt := range tests {
+		got := hostPattern(tt.host, tt.port)
+		if got != tt.want {
+			t.Errorf("hostPattern(%q, %d) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+
+		host, port := splitHostPattern(got)
+		wantPort := tt.port
+		if wantPort == 0 {
+			wantPort = defaultSSHPort
+		}
+		if host != tt.host || port != wantPort {
+			t.Errorf("splitHostPattern(%q) = %q, %d, want %q, %d", got, host, port, tt.host, wantPort)
+		}
+	}
+}
+
+func TestHashedHosts(t *testing.T) {
+	hashed, err := newHashedHost("[github.com]:2222")
+	if err != nil {
+		t.Fatalf("newHashedHost() error = %v", err)
+	}
+	if !strings.HasPrefix(hashed, hashPrefix) {
+		t.Fatalf("newHashedHost() = %q, want %s prefix", hashed, hashPrefix)
+	}
+
+	e := Entry{Patterns: []string{hashed}, KeyType: "ssh-rsa", Key: "AAAA"}
+	if !e.Hashed() {
+		t.Error("Hashed() = false for hashed entry")
+	}
+	if !e.HasHost("[github.com]:2222") {
+		t.Error("HasHost() should match the hashed host")
+	}
+	if e.HasHost("github.com") {
+		t.Error("HasHost() should not match a different host")
+	}
+
+	// Known value generated by ssh-keygen -H for "localhost"
+	known := Entry{Patterns: []string{"|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs="}}
+	if !known.HasHost("localhost") {
+		t.Error("HasHost() should match the ssh-keygen hashed localhost")
+	}
+}
+
+func TestHashEntry(t *testing.T) {
+	e := Entry{Patterns: []string{"myserver", "10.0.0.1"}, KeyType: "ssh-rsa", Key: "AAAA", Comment: "c"}
+
+	got, err := hashEntry(e)
+	if err != nil {
+		t.Fatalf("hashEntry() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("hashEntry() returned %d entries, want one per pattern", len(got))
+	}
+	for i, h := range got {
+		if !h.Hashed() || !h.HasHost(e.Patterns[i]) {
+			t.Errorf("hashEntry()[%d] = %v, want hashed %s", i, h, e.Patterns[i])
+		}
+		if h.Key != e.Key || h.Comment != e.Comment {
+			t.Errorf("hashEntry()[%d] should keep key and comment", i)
+		}
+	}
+}
+
+func TestEntryWildcard(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     bool
+	}{
+		{[]string{"github.com"}, false},
+		{[]string{"*.example.com"}, true},
+		{[]string{"host?"}, true},
+		{[]string{"a", "!b"}, true},
+	}
+
+	for _, tt := range tests {
+		e := Entry{Patterns: tt.patterns}
+		if got := e.Wildcard(); got != tt.want {
+			t.Errorf("Wildcard(%v) = %v, want %v", tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	keyType, key := testPublicKey(t)
+	e := Entry{KeyType: keyType, Key: key}
+
+	blob, _ := ssh.ParsePublicKey(mustDecodeBase64(t, key))
+	if got, want := e.Fingerprint(), ssh.FingerprintSHA256(blob); got != want {
+		t.Errorf("Fingerprint() = %q, want %q", got, want)
+	}
+
+	if got := (Entry{Key: "not base64!"}).Fingerprint(); got != "" {
+		t.Errorf("Fingerprint() of invalid key = %q, want empty", got)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	keyType, key := testPublicKey(t)
+
+	if err := validateKey(keyType, key); err != nil {
+		t.Errorf("validateKey() error = %v for valid key", err)
+	}
+	if err := validateKey("ssh-rsa", key); err == nil {
+		t.Error("validateKey() should reject a key type mismatch")
+	}
+	if err := validateKey(keyType, "AAAA"); err == nil {
+		t.Error("validateKey() should reject a truncated blob")
+	}
+	if err := validateKey(keyType, "***"); err == nil {
+		t.Error("validateKey() should reject invalid base64")
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		list string
+		s    string
+		want bool
+	}{
+		{"alice@corp", "alice@corp", true},
+		{"alice@corp", "alice@corp.evil", false},
+		{"*@corp", "bob@corp", true},
+		{"*.example.com", "example.com", false},
+		{"host?", "host1", true},
+		{"host?", "host12", false},
+		{"*", "", true},
+		{"a*b*c", "axxbyyc", true},
+		{"*@corp,!bob@corp", "bob@corp", false},
+		{"*@corp,!bob@corp", "alice@corp", true},
+		{"!bob@corp", "alice@corp", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPatternList(tt.list, tt.s); got != tt.want {
+			t.Errorf("matchPatternList(%q, %q) = %v, want %v", tt.list, tt.s, got, tt.want)
+		}
+	}
+}
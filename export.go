@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runExport writes the PuTTY registry file to stdout and the entries that
+// couldn't be exported to stderr
+func runExport(hosts []string) {
+	values, skips := ExportPutty(hosts)
+
+	if err := writePuttyReg(os.Stdout, values); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, s := range skips {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", s.Name, s.Reason)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,14 +15,13 @@ const (
 	unixFormat string = "\n"
 )
 
-// GetFilePath returns the filepath of known_hosts
+// GetFilePath returns the filepath of known_hosts, the first configured file
 func GetFilePath() (string, error) {
-	h, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+	if len(cfg.Files) == 0 {
+		return "", fmt.Errorf("no known_hosts file configured")
 	}
 
-	return filepath.Join(h, ".ssh", "known_hosts"), nil
+	return expandPath(cfg.Files[0])
 }
 
 // Exists returns the file existence
@@ -58,6 +59,77 @@ func stringToLine(input string) (lines []string) {
 	return lines
 }
 
+// sourceLine is a non-empty known_hosts line and where it was read from
+type sourceLine struct {
+	Text   string
+	Source string
+	Line   int
+}
+
+// readSourceLines reads name keeping the 1-based line number of each line
+func readSourceLines(name string) ([]sourceLine, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	input := strings.ReplaceAll(string(b), "\r\n", "\n")
+	input = strings.ReplaceAll(input, "\r", "\n")
+
+	var lines []sourceLine
+	for i, v := range strings.Split(input, "\n") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			lines = append(lines, sourceLine{Text: v, Source: name, Line: i + 1})
+		}
+	}
+
+	return lines, nil
+}
+
+// ReadAllFiles reads every configured known_hosts file. Only the first file
+// is required to exist, the others are skipped when missing like ssh does.
+func ReadAllFiles() ([]sourceLine, error) {
+	var lines []sourceLine
+
+	for i, f := range cfg.Files {
+		name, err := expandPath(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get known_hosts path: %w", err)
+		}
+
+		l, err := readSourceLines(name)
+		if err != nil {
+			if i > 0 && os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		lines = append(lines, l...)
+	}
+
+	return lines, nil
+}
+
+// CreateFile creates an empty known_hosts file, and its directory, readable
+// by the user only
+func CreateFile() error {
+	name, err := GetFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get known_hosts path: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(name), err)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create known_hosts: %w", err)
+	}
+
+	return f.Close()
+}
+
 // ReadFile read known_hosts file and returns a string slice
 func ReadFile() ([]string, error) {
 	name, err := GetFilePath()
@@ -86,24 +158,80 @@ func SaveFile(input []string) error {
 		perm = info.Mode().Perm()
 	}
 
+	if err := backupFile(name, cfg.Backup.Retain); err != nil {
+		return fmt.Errorf("failed to back up known_hosts: %w", err)
+	}
+
 	str := strings.Join(input, getLinebreak()) + getLinebreak()
 
 	return os.WriteFile(name, []byte(str), perm)
 }
 
+// backupFile copies name to name.bak.<timestamp> and keeps only the newest
+// retain backups. It does nothing when retain is 0 or name doesn't exist yet.
+func backupFile(name string, retain int) error {
+	if retain <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	backup := name + ".bak." + time.Now().Format("20060102T150405.000000000")
+	if err := os.WriteFile(backup, b, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// Glob would read brackets and stars in name as a pattern, so list the
+	// directory instead. The timestamp format sorts lexically, so the
+	// oldest backups come first.
+	dir, prefix := filepath.Dir(name), filepath.Base(name)+".bak."
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, entry := range dirEntries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > retain {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
 // Search finds hosts matching the pattern in the list.
 //
 // This function performs fuzzy matching on the host identifier only.
 //
 // Parameter Format:
 //
-//	Input: Hostname or IP address (partial match supported)
-//	Example: "github", "192.168", "git"
+//	Input: A query (see ParseQuery), usually a hostname or IP address
+//	Example: "github", "192.168", "type:ed25519 host:*.corp"
 //
 // Matching Behavior:
-//   - Searches only in the host part (first space-delimited field)
+//   - Plain words search only in the host part (first space-delimited field)
 //   - Uses substring matching (contains, not exact)
-//   - Case-sensitive
+//   - Case-insensitive
+//   - field:value terms match key types, fingerprints, ports and markers
+//   - Invalid queries match nothing
 //   - Returns complete host lines for all matches
 //
 // Examples:
@@ -122,22 +250,12 @@ func SaveFile(input []string) error {
 // - Exact match would defeat the purpose of search
 // - TUI search bar uses this for filtering as you type
 func Search(input []string, pattern string) []string {
-	var out []string
-
-	for _, v := range input {
-		// Split by whitespace to extract host part
-		// Format: [name,]ip keytype publickey
-		parts := strings.Fields(v)
-		if len(parts) > 0 {
-			hostPart := parts[0]
-			// Only match in the host part (name or IP)
-			if strings.Contains(hostPart, pattern) {
-				out = append(out, v)
-			}
-		}
+	q, err := ParseQuery(pattern)
+	if err != nil {
+		return nil
 	}
 
-	return out
+	return q.Filter(input, nil)
 }
 
 func deleteMatches(input []string, pattern string) (remaining []string, removed []string) {
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -239,6 +240,9 @@ func TestSearch(t *testing.T) {
 		{"host with comma", args{[]string{"myserver,192.168.1.1 ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC"}, "myserver"}, []string{"myserver,192.168.1.1 ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC"}},
 		{"ip search", args{[]string{"myserver,192.168.1.1 ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC"}, "192.168.1.1"}, []string{"myserver,192.168.1.1 ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC"}},
 		{"partial ip match", args{[]string{"myserver,192.168.1.1 ssh-rsa key"}, "192.168"}, []string{"myserver,192.168.1.1 ssh-rsa key"}},
+		{"case insensitive", args{[]string{"GitHub.com ssh-rsa key", "gitlab.com ssh-rsa key"}, "GITHUB"}, []string{"GitHub.com ssh-rsa key"}},
+		{"query", args{[]string{"github.com ssh-rsa key", "gitlab.com ssh-ed25519 key"}, "git type:ed25519"}, []string{"gitlab.com ssh-ed25519 key"}},
+		{"invalid query", args{[]string{"github.com ssh-rsa key"}, "port:"}, []string{}},
 	}
 
 	for _, test := range tests {
@@ -376,3 +380,151 @@ func slicesEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestGetFilePath_Configured(t *testing.T) {
+	c := defaultConfig()
+	c.Files = []string{"/etc/ssh/ssh_known_hosts", "/tmp/other"}
+	setConfig(t, c)
+
+	got, err := GetFilePath()
+	if err != nil {
+		t.Fatalf("GetFilePath() error = %v", err)
+	}
+	if got != "/etc/ssh/ssh_known_hosts" {
+		t.Errorf("GetFilePath() = %q, want first configured file", got)
+	}
+}
+
+func TestSaveFile_Backups(t *testing.T) {
+	tmpDir := t.TempDir()
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0755); err != nil {
+		t.Fatalf("Failed to create .ssh directory: %v", err)
+	}
+
+	restoreHome := setHomeDir(t, tmpDir)
+	defer restoreHome()
+
+	c := defaultConfig()
+	c.Backup.Retain = 2
+	setConfig(t, c)
+
+	// The first save has nothing to back up
+	for _, host := range []string{"a", "b", "c", "d"} {
+		if err := SaveFile([]string{host + " ssh-rsa key"}); err != nil {
+			t.Fatalf("SaveFile() error = %v", err)
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(sshDir, "known_hosts.bak.*"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("SaveFile() kept %d backups, want 2: %v", len(backups), backups)
+	}
+
+	// Only the newest backups are retained
+	newest, err := os.ReadFile(backups[1])
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if !strings.Contains(string(newest), "c ssh-rsa key") {
+		t.Errorf("newest backup = %q, want previous content", newest)
+	}
+}
+
+func TestBackupFile_GlobCharacters(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "[hosts]")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	name := filepath.Join(dir, "known_hosts[1]")
+	writeTestFile(t, name, "a ssh-rsa key\n")
+	// Another file's backups are never pruned
+	other := filepath.Join(dir, "known_hosts1.bak.20000101T000000.000000000")
+	writeTestFile(t, other, "")
+
+	for range 3 {
+		if err := backupFile(name, 1); err != nil {
+			t.Fatalf("backupFile() error = %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var backups []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "known_hosts[1].bak.") {
+			backups = append(backups, e.Name())
+		}
+	}
+	if len(backups) != 1 {
+		t.Errorf("backupFile() kept %v, want 1 backup", backups)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("backupFile() removed another file's backup: %v", err)
+	}
+}
+
+func TestSaveFile_NoBackupsByDefault(t *testing.T) {
+	tmpDir := t.TempDir()
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0755); err != nil {
+		t.Fatalf("Failed to create .ssh directory: %v", err)
+	}
+
+	restoreHome := setHomeDir(t, tmpDir)
+	defer restoreHome()
+
+	for range 2 {
+		if err := SaveFile([]string{"a ssh-rsa key"}); err != nil {
+			t.Fatalf("SaveFile() error = %v", err)
+		}
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(sshDir, "known_hosts.bak.*"))
+	if len(backups) != 0 {
+		t.Errorf("SaveFile() wrote backups %v with retention disabled", backups)
+	}
+}
+
+func TestReadAllFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "known_hosts")
+	second := filepath.Join(dir, "team_known_hosts")
+
+	if err := os.WriteFile(first, []byte("a ssh-rsa key1\r\n\r\nb ssh-rsa key2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(second, []byte("\nc ssh-rsa key3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	c := defaultConfig()
+	c.Files = []string{first, filepath.Join(dir, "missing"), second}
+	setConfig(t, c)
+
+	got, err := ReadAllFiles()
+	if err != nil {
+		t.Fatalf("ReadAllFiles() error = %v", err)
+	}
+
+	want := []sourceLine{
+		{Text: "a ssh-rsa key1", Source: first, Line: 1},
+		{Text: "b ssh-rsa key2", Source: first, Line: 3},
+		{Text: "c ssh-rsa key3", Source: second, Line: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadAllFiles() = %v, want %v", got, want)
+	}
+
+	// The first file is required
+	c.Files = []string{filepath.Join(dir, "missing"), first}
+	setConfig(t, c)
+	if _, err := ReadAllFiles(); err == nil {
+		t.Error("ReadAllFiles() should fail when the first file is missing")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"slices"
+	"unicode"
+)
+
+// Fuzzy match scores, loosely following fzf: every matched character
+// scores, characters right after a separator or after the previous match
+// score more and gaps between matches cost a little.
+const (
+	fuzzyScoreMatch       = 16
+	fuzzyBonusBoundary    = 8
+	fuzzyBonusConsecutive = 8
+	fuzzyPenaltyGapStart  = 3
+	fuzzyPenaltyGapExtend = 1
+)
+
+// fuzzyMatch matches the characters of pattern in order, ignoring case,
+// anywhere in text. It returns the score of the match and the rune
+// positions of the matched characters in text.
+func fuzzyMatch(pattern, text string) (score int, positions []int, ok bool) {
+	p := []rune(pattern)
+	for i, r := range p {
+		p[i] = unicode.ToLower(r)
+	}
+	t := []rune(text)
+	for i, r := range t {
+		t[i] = unicode.ToLower(r)
+	}
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+
+	// Find where the first occurrence of pattern ends
+	pi, end := 0, -1
+	for i, r := range t {
+		if r == p[pi] {
+			pi++
+			if pi == len(p) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// Walk back from there to the shortest match ending at end
+	positions = make([]int, len(p))
+	pi = len(p) - 1
+	for i := end; i >= 0; i-- {
+		if t[i] != p[pi] {
+			continue
+		}
+		positions[pi] = i
+		if pi == 0 {
+			break
+		}
+		pi--
+	}
+
+	for k, i := range positions {
+		score += fuzzyScoreMatch
+		if i == 0 || isFuzzyBoundary(t[i-1]) {
+			score += fuzzyBonusBoundary
+		}
+		if k == 0 {
+			continue
+		}
+		if gap := i - positions[k-1] - 1; gap == 0 {
+			score += fuzzyBonusConsecutive
+		} else {
+			score -= fuzzyPenaltyGapStart + (gap-1)*fuzzyPenaltyGapExtend
+		}
+	}
+
+	return score, positions, true
+}
+
+// isFuzzyBoundary reports whether r separates the words of a host line
+func isFuzzyBoundary(r rune) bool {
+	switch r {
+	case '.', ',', '-', '_', ':', '[', ']', '@', '/', ' ':
+		return true
+	}
+
+	return false
+}
+
+// fuzzyResult is a line selected by fuzzyRank
+type fuzzyResult struct {
+	Line      string
+	Score     int
+	Positions []int // Matched rune positions in the text of the line
+}
+
+// fuzzyRank returns the lines matching q, best first. The plain words of
+// q are matched fuzzily against text(line), every other term has to
+// match exactly as in Query.Match. Lines with the same score keep their
+// order.
+func fuzzyRank(q Query, lines []string, meta metaStore, text func(line string) string) []fuzzyResult {
+	rest, words := q.splitWords()
+
+	var results []fuzzyResult
+	for _, line := range lines {
+		if !rest.Match(line, meta) {
+			continue
+		}
+
+		r := fuzzyResult{Line: line}
+		s := text(line)
+		matched := true
+		for _, w := range words {
+			score, positions, ok := fuzzyMatch(w, s)
+			if !ok {
+				matched = false
+				break
+			}
+			r.Score += score
+			r.Positions = append(r.Positions, positions...)
+		}
+		if !matched {
+			continue
+		}
+
+		slices.Sort(r.Positions)
+		r.Positions = slices.Compact(r.Positions)
+		results = append(results, r)
+	}
+
+	slices.SortStableFunc(results, func(a, b fuzzyResult) int {
+		return b.Score - a.Score
+	})
+
+	return results
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		text      string
+		wantOK    bool
+		positions []int
+	}{
+		{pattern: "", text: "github.com", wantOK: true},
+		{pattern: "ghc", text: "github.com", wantOK: true, positions: []int{0, 3, 7}},
+		{pattern: "GHC", text: "github.com", wantOK: true, positions: []int{0, 3, 7}},
+		{pattern: "db1", text: "db-old.corp, db1.corp", wantOK: true, positions: []int{13, 14, 15}},
+		{pattern: "1921", text: "web, 192.168.1.1", wantOK: true, positions: []int{5, 6, 7, 9}},
+		{pattern: "cg", text: "github.com", wantOK: false},
+		{pattern: "xyz", text: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" in "+tt.text, func(t *testing.T) {
+			_, positions, ok := fuzzyMatch(tt.pattern, tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("fuzzyMatch() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(positions, tt.positions) {
+				t.Errorf("fuzzyMatch() positions = %v, want %v", positions, tt.positions)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatchScore(t *testing.T) {
+	score := func(pattern, text string) int {
+		s, _, ok := fuzzyMatch(pattern, text)
+		if !ok {
+			t.Fatalf("fuzzyMatch(%q, %q) didn't match", pattern, text)
+		}
+		return s
+	}
+
+	if score("git", "github.com") <= score("git", "legit.example") {
+		t.Error("a match at the start should beat one inside a word")
+	}
+	if score("db", "db.corp") <= score("db", "dev-box.corp") {
+		t.Error("consecutive characters should beat scattered ones")
+	}
+	if score("lab", "web.lab.corp") <= score("lab", "slab.corp") {
+		t.Error("a match after a separator should beat one inside a word")
+	}
+}
+
+func TestFuzzyRank(t *testing.T) {
+	lines := []string{
+		"legit.example ssh-rsa key1",
+		"github.com ssh-ed25519 key2",
+		"gitlab.com ssh-rsa key3",
+		"bastion ssh-rsa key4 git server",
+		"unrelated.org ssh-rsa key5",
+	}
+	text := func(line string) string {
+		e, _ := ParseEntry(line)
+		return strings.Join(e.Patterns, ",") + "  " + e.Comment
+	}
+
+	q, _ := ParseQuery("git")
+	var got []string
+	for _, r := range fuzzyRank(q, lines, nil, text) {
+		got = append(got, r.Line)
+	}
+	want := []string{lines[1], lines[2], lines[3], lines[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fuzzyRank() = %q, want %q", got, want)
+	}
+
+	// Field terms and negated words still filter exactly
+	q, _ = ParseQuery("git type:rsa -legit")
+	results := fuzzyRank(q, lines, nil, text)
+	if len(results) != 2 || results[0].Line != lines[2] || results[1].Line != lines[3] {
+		t.Errorf("fuzzyRank() with terms = %+v", results)
+	}
+	if !reflect.DeepEqual(results[0].Positions, []int{0, 1, 2}) {
+		t.Errorf("positions = %v, want [0 1 2]", results[0].Positions)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	old := matchStyle
+	t.Cleanup(func() { matchStyle = old })
+	matchStyle = lipgloss.NewStyle().Transform(strings.ToUpper)
+
+	if got := highlight("github.com", []int{3, 4, 9}, lipgloss.NewStyle()); got != "gitHUb.coM" {
+		t.Errorf("highlight() = %q, want %q", got, "gitHUb.coM")
+	}
+
+	// Characters cut by the terminal width, and the ellipsis, aren't highlighted
+	line := "github.com ssh-rsa key"
+	m := Model{highlights: map[string][]int{line: {0, 7, 9}}}
+	got, err := m.renderEntry(line, lipgloss.NewStyle(), 8)
+	if err != nil || got != "Github.…" {
+		t.Errorf("renderEntry() = %q, %v, want %q", got, err, "Github.…")
+	}
+}
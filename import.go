@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readInput reads name, or stdin when name is "-"
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(name)
+}
+
+// importEntries merges entries into hosts and saves the result unless
+// dryRun is set. Added entries are recorded in the metadata as coming from
+// origin. It returns the merge report for printing.
+func importEntries(hosts []string, entries []Entry, origin string, dryRun bool) (mergeReport, error) {
+	return addEntries(hosts, entries, origin, cfg.Hash == hashAlways, dryRun)
+}
+
+// addEntries is importEntries with an explicit hashing choice
+func addEntries(hosts []string, entries []Entry, origin string, hash, dryRun bool) (mergeReport, error) {
+	merged, report, err := mergeEntries(hosts, entries, hash)
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun || len(report.Added) == 0 {
+		return report, nil
+	}
+
+	if err := SaveFile(merged); err != nil {
+		return report, fmt.Errorf("failed to save known_hosts: %w", err)
+	}
+	if err := syncMeta(hosts, merged, origin, nil); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+func runImport(hosts []string, opt importOpts) {
+	data, err := verifyInput(opt.file, opt.sig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var entries []Entry
+	if opt.from == sourcePutty {
+		var skips []puttySkip
+		entries, skips, err = ParsePuttyReg(data)
+		for _, s := range skips {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", s.Name, s.Reason)
+		}
+	} else {
+		entries, err = parseRecords(data, opt.format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	origin := cmdImport
+	if opt.file != "-" {
+		origin += " " + filepath.Base(opt.file)
+	}
+	report, err := importEntries(hosts, entries, origin, opt.dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printMergeReport(os.Stdout, report, opt.dryRun)
+	if len(report.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseRecords reads json or csv records in the shape written by ls
+// --format and validates every one of them. Nothing is returned unless all
+// records are valid, so a bad inventory never gets half imported.
+func parseRecords(data []byte, format string) ([]Entry, error) {
+	var (
+		records []Record
+		err     error
+	)
+	if format == formatJSON {
+		err = json.Unmarshal(data, &records)
+	} else {
+		records, err = parseCSVRecords(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s records: %w", format, err)
+	}
+
+	var (
+		entries []Entry
+		errs    []error
+	)
+	for i, r := range records {
+		e, err := recordToEntry(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %w", i+1, err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return entries, nil
+}
+
+// parseCSVRecords reads csv with a header row naming the Record columns.
+// Columns may come in any order, unknown columns are ignored.
+func parseCSVRecords(data []byte) ([]Record, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"patterns", "key_type", "key"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	records := make([]Record, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		r := Record{
+			Marker:      field(row, "marker"),
+			KeyType:     field(row, "key_type"),
+			Key:         field(row, "key"),
+			Fingerprint: field(row, "fingerprint"),
+			Comment:     field(row, "comment"),
+		}
+		if p := field(row, "patterns"); p != "" {
+			r.Patterns = strings.Split(p, ",")
+		}
+		if p := field(row, "port"); p != "" {
+			if r.Port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("row %d: invalid port %q", i+2, p)
+			}
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// recordToEntry validates r and converts it to an entry. A port other than
+// 22 is applied to the patterns only when none of them carries its own
+// [host]:port, so entries mixing ports keep them as written.
+func recordToEntry(r Record) (Entry, error) {
+	if r.Marker != "" && r.Marker != markerCertAuthority && r.Marker != markerRevoked {
+		return Entry{}, fmt.Errorf("unknown marker %q", r.Marker)
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return Entry{}, fmt.Errorf("invalid port %d", r.Port)
+	}
+	if len(r.Patterns) == 0 {
+		return Entry{}, fmt.Errorf("patterns cannot be empty")
+	}
+
+	e := Entry{Marker: r.Marker, KeyType: r.KeyType, Key: r.Key, Comment: r.Comment}
+	applyPort := true
+	for _, p := range r.Patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") || strings.ContainsAny(p, " \t,") || validateHost(p) != nil {
+			return Entry{}, fmt.Errorf("invalid pattern %q", p)
+		}
+		if strings.HasPrefix(p, "[") {
+			applyPort = false
+		}
+		e.Patterns = append(e.Patterns, p)
+	}
+	if applyPort {
+		for i, p := range e.Patterns {
+			if !strings.HasPrefix(p, hashPrefix) {
+				e.Patterns[i] = hostPattern(p, r.Port)
+			}
+		}
+	}
+
+	if err := validateKey(r.KeyType, r.Key); err != nil {
+		return Entry{}, err
+	}
+	if r.Fingerprint != "" && r.Fingerprint != e.Fingerprint() {
+		return Entry{}, fmt.Errorf("fingerprint %s doesn't match the key", r.Fingerprint)
+	}
+	if strings.ContainsAny(r.Comment, "\r\n") {
+		return Entry{}, fmt.Errorf("comment cannot contain newline characters")
+	}
+
+	return e, nil
+}
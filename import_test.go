@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0755); err != nil {
+		t.Fatalf("Failed to create .ssh directory: %v", err)
+	}
+
+	restoreHome := setHomeDir(t, tmpDir)
+	defer restoreHome()
+
+	keyType, key := testPublicKey(t)
+	hosts := []string{"github.com " + keyType + " " + key}
+	if err := SaveFile(hosts); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	entries := []Entry{{Patterns: []string{"[gitlab.com]:2222"}, KeyType: keyType, Key: key}}
+
+	t.Run("dry run leaves the file alone", func(t *testing.T) {
+		report, err := importEntries(hosts, entries, cmdImport, true)
+		if err != nil {
+			t.Fatalf("importEntries() error = %v", err)
+		}
+		if len(report.Added) != 1 {
+			t.Errorf("importEntries() added %d, want 1", len(report.Added))
+		}
+
+		got, _ := ReadFile()
+		if len(got) != 1 {
+			t.Errorf("dry run wrote the file: %v", got)
+		}
+	})
+
+	t.Run("import writes new entries", func(t *testing.T) {
+		if _, err := importEntries(hosts, entries, cmdImport, false); err != nil {
+			t.Fatalf("importEntries() error = %v", err)
+		}
+
+		got, _ := ReadFile()
+		if len(got) != 2 || got[1] != "[gitlab.com]:2222 "+keyType+" "+key {
+			t.Errorf("known_hosts = %v, want imported entry appended", got)
+		}
+	})
+
+	t.Run("hash policy always", func(t *testing.T) {
+		setConfig(t, Config{Files: []string{filepath.Join(tmpDir, "hashed_known_hosts")}, Hash: hashAlways})
+
+		if _, err := importEntries(nil, entries, cmdImport, false); err != nil {
+			t.Fatalf("importEntries() error = %v", err)
+		}
+
+		got, _ := ReadFile()
+		if len(got) != 1 {
+			t.Fatalf("known_hosts = %v, want one entry", got)
+		}
+		e, err := ParseEntry(got[0])
+		if err != nil || !e.Hashed() || !hashMatches(e.Patterns[0], "[gitlab.com]:2222") {
+			t.Errorf("known_hosts = %v, want the imported host hashed", got)
+		}
+	})
+}
+
+func TestParseRecords(t *testing.T) {
+	keyType, key := testPublicKey(t)
+	fp := Entry{Key: key}.Fingerprint()
+
+	t.Run("json written by ls", func(t *testing.T) {
+		lines := []sourceLine{
+			{Text: "github.com,10.0.0.1 " + keyType + " " + key + " a comment", Source: "kh", Line: 1},
+			{Text: "@revoked [old.example.com]:2222 " + keyType + " " + key, Source: "kh", Line: 2},
+		}
+		var buf bytes.Buffer
+		if err := writeRecords(&buf, newRecords(lines, &buf), formatJSON, ""); err != nil {
+			t.Fatalf("writeRecords() error = %v", err)
+		}
+
+		got, err := parseRecords(buf.Bytes(), formatJSON)
+		if err != nil {
+			t.Fatalf("parseRecords() error = %v", err)
+		}
+		if len(got) != 2 || got[0].String() != lines[0].Text || got[1].String() != lines[1].Text {
+			t.Errorf("parseRecords() = %v, want the original lines", got)
+		}
+	})
+
+	t.Run("mixed ports round trip", func(t *testing.T) {
+		lines := []sourceLine{
+			{Text: "[a.example]:2222,b.example " + keyType + " " + key, Source: "kh", Line: 1},
+			{Text: "a.example,[b.example]:2222 " + keyType + " " + key, Source: "kh", Line: 2},
+		}
+
+		for _, format := range []string{formatJSON, formatCSV} {
+			var buf bytes.Buffer
+			if err := writeRecords(&buf, newRecords(lines, &buf), format, ""); err != nil {
+				t.Fatalf("writeRecords(%s) error = %v", format, err)
+			}
+
+			got, err := parseRecords(buf.Bytes(), format)
+			if err != nil {
+				t.Fatalf("parseRecords(%s) error = %v", format, err)
+			}
+			if len(got) != 2 || got[0].String() != lines[0].Text || got[1].String() != lines[1].Text {
+				t.Errorf("parseRecords(%s) = %v, want the original lines", format, got)
+			}
+		}
+
+		// A port given alongside a bracketed pattern isn't applied to the others
+		data := `[{"patterns":["[a.example]:2222","b.example"],"port":2222,"key_type":"` + keyType + `","key":"` + key + `"}]`
+		got, err := parseRecords([]byte(data), formatJSON)
+		if err != nil {
+			t.Fatalf("parseRecords() error = %v", err)
+		}
+		if want := "[a.example]:2222,b.example " + keyType + " " + key; len(got) != 1 || got[0].String() != want {
+			t.Errorf("parseRecords() = %v, want %q", got, want)
+		}
+	})
+
+	t.Run("csv with port and reordered columns", func(t *testing.T) {
+		data := "key,key_type,patterns,port,fingerprint\n" +
+			key + "," + keyType + ",\"db1,10.0.0.2\",2222," + fp + "\n" +
+			key + "," + keyType + ",db2,,\n"
+
+		got, err := parseRecords([]byte(data), formatCSV)
+		if err != nil {
+			t.Fatalf("parseRecords() error = %v", err)
+		}
+
+		want := []string{
+			"[db1]:2222,[10.0.0.2]:2222 " + keyType + " " + key,
+			"db2 " + keyType + " " + key,
+		}
+		if len(got) != len(want) {
+			t.Fatalf("parseRecords() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i].String() != want[i] {
+				t.Errorf("record %d = %q, want %q", i, got[i], want[i])
+			}
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		format  string
+		data    string
+		wantErr string
+	}{
+		{"invalid json", formatJSON, "{", "failed to parse json"},
+		{"missing csv column", formatCSV, "patterns,key\nhost,AAAA\n", "missing key_type column"},
+		{"bad key", formatJSON, `[{"patterns":["h"],"key_type":"ssh-ed25519","key":"AAAA"}]`, "record 1"},
+		{"type mismatch", formatJSON, `[{"patterns":["h"],"key_type":"ssh-rsa","key":"` + key + `"}]`, "key type mismatch"},
+		{"no patterns", formatJSON, `[{"key_type":"` + keyType + `","key":"` + key + `"}]`, "patterns cannot be empty"},
+		{"bad pattern", formatJSON, `[{"patterns":["a b"],"key_type":"` + keyType + `","key":"` + key + `"}]`, "invalid pattern"},
+		{"bad marker", formatJSON, `[{"marker":"@trust","patterns":["h"],"key_type":"` + keyType + `","key":"` + key + `"}]`, "unknown marker"},
+		{"fingerprint mismatch", formatJSON, `[{"patterns":["h"],"key_type":"` + keyType + `","key":"` + key + `","fingerprint":"SHA256:x"}]`, "doesn't match"},
+		{"bad csv port", formatCSV, "patterns,key_type,key,port\nh," + keyType + "," + key + ",x\n", "invalid port"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecords([]byte(tt.data), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseRecords() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != nil {
+				t.Errorf("parseRecords() should return nothing on error, got %v", got)
+			}
+		})
+	}
+}
@@ -6,17 +6,88 @@ Aimming to support Windows/Linux/macOS.
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 type opts struct {
-	operation string
-	host      string
-	dryRun    bool
+	operation  string
+	host       string
+	hosts      []string
+	dryRun     bool
+	configPath string
+	files      []string
+	imp        importOpts
+	exportTo   string
+	format     string
+	template   string
+	sync       syncOpts
+	merge      mergeOpts
+	diff       diffOpts
+	verify     verifyOpts
+	verifyDNS  verifyDNSOpts
+	scan       scanOpts
+	check      scanOpts
+	update     updateOpts
+	add        addOpts
+	remove     removeOpts
+	stale      staleOpts
+	meta       metaOpts
+	stats      statsOpts
+	tag        string
+
+	// authorizedKeys switches ls, search, rm and tui to authorized_keys
+	authorizedKeys bool
+}
+
+// outputOpts are the output flags of ls and search
+type outputOpts struct {
+	format   string
+	template string
+	tag      string
+}
+
+type diffOpts struct {
+	a      string
+	b      string
+	format string
+}
+
+type mergeOpts struct {
+	base   string
+	ours   string
+	theirs string
+	output string
+}
+
+type syncOpts struct {
+	from   string
+	label  string
+	prune  bool
+	dryRun bool
+	sig    sigOpts
+}
+
+type verifyOpts struct {
+	file string
+	sig  sigOpts
+}
+
+type importOpts struct {
+	from   string
+	format string
+	file   string
+	dryRun bool
+	sig    sigOpts
 }
 
 const (
@@ -25,6 +96,31 @@ const (
 	cmdHelp   = "help"
 	cmdSearch = "search"
 	cmdTUI    = "tui"
+	cmdConfig = "config"
+	cmdImport = "import"
+	cmdExport = "export"
+	cmdSync   = "sync"
+	cmdMerge  = "merge"
+	cmdDiff   = "diff"
+
+	cmdVerifySignature = "verify-signature"
+	cmdSSHFP           = "sshfp"
+	cmdVerifyDNS       = "verify-dns"
+	cmdScan            = "scan"
+	cmdCheck           = "check"
+	cmdUpdate          = "update"
+	cmdAdd             = "add"
+	cmdStale           = "stale"
+	cmdMeta            = "meta"
+	cmdStats           = "stats"
+)
+
+const sourcePutty = "putty"
+
+const (
+	flagConfig         = "--config"
+	flagFile           = "--file"
+	flagAuthorizedKeys = "--authorized-keys"
 )
 
 // validateHost validates host parameter
@@ -41,14 +137,15 @@ func validateHost(host string) error {
 	return nil
 }
 
-func checkArgs(num int) {
-	if len(os.Args) != num {
+func checkArgs(args []string, num int) {
+	if len(args) != num {
 		fmt.Println("Invalid parameter")
 		printUsage()
 		os.Exit(1)
 	}
 }
 
+// parseRemoveArgs parses the plain rm host [--dry-run] form
 func parseRemoveArgs(args []string) (host string, dryRun bool, err error) {
 	if len(args) < 1 || len(args) > 2 {
 		return "", false, fmt.Errorf("rm requires a host and supports optional --dry-run")
@@ -76,36 +173,851 @@ func parseRemoveArgs(args []string) (host string, dryRun bool, err error) {
 	return host, dryRun, nil
 }
 
+// isPlainRemove reports whether args are a single host with an optional
+// --dry-run, the form handled by parseRemoveArgs
+func isPlainRemove(args []string) bool {
+	if len(args) > 2 {
+		return false
+	}
+
+	hosts := 0
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			return false
+		}
+		hosts++
+	}
+
+	return hosts <= 1
+}
+
+// parseRemoveOpts parses the arguments of rm. The plain form keeps the
+// checks of parseRemoveArgs.
+func parseRemoveOpts(args []string) (opt removeOpts, err error) {
+	if isPlainRemove(args) {
+		host, dryRun, err := parseRemoveArgs(args)
+		if err != nil {
+			return removeOpts{}, err
+		}
+		return removeOpts{hosts: []string{host}, dryRun: dryRun}, nil
+	}
+
+	dryRuns := 0
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--dry-run" || arg == "-dry-run" {
+			dryRuns++
+		}
+	}
+	if dryRuns > 1 {
+		return opt, fmt.Errorf("duplicate --dry-run flag")
+	}
+
+	fs := flag.NewFlagSet(cmdRemove, flag.ContinueOnError)
+	fs.StringVar(&opt.fromFile, "from-file", "", "file listing one host per line")
+	fs.BoolVar(&opt.stdin, "stdin", false, "read one host per line from stdin")
+	fs.BoolVar(&opt.glob, "glob", false, "match hosts against * and ? wildcards")
+	fs.BoolVar(&opt.regex, "regex", false, "match hosts against regular expressions")
+	fs.StringVar(&opt.cidr, "cidr", "", "remove the addresses in a CIDR range")
+	fs.StringVar(&opt.query, "query", "", "remove the entries matching a search query")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only report what would be removed")
+	fs.BoolVar(&opt.yes, "yes", false, "don't ask before a glob, regex or query removes several entries")
+
+	if opt.hosts, err = parseFlags(fs, args); err != nil {
+		return opt, err
+	}
+
+	if opt.glob && opt.regex {
+		return opt, fmt.Errorf("--glob and --regex are mutually exclusive")
+	}
+	if opt.fromFile != "" && opt.stdin {
+		return opt, fmt.Errorf("--from-file and --stdin are mutually exclusive")
+	}
+	if opt.cidr != "" && opt.query != "" {
+		return opt, fmt.Errorf("--cidr and --query are mutually exclusive")
+	}
+	if opt.cidr != "" {
+		if len(opt.hosts) > 0 || opt.fromFile != "" || opt.stdin || opt.glob || opt.regex {
+			return opt, fmt.Errorf("--cidr doesn't take hosts or other match options")
+		}
+		if _, err := netip.ParsePrefix(opt.cidr); err != nil {
+			return opt, fmt.Errorf("invalid CIDR %q: %w", opt.cidr, err)
+		}
+		return opt, nil
+	}
+	if opt.query != "" {
+		if len(opt.hosts) > 0 || opt.fromFile != "" || opt.stdin || opt.glob || opt.regex {
+			return opt, fmt.Errorf("--query doesn't take hosts or other match options")
+		}
+		q, err := ParseQuery(opt.query)
+		if err != nil {
+			return opt, fmt.Errorf("invalid query: %w", err)
+		}
+		if q.Empty() {
+			return opt, fmt.Errorf("--query cannot be empty")
+		}
+		return opt, nil
+	}
+	if len(opt.hosts) == 0 && opt.fromFile == "" && !opt.stdin {
+		return opt, fmt.Errorf("rm requires a host, --from-file, --stdin, --cidr or --query")
+	}
+	for _, h := range opt.hosts {
+		if err := validateHost(h); err != nil {
+			return opt, err
+		}
+	}
+
+	return opt, nil
+}
+
+// parseFlags parses fs from args, also accepting flags after positional
+// arguments, and returns the positional arguments. Everything after --
+// is positional, such as negated query terms like -tag:lab.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		args = rest
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func parseImportArgs(args []string) (opt importOpts, err error) {
+	fs := flag.NewFlagSet(cmdImport, flag.ContinueOnError)
+	fs.StringVar(&opt.from, "from", "", "source application")
+	fs.StringVar(&opt.format, "format", "", "record format")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only report what would change")
+	addRequireSignatureFlags(fs, &opt.sig)
+
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+
+	switch {
+	case opt.from != "" && opt.format != "":
+		return opt, fmt.Errorf("import accepts either --from or --format")
+	case opt.from == "" && opt.format == "":
+		return opt, fmt.Errorf("import requires --from %s or --format %s|%s", sourcePutty, formatJSON, formatCSV)
+	case opt.from != "" && opt.from != sourcePutty:
+		return opt, fmt.Errorf("unsupported import source %q", opt.from)
+	case opt.format != "" && opt.format != formatJSON && opt.format != formatCSV:
+		return opt, fmt.Errorf("unsupported import format %q", opt.format)
+	}
+	if len(files) != 1 {
+		return opt, fmt.Errorf("import requires exactly one file (use - for stdin)")
+	}
+	opt.file = files[0]
+
+	return opt, nil
+}
+
+// parseOutputArgs parses the output flags of ls and search and returns the
+// positional arguments
+func parseOutputArgs(name string, args []string) (rest []string, out outputOpts, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&out.format, "format", "", "output format")
+	fs.StringVar(&out.template, "template", "", "text/template for --format template")
+	fs.StringVar(&out.tag, "tag", "", "only entries with this tag")
+
+	rest, err = parseFlags(fs, args)
+	if err != nil {
+		return nil, out, err
+	}
+
+	if out.format != "" && !slices.Contains(supportedFormats, out.format) {
+		return nil, out, fmt.Errorf("unsupported format %q (want one of %s)", out.format, strings.Join(supportedFormats, ", "))
+	}
+	if out.template != "" && out.format == "" {
+		out.format = formatTemplate
+	}
+	if out.tag != "" {
+		if err := validateTag(out.tag); err != nil {
+			return nil, out, err
+		}
+	}
+
+	return rest, out, nil
+}
+
+func parseTUIArgs(args []string) (tag string, err error) {
+	fs := flag.NewFlagSet(cmdTUI, flag.ContinueOnError)
+	fs.StringVar(&tag, "tag", "", "only entries with this tag")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) > 0 {
+		return "", fmt.Errorf("tui doesn't take arguments")
+	}
+	if tag != "" {
+		if err := validateTag(tag); err != nil {
+			return "", err
+		}
+	}
+
+	return tag, nil
+}
+
+func parseMetaArgs(args []string) (opt metaOpts, err error) {
+	var tags, untags string
+	fs := flag.NewFlagSet(cmdMeta, flag.ContinueOnError)
+	fs.StringVar(&tags, "tag", "", "comma separated tags to add")
+	fs.StringVar(&untags, "untag", "", "comma separated tags to remove")
+	fs.StringVar(&opt.note, "note", "", "free text note")
+	fs.BoolVar(&opt.clearNote, "clear-note", false, "remove the note")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+	if len(rest) != 1 {
+		return opt, fmt.Errorf("meta requires exactly one host")
+	}
+	if err := validateHost(rest[0]); err != nil {
+		return opt, err
+	}
+	opt.host = rest[0]
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "note" {
+			opt.setNote = true
+		}
+	})
+	if opt.setNote && opt.clearNote {
+		return opt, fmt.Errorf("--note and --clear-note are mutually exclusive")
+	}
+	if strings.ContainsAny(opt.note, "\t\r\n") {
+		return opt, fmt.Errorf("note cannot contain tabs or newlines")
+	}
+
+	for _, list := range []struct {
+		value string
+		dst   *[]string
+	}{{tags, &opt.tags}, {untags, &opt.untags}} {
+		if list.value == "" {
+			continue
+		}
+		for _, t := range strings.Split(list.value, ",") {
+			if err := validateTag(t); err != nil {
+				return opt, err
+			}
+			*list.dst = append(*list.dst, t)
+		}
+	}
+
+	return opt, nil
+}
+
+func parseExportArgs(args []string) (to string, err error) {
+	fs := flag.NewFlagSet(cmdExport, flag.ContinueOnError)
+	fs.StringVar(&to, "to", "", "target format")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return "", err
+	}
+
+	if to != sourcePutty {
+		return "", fmt.Errorf("export requires --to %s", sourcePutty)
+	}
+	if len(rest) > 0 {
+		return "", fmt.Errorf("export doesn't take arguments")
+	}
+
+	return to, nil
+}
+
+func parseSyncArgs(args []string) (opt syncOpts, err error) {
+	fs := flag.NewFlagSet(cmdSync, flag.ContinueOnError)
+	fs.StringVar(&opt.from, "from", "", "team known_hosts file")
+	fs.StringVar(&opt.label, "label", "", "origin label, defaults to the team file name")
+	fs.BoolVar(&opt.prune, "prune", false, "remove entries the team file dropped or revoked")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only report what would change")
+	addRequireSignatureFlags(fs, &opt.sig)
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+
+	if opt.from == "" {
+		return opt, fmt.Errorf("sync requires --from team_known_hosts")
+	}
+	if len(rest) > 0 {
+		return opt, fmt.Errorf("sync doesn't take arguments")
+	}
+	if opt.label == "" {
+		opt.label = filepath.Base(opt.from)
+	}
+	if strings.ContainsAny(opt.label, " \t\r\n") {
+		return opt, fmt.Errorf("label %q cannot contain whitespace, pass --label", opt.label)
+	}
+
+	return opt, nil
+}
+
+// addRequireSignatureFlags registers the signature flags of the commands
+// that import a file
+func addRequireSignatureFlags(fs *flag.FlagSet, opt *sigOpts) {
+	fs.BoolVar(&opt.require, "require-signature", false, "refuse input without a valid signature")
+	fs.StringVar(&opt.signature, "signature", "", "signature file, defaults to the input file with .sig appended")
+	addSignatureFlags(fs, opt)
+}
+
+func parseVerifySignatureArgs(args []string) (opt verifyOpts, err error) {
+	fs := flag.NewFlagSet(cmdVerifySignature, flag.ContinueOnError)
+	addSignatureFlags(fs, &opt.sig)
+
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+	if len(files) != 2 {
+		return opt, fmt.Errorf("verify-signature requires a file and its signature file")
+	}
+	opt.file, opt.sig.signature = files[0], files[1]
+	opt.sig.require = true
+
+	return opt, nil
+}
+
+func parseVerifyDNSArgs(args []string) (opt verifyDNSOpts, err error) {
+	fs := flag.NewFlagSet(cmdVerifyDNS, flag.ContinueOnError)
+	fs.StringVar(&opt.resolver, "resolver", "", "DNS server as host[:port]")
+	fs.DurationVar(&opt.timeout, "timeout", defaultDNSTimeout, "timeout of each DNS query")
+
+	if opt.hosts, err = parseFlags(fs, args); err != nil {
+		return opt, err
+	}
+	for _, h := range opt.hosts {
+		if err := validateHost(h); err != nil {
+			return opt, err
+		}
+	}
+	if opt.timeout <= 0 {
+		return opt, fmt.Errorf("timeout must be positive")
+	}
+
+	return opt, nil
+}
+
+func parseStaleArgs(args []string) (opt staleOpts, err error) {
+	fs := flag.NewFlagSet(cmdStale, flag.ContinueOnError)
+	fs.StringVar(&opt.resolver, "resolver", "", "DNS server as host[:port]")
+	fs.DurationVar(&opt.timeout, "timeout", defaultDNSTimeout, "timeout of each DNS query")
+	fs.BoolVar(&opt.fix, "fix", false, "prune or rewrite the stale entries")
+	fs.BoolVar(&opt.yes, "yes", false, "don't ask before fixing")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+	if len(rest) > 0 {
+		return opt, fmt.Errorf("stale doesn't take arguments")
+	}
+	if opt.timeout <= 0 {
+		return opt, fmt.Errorf("timeout must be positive")
+	}
+	if opt.yes && !opt.fix {
+		return opt, fmt.Errorf("--yes requires --fix")
+	}
+
+	return opt, nil
+}
+
+func parseStatsArgs(args []string) (opt statsOpts, err error) {
+	fs := flag.NewFlagSet(cmdStats, flag.ContinueOnError)
+	fs.StringVar(&opt.format, "format", formatText, "output format")
+	fs.IntVar(&opt.top, "top", defaultStatsTop, "number of domains listed")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+	if len(rest) > 0 {
+		return opt, fmt.Errorf("stats doesn't take arguments")
+	}
+	if opt.format != formatText && opt.format != formatJSON {
+		return opt, fmt.Errorf("stats supports --format %s or %s", formatText, formatJSON)
+	}
+	if opt.top < 0 {
+		return opt, fmt.Errorf("--top cannot be negative")
+	}
+
+	return opt, nil
+}
+
+// connectFlags are the flags of the commands that connect to hosts
+type connectFlags struct {
+	timeout     time.Duration
+	concurrency int
+	ipv4, ipv6  bool
+}
+
+func (c *connectFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&c.timeout, "timeout", defaultScanTimeout, "timeout of each connection")
+	fs.IntVar(&c.concurrency, "concurrency", defaultScanConcurrency, "maximum parallel connections")
+	fs.BoolVar(&c.ipv4, "4", false, "use IPv4 only")
+	fs.BoolVar(&c.ipv6, "6", false, "use IPv6 only")
+}
+
+// apply validates the flags and stores them in opt
+func (c connectFlags) apply(opt *scanOpts) error {
+	switch {
+	case c.ipv4 && c.ipv6:
+		return fmt.Errorf("-4 and -6 are mutually exclusive")
+	case c.ipv4:
+		opt.network = "tcp4"
+	case c.ipv6:
+		opt.network = "tcp6"
+	default:
+		opt.network = "tcp"
+	}
+
+	if c.timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if c.concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	opt.timeout, opt.concurrency = c.timeout, c.concurrency
+
+	return nil
+}
+
+func parseScanArgs(args []string) (opt scanOpts, err error) {
+	var types string
+	var conn connectFlags
+
+	fs := flag.NewFlagSet(cmdScan, flag.ContinueOnError)
+	fs.StringVar(&types, "type", strings.Join(defaultScanTypes, ","), "key types to fetch")
+	conn.register(fs)
+	fs.BoolVar(&opt.hash, "hash", false, "hash the host names")
+	fs.BoolVar(&opt.append, "append", false, "add the keys to known_hosts")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only report what --append would change")
+
+	if opt.targets, err = parseFlags(fs, args); err != nil {
+		return opt, err
+	}
+
+	if len(opt.targets) == 0 {
+		return opt, fmt.Errorf("scan requires at least one host")
+	}
+	for _, t := range opt.targets {
+		if err := validateHost(t); err != nil {
+			return opt, err
+		}
+	}
+
+	for _, t := range strings.Split(types, ",") {
+		if _, ok := scanKeyTypes[t]; !ok {
+			return opt, fmt.Errorf("unsupported key type %q", t)
+		}
+		if !slices.Contains(opt.types, t) {
+			opt.types = append(opt.types, t)
+		}
+	}
+
+	if err := conn.apply(&opt); err != nil {
+		return opt, err
+	}
+	if opt.dryRun && !opt.append {
+		return opt, fmt.Errorf("--dry-run requires --append")
+	}
+
+	return opt, nil
+}
+
+func parseCheckArgs(args []string) (opt scanOpts, err error) {
+	var conn connectFlags
+
+	fs := flag.NewFlagSet(cmdCheck, flag.ContinueOnError)
+	conn.register(fs)
+
+	if opt.targets, err = parseFlags(fs, args); err != nil {
+		return opt, err
+	}
+	for _, t := range opt.targets {
+		if err := validateHost(t); err != nil {
+			return opt, err
+		}
+	}
+
+	return opt, conn.apply(&opt)
+}
+
+func parseUpdateArgs(args []string) (opt updateOpts, err error) {
+	var conn connectFlags
+
+	fs := flag.NewFlagSet(cmdUpdate, flag.ContinueOnError)
+	conn.register(fs)
+	fs.BoolVar(&opt.yes, "yes", false, "replace without asking")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+	if len(rest) != 1 {
+		return opt, fmt.Errorf("update requires exactly one host")
+	}
+	if err := validateHost(rest[0]); err != nil {
+		return opt, err
+	}
+	opt.host = rest[0]
+
+	return opt, conn.apply(&opt.conn)
+}
+
+func parseAddArgs(args []string) (opt addOpts, err error) {
+	fs := flag.NewFlagSet(cmdAdd, flag.ContinueOnError)
+	fs.BoolVar(&opt.stdin, "stdin", false, "read ssh-keyscan output from stdin")
+	fs.BoolVar(&opt.hash, "hash", false, "hash the host names")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only report what would change")
+
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+
+	if opt.stdin {
+		if len(rest) > 0 {
+			return opt, fmt.Errorf("add --stdin doesn't take arguments")
+		}
+		return opt, nil
+	}
+
+	if len(rest) < 3 {
+		return opt, fmt.Errorf("add requires host[,ip][:port] keytype base64-key [comment]")
+	}
+	if err := validateHost(rest[0]); err != nil {
+		return opt, err
+	}
+	opt.host, opt.keyType, opt.key = rest[0], rest[1], rest[2]
+	opt.comment = strings.Join(rest[3:], " ")
+
+	return opt, nil
+}
+
+func parseMergeArgs(args []string) (opt mergeOpts, err error) {
+	fs := flag.NewFlagSet(cmdMerge, flag.ContinueOnError)
+	fs.StringVar(&opt.output, "o", "", "output file, defaults to stdout")
+
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+
+	if len(files) != 3 {
+		return opt, fmt.Errorf("merge requires base, ours and theirs files")
+	}
+	opt.base, opt.ours, opt.theirs = files[0], files[1], files[2]
+
+	return opt, nil
+}
+
+func parseDiffArgs(args []string) (opt diffOpts, err error) {
+	fs := flag.NewFlagSet(cmdDiff, flag.ContinueOnError)
+	fs.StringVar(&opt.format, "format", formatText, "output format")
+
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return opt, err
+	}
+
+	if opt.format != formatText && opt.format != formatJSON {
+		return opt, fmt.Errorf("diff supports --format %s or %s", formatText, formatJSON)
+	}
+
+	switch len(files) {
+	case 1:
+		opt.a = files[0]
+	case 2:
+		opt.a, opt.b = files[0], files[1]
+	default:
+		return opt, fmt.Errorf("diff requires one or two files")
+	}
+
+	return opt, nil
+}
+
+// parseGlobalArgs extracts the flags accepted by every command and
+// returns the remaining arguments
+func parseGlobalArgs(args []string) (rest []string, opt opts, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == flagAuthorizedKeys {
+			opt.authorizedKeys = true
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if name != flagConfig && name != flagFile {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, opt, fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if value == "" {
+			return nil, opt, fmt.Errorf("%s cannot be empty", name)
+		}
+
+		if name == flagConfig {
+			opt.configPath = value
+		} else {
+			opt.files = append(opt.files, value)
+		}
+	}
+
+	return rest, opt, nil
+}
+
+// checkAuthorizedKeysArgs rejects commands that only make sense for
+// known_hosts when --authorized-keys is given
+func checkAuthorizedKeysArgs(opt opts) error {
+	if !opt.authorizedKeys {
+		return nil
+	}
+
+	switch opt.operation {
+	case cmdList, cmdSearch, cmdRemove, cmdTUI, cmdConfig:
+	default:
+		return fmt.Errorf("%s is not supported with %s", opt.operation, flagAuthorizedKeys)
+	}
+
+	if opt.format != "" && opt.format != formatText {
+		return fmt.Errorf("%s only supports --format %s", flagAuthorizedKeys, formatText)
+	}
+	if opt.tag != "" {
+		return fmt.Errorf("--tag is not supported with %s", flagAuthorizedKeys)
+	}
+
+	if r := opt.remove; opt.operation == cmdRemove && (len(r.hosts) != 1 || r.fromFile != "" || r.stdin || r.glob || r.regex) {
+		return fmt.Errorf("rm only supports a single key with %s", flagAuthorizedKeys)
+	}
+
+	return nil
+}
+
 func parseArgs() (opt opts) {
-	if len(os.Args) < 2 {
+	rest, opt, err := parseGlobalArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	args := append([]string{os.Args[0]}, rest...)
+	if len(args) < 2 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	switch os.Args[1] {
+	switch args[1] {
 	case cmdRemove:
-		host, dryRun, err := parseRemoveArgs(os.Args[2:])
+		remove, err := parseRemoveOpts(args[2:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		opt.operation = cmdRemove
-		opt.host = host
-		opt.dryRun = dryRun
+		opt.remove = remove
+		if len(remove.hosts) > 0 {
+			opt.host = remove.hosts[0]
+		}
+		opt.dryRun = remove.dryRun
 	case cmdList:
-		checkArgs(2)
+		rest, out, err := parseOutputArgs(cmdList, args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		checkArgs(append([]string{args[0], args[1]}, rest...), 2)
 		opt.operation = cmdList
+		opt.format = out.format
+		opt.template = out.template
+		opt.tag = out.tag
 	case cmdSearch:
-		checkArgs(3)
-		if err := validateHost(os.Args[2]); err != nil {
+		rest, out, err := parseOutputArgs(cmdSearch, args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(rest) == 0 {
+			checkArgs(args, 3)
+		}
+		// The words of a query may be given as separate arguments
+		query := strings.Join(rest, " ")
+		if err := validateHost(query); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		opt.operation = cmdSearch
-		opt.host = os.Args[2]
+		opt.host = query
+		opt.format = out.format
+		opt.template = out.template
+		opt.tag = out.tag
 	case cmdTUI:
-		checkArgs(2)
+		tag, err := parseTUIArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		opt.operation = cmdTUI
+		opt.tag = tag
+	case cmdMeta:
+		meta, err := parseMetaArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdMeta
+		opt.meta = meta
+	case cmdImport:
+		imp, err := parseImportArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdImport
+		opt.imp = imp
+	case cmdExport:
+		to, err := parseExportArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdExport
+		opt.exportTo = to
+	case cmdSync:
+		sync, err := parseSyncArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdSync
+		opt.sync = sync
+	case cmdMerge:
+		merge, err := parseMergeArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdMerge
+		opt.merge = merge
+	case cmdDiff:
+		diff, err := parseDiffArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdDiff
+		opt.diff = diff
+	case cmdVerifySignature:
+		verify, err := parseVerifySignatureArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdVerifySignature
+		opt.verify = verify
+	case cmdSSHFP:
+		for _, h := range args[2:] {
+			if err := validateHost(h); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		opt.operation = cmdSSHFP
+		opt.hosts = args[2:]
+	case cmdVerifyDNS:
+		verifyDNS, err := parseVerifyDNSArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdVerifyDNS
+		opt.verifyDNS = verifyDNS
+	case cmdScan:
+		scan, err := parseScanArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdScan
+		opt.scan = scan
+	case cmdCheck:
+		check, err := parseCheckArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdCheck
+		opt.check = check
+	case cmdUpdate:
+		update, err := parseUpdateArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdUpdate
+		opt.update = update
+	case cmdStale:
+		stale, err := parseStaleArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdStale
+		opt.stale = stale
+	case cmdStats:
+		stats, err := parseStatsArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdStats
+		opt.stats = stats
+	case cmdAdd:
+		add, err := parseAddArgs(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opt.operation = cmdAdd
+		opt.add = add
+	case cmdConfig:
+		checkArgs(args, 3)
+		if args[2] != "show" {
+			fmt.Fprintf(os.Stderr, "Error: unknown config command %q\n", args[2])
+			os.Exit(1)
+		}
+		opt.operation = cmdConfig
 	case cmdHelp:
 		printUsage()
 		os.Exit(0) // help is successful exit
@@ -115,6 +1027,11 @@ func parseArgs() (opt opts) {
 		os.Exit(1)
 	}
 
+	if err := checkAuthorizedKeysArgs(opt); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	return opt
 }
 
@@ -140,39 +1057,35 @@ func displayHostIdentifier(line string) string {
 	return line
 }
 
-func previewDelete(hosts []string, host string) {
-	_, removed := deleteMatches(hosts, host)
-	if len(removed) == 0 {
-		fmt.Println("Dry run: no matching hosts would be removed for:", host)
-		return
-	}
-
-	fmt.Printf("Dry run: would remove %d entr", len(removed))
-	if len(removed) == 1 {
-		fmt.Println("y:")
-	} else {
-		fmt.Println("ies:")
-	}
-	for _, line := range removed {
-		fmt.Printf("- %s\n", displayHostIdentifier(line))
-	}
+func searchHost(hosts []string, q Query, meta metaStore) {
+	listHost(q.Filter(hosts, meta), meta)
 }
 
-func deleteHost(hosts []string, host string) {
-	fmt.Println("Removing host:", host)
-	remaining, _ := deleteMatches(hosts, host)
-	if err := SaveFile(remaining); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to delete host: %v\n", err)
-		os.Exit(1)
+// hostLabel returns the name and IP of a line for listings. Lines NewHost
+// rejects, such as marked or commented ones, are shown with their
+// patterns and marker.
+func hostLabel(line string) (string, error) {
+	host, err := NewHost(line)
+	if err != nil {
+		e, perr := ParseEntry(line)
+		if perr != nil {
+			return "", err
+		}
+		return strings.TrimSpace(e.Marker + " " + strings.Join(e.Patterns, ", ")), nil
 	}
-}
 
-func searchHost(hosts []string, host string) {
-	newHosts := Search(hosts, host)
-	listHost(newHosts)
+	switch {
+	case host.Name == "":
+		return host.IP, nil
+	case host.IP == "":
+		return host.Name, nil
+	default:
+		return host.Name + ", " + host.IP, nil
+	}
 }
 
-func listHost(hosts []string) {
+// listHost prints the hosts with the tags and note of each entry
+func listHost(hosts []string, meta metaStore) {
 	fmt.Println("Current known hosts:")
 
 	for _, v := range hosts {
@@ -180,44 +1093,187 @@ func listHost(hosts []string) {
 			continue
 		}
 
-		host, err := NewHost(v)
+		label, err := hostLabel(v)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			continue
 		}
+		if summary := meta.Summary(v); summary != "" {
+			label += "  " + summary
+		}
+		fmt.Println(label)
+	}
+}
+
+// readAllLines reads every configured known_hosts file or exits
+func readAllLines() []sourceLine {
+	lines, err := ReadAllFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	return lines
+}
+
+// printHosts lists the lines matching pattern, or all lines when pattern
+// is empty, in the configured output format
+func printHosts(lines []sourceLine, pattern, tag string) {
+	q, err := ParseQuery(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid query: %v\n", err)
+		os.Exit(1)
+	}
 
-		if host.Name == "" {
-			fmt.Printf("%s\n", host.IP)
-		} else if host.IP == "" {
-			fmt.Printf("%s\n", host.Name)
+	meta, err := loadMeta()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	lines = filterTag(lines, meta, tag)
+
+	if cfg.Format == formatText {
+		hosts := make([]string, len(lines))
+		for i, sl := range lines {
+			hosts[i] = sl.Text
+		}
+
+		if pattern == "" {
+			listHost(hosts, meta)
 		} else {
-			fmt.Printf("%s, %s\n", host.Name, host.IP)
+			searchHost(hosts, q, meta)
 		}
+		return
+	}
+
+	if pattern != "" {
+		var matched []sourceLine
+		for _, sl := range lines {
+			if q.Match(sl.Text, meta) {
+				matched = append(matched, sl)
+			}
+		}
+		lines = matched
+	}
+
+	records := newRecords(lines, os.Stderr)
+	for i, r := range records {
+		m := meta[metaKey(Entry{Patterns: r.Patterns, Key: r.Key})]
+		records[i].Tags, records[i].Note = m.Tags, m.Note
+	}
+
+	if err := writeRecords(os.Stdout, records, cfg.Format, cfg.Template); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
 
 func printUsage() {
 	fmt.Println(`
-usage: known_hosts command [host]
+usage: known_hosts [--config file] [--file known_hosts] [--authorized-keys] command [host]
   commands:
-    ls      - List all known hosts
-    rm      - Remove a host (supports --dry-run)
-    search  - Search host in known hosts
-    tui     - Interactive terminal UI
-    help    - Show this message
+    ls          - List all known hosts (supports --format, --tag)
+    add         - Add a key: add host[,ip][:port] keytype base64 [comment], or
+                  add --stdin < ssh-keyscan output (supports --hash, --dry-run)
+    rm          - Remove hosts by exact name (supports --dry-run, --yes,
+                  --glob, --regex, --from-file list, --stdin, --cidr range,
+                  --query)
+    search      - Search known hosts with a query such as
+                  'type:ed25519 host:*.corp' (supports --format, --tag)
+    tui         - Interactive terminal UI (supports --tag)
+    meta        - Show or edit the metadata of a host: meta host [--tag a,b]
+                  [--untag c] [--note text | --clear-note]
+    import      - Import host keys (--from putty file.reg or --format json|csv file,
+                  supports --dry-run)
+    export      - Export host keys (--to putty > hosts.reg)
+    sync        - Add entries from a team file (--from file, supports --prune
+                  and --dry-run)
+    merge       - Three-way merge: merge base ours theirs [-o output]
+    diff        - Compare entries: diff a [b] (b defaults to known_hosts,
+                  supports --format json)
+    sshfp       - Print SSHFP DNS records: sshfp [host...]
+    verify-dns  - Compare keys with SSHFP records: verify-dns [host...]
+                  [--resolver 127.0.0.1:53] [--timeout 5s]
+    stale       - Find name,ip entries whose name no longer resolves to the IP
+                  [--resolver 127.0.0.1:53] [--timeout 5s] [--fix [--yes]]
+    stats       - Summarize key types, hashing, address families, markers,
+                  duplicates and top domains [--format json] [--top 10]
+    scan        - Fetch host keys over SSH: scan host[:port]... [--type rsa,ecdsa,ed25519]
+                  [--timeout 5s] [--concurrency 16] [-4|-6] [--hash]
+                  [--append [--dry-run]]
+    check       - Compare stored keys with the keys hosts offer: check [host...]
+                  [--timeout 5s] [--concurrency 16] [-4|-6]
+    update      - Replace the rotated keys of a host after confirmation:
+                  update host[:port] [--yes] [--timeout 5s] [-4|-6]
+    verify-signature - Check an ssh-keygen -Y sign signature: verify-signature
+                  file file.sig --allowed-signers allowed_signers
+    config show - Print the effective configuration
+    help        - Show this message
+
+  formats: text, json, csv, tsv, template (--template '{{.KeyType}}')
+
+  import and sync accept --require-signature [--signature file.sig]
+  [--allowed-signers file] to refuse input without a valid signature
+
+  --authorized-keys manages ~/.ssh/authorized_keys instead (ls, search, rm
+  and tui); rm takes the full line, the comment or the fingerprint
     `)
 
 }
 
-func runTUI(hosts []string) {
-	p := tea.NewProgram(
-		Model{
-			hosts:    hosts,
-			filtered: hosts,
-			mode:     viewList,
-		},
-		tea.WithAltScreen(),
-	)
+// setupConfig loads the config file and applies the command line overrides
+func setupConfig(opt opts) error {
+	c, err := LoadConfig(opt.configPath)
+	if err != nil {
+		return err
+	}
+
+	if len(opt.files) > 0 {
+		c.Files = opt.files
+	} else if opt.authorizedKeys {
+		c.Files = []string{defaultAuthorizedKeys}
+	}
+	if opt.format != "" {
+		c.Format = opt.format
+	}
+	if opt.template != "" {
+		c.Template = opt.template
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	cfg = c
+	applyColors(cfg.Colors)
+
+	return nil
+}
+
+func showConfig() {
+	if err := writeConfig(os.Stdout, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to print config: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runTUI(hosts []string, authorized bool, tag string) {
+	m := Model{
+		hosts:      hosts,
+		mode:       viewList,
+		authorized: authorized,
+		tag:        tag,
+	}
+	if !authorized {
+		meta, err := loadMeta()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		m.meta = meta
+	}
+	m.filterHosts()
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
 
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running TUI: %v\n", err)
@@ -230,34 +1286,95 @@ func ensureKnownHostsExists() error {
 		return nil
 	}
 
-	return fmt.Errorf("known_hosts file not found in ~/.ssh/known_hosts; connect to a host first or create it manually")
+	name, err := GetFilePath()
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("known_hosts file not found in %s; connect to a host first or create it manually", name)
 }
 
 func main() {
 	opt := parseArgs()
-	if err := ensureKnownHostsExists(); err != nil {
+	if err := setupConfig(opt); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	hosts, err := ReadFile()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// Commands that don't touch the user's known_hosts file
+	switch opt.operation {
+	case cmdConfig:
+		showConfig()
+		return
+	case cmdMerge:
+		runMerge(opt.merge)
+		return
+	case cmdDiff:
+		runDiff(opt.diff)
+		return
+	case cmdVerifySignature:
+		runVerifySignature(opt.verify.file, opt.verify.sig)
+		return
+	case cmdScan:
+		// Printing the keys doesn't need a known_hosts file
+		if !opt.scan.append {
+			runScan(nil, opt.scan)
+			return
+		}
+	}
+
+	if opt.authorizedKeys {
+		runAuthorizedKeys(opt)
+		return
+	}
+
+	// add can start a new known_hosts file, see runAdd
+	var hosts []string
+	if opt.operation != cmdAdd || Exists() {
+		if err := ensureKnownHostsExists(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var err error
+		if hosts, err = ReadFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	switch opt.operation {
 	case cmdRemove:
-		if opt.dryRun {
-			previewDelete(hosts, opt.host)
-			return
-		}
-		deleteHost(hosts, opt.host)
+		runRemove(hosts, opt.remove)
 	case cmdList:
-		listHost(hosts)
+		printHosts(readAllLines(), "", opt.tag)
 	case cmdSearch:
-		searchHost(hosts, opt.host)
+		printHosts(readAllLines(), opt.host, opt.tag)
 	case cmdTUI:
-		runTUI(hosts)
+		runTUI(hosts, false, opt.tag)
+	case cmdImport:
+		runImport(hosts, opt.imp)
+	case cmdExport:
+		runExport(hosts)
+	case cmdSync:
+		runSync(hosts, opt.sync)
+	case cmdSSHFP:
+		runSSHFP(readAllLines(), opt.hosts)
+	case cmdVerifyDNS:
+		runVerifyDNS(readAllLines(), opt.verifyDNS)
+	case cmdScan:
+		runScan(hosts, opt.scan)
+	case cmdCheck:
+		runCheck(readAllLines(), opt.check)
+	case cmdUpdate:
+		runUpdate(hosts, opt.update)
+	case cmdAdd:
+		runAdd(hosts, opt.add)
+	case cmdStale:
+		runStale(hosts, opt.stale)
+	case cmdStats:
+		runStats(readAllLines(), opt.stats)
+	case cmdMeta:
+		runMeta(hosts, opt.meta)
 	}
 }
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateHost(t *testing.T) {
@@ -91,7 +94,7 @@ func TestListHost(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			listHost(tt.hosts)
+			listHost(tt.hosts, nil)
 
 			w.Close()
 			os.Stdout = old
@@ -141,6 +144,12 @@ func TestSearchHost(t *testing.T) {
 			searchTerm:   "git",
 			wantContains: []string{"github.com", "gitlab.com"},
 		},
+		{
+			name:         "search marker",
+			hosts:        []string{"github.com ssh-rsa key", "@revoked old.corp ssh-rsa key"},
+			searchTerm:   "marker:revoked",
+			wantContains: []string{"@revoked old.corp"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -150,7 +159,11 @@ func TestSearchHost(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			searchHost(tt.hosts, tt.searchTerm)
+			q, err := ParseQuery(tt.searchTerm)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			searchHost(tt.hosts, q, nil)
 
 			w.Close()
 			os.Stdout = old
@@ -374,7 +387,7 @@ func TestCheckArgs(t *testing.T) {
 
 			// Only test the success case
 			// os.Exit() cannot be tested directly in unit tests
-			checkArgs(tt.num)
+			checkArgs(os.Args, tt.num)
 		})
 	}
 }
@@ -507,6 +520,151 @@ func TestParseRemoveArgs(t *testing.T) {
 	}
 }
 
+func TestParseRemoveOpts(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		want        removeOpts
+		wantErr     bool
+		wantErrText string
+	}{
+		{
+			name: "host only",
+			args: []string{"github.com"},
+			want: removeOpts{hosts: []string{"github.com"}},
+		},
+		{
+			name: "host and dry-run",
+			args: []string{"github.com", "--dry-run"},
+			want: removeOpts{hosts: []string{"github.com"}, dryRun: true},
+		},
+		{
+			name: "dry-run then host",
+			args: []string{"--dry-run", "github.com"},
+			want: removeOpts{hosts: []string{"github.com"}, dryRun: true},
+		},
+		{
+			name: "two hosts",
+			args: []string{"github.com", "gitlab.com"},
+			want: removeOpts{hosts: []string{"github.com", "gitlab.com"}},
+		},
+		{
+			name: "glob with confirmation skipped",
+			args: []string{"--glob", "*.staging.corp", "--yes"},
+			want: removeOpts{hosts: []string{"*.staging.corp"}, glob: true, yes: true},
+		},
+		{
+			name: "list from file",
+			args: []string{"--from-file", "hosts.txt"},
+			want: removeOpts{fromFile: "hosts.txt"},
+		},
+		{
+			name: "list from stdin",
+			args: []string{"--stdin", "--regex"},
+			want: removeOpts{stdin: true, regex: true},
+		},
+		{
+			name: "cidr",
+			args: []string{"--cidr", "10.42.0.0/16", "--dry-run"},
+			want: removeOpts{cidr: "10.42.0.0/16", dryRun: true},
+		},
+		{
+			name:        "invalid cidr",
+			args:        []string{"--cidr", "10.42.0.0"},
+			wantErr:     true,
+			wantErrText: "invalid CIDR",
+		},
+		{
+			name:        "cidr with hosts",
+			args:        []string{"--cidr", "10.42.0.0/16", "github.com"},
+			wantErr:     true,
+			wantErrText: "--cidr",
+		},
+		{
+			name: "query",
+			args: []string{"--query", "type:dsa -tag:lab", "--yes"},
+			want: removeOpts{query: "type:dsa -tag:lab", yes: true},
+		},
+		{
+			name:        "invalid query",
+			args:        []string{"--query", "port:ssh"},
+			wantErr:     true,
+			wantErrText: "invalid query",
+		},
+		{
+			name:        "empty query",
+			args:        []string{"--query", " "},
+			wantErr:     true,
+			wantErrText: "--query cannot be empty",
+		},
+		{
+			name:        "query with hosts",
+			args:        []string{"--query", "type:dsa", "github.com"},
+			wantErr:     true,
+			wantErrText: "--query",
+		},
+		{
+			name:        "cidr and query",
+			args:        []string{"--cidr", "10.42.0.0/16", "--query", "type:dsa"},
+			wantErr:     true,
+			wantErrText: "mutually exclusive",
+		},
+		{
+			name: "hosts after --",
+			args: []string{"--dry-run", "--", "-odd", "--yes"},
+			want: removeOpts{hosts: []string{"-odd", "--yes"}, dryRun: true},
+		},
+		{
+			name:        "glob and regex",
+			args:        []string{"--glob", "--regex", "x"},
+			wantErr:     true,
+			wantErrText: "mutually exclusive",
+		},
+		{
+			name:        "from-file and stdin",
+			args:        []string{"--from-file", "hosts.txt", "--stdin"},
+			wantErr:     true,
+			wantErrText: "mutually exclusive",
+		},
+		{
+			name:        "missing host",
+			args:        []string{"--dry-run"},
+			wantErr:     true,
+			wantErrText: "host cannot be empty",
+		},
+		{
+			name:        "empty host",
+			args:        []string{""},
+			wantErr:     true,
+			wantErrText: "host cannot be empty",
+		},
+		{
+			name:        "duplicate dry-run",
+			args:        []string{"--glob", "--dry-run", "*.corp", "--dry-run"},
+			wantErr:     true,
+			wantErrText: "duplicate --dry-run flag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRemoveOpts(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRemoveOpts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("parseRemoveOpts() error = %v, want substring %q", err, tt.wantErrText)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRemoveOpts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateHostErrors(t *testing.T) {
 	err := validateHost("")
 	if err == nil {
@@ -561,3 +719,563 @@ func TestEnsureKnownHostsExists(t *testing.T) {
 		}
 	})
 }
+
+func TestParseGlobalArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantRest   []string
+		wantConfig string
+		wantFiles  []string
+		wantAuth   bool
+		wantErr    bool
+	}{
+		{
+			name:     "no global flags",
+			args:     []string{"rm", "github.com"},
+			wantRest: []string{"rm", "github.com"},
+		},
+		{
+			name:       "flags before command",
+			args:       []string{"--config", "c.toml", "--file", "a", "ls"},
+			wantRest:   []string{"ls"},
+			wantConfig: "c.toml",
+			wantFiles:  []string{"a"},
+		},
+		{
+			name:      "repeated file with equals",
+			args:      []string{"ls", "--file=a", "--file=b"},
+			wantRest:  []string{"ls"},
+			wantFiles: []string{"a", "b"},
+		},
+		{
+			name:     "authorized keys mode",
+			args:     []string{"ls", "--authorized-keys"},
+			wantRest: []string{"ls"},
+			wantAuth: true,
+		},
+		{
+			name:    "missing value",
+			args:    []string{"ls", "--file"},
+			wantErr: true,
+		},
+		{
+			name:    "empty value",
+			args:    []string{"--config=", "ls"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, opt, err := parseGlobalArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGlobalArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("parseGlobalArgs() rest = %v, want %v", rest, tt.wantRest)
+			}
+			if opt.configPath != tt.wantConfig {
+				t.Errorf("parseGlobalArgs() config = %q, want %q", opt.configPath, tt.wantConfig)
+			}
+			if !reflect.DeepEqual(opt.files, tt.wantFiles) {
+				t.Errorf("parseGlobalArgs() files = %v, want %v", opt.files, tt.wantFiles)
+			}
+			if opt.authorizedKeys != tt.wantAuth {
+				t.Errorf("parseGlobalArgs() authorizedKeys = %v, want %v", opt.authorizedKeys, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestSetupConfig(t *testing.T) {
+	setConfig(t, defaultConfig())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := "files = [\"/from/config\"]\n[backup]\nretain = 5\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// Command line files override the config file
+	if err := setupConfig(opts{configPath: path, files: []string{"/from/flag"}}); err != nil {
+		t.Fatalf("setupConfig() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg.Files, []string{"/from/flag"}) {
+		t.Errorf("setupConfig() files = %v, want flag value", cfg.Files)
+	}
+	if cfg.Backup.Retain != 5 {
+		t.Errorf("setupConfig() backup.retain = %d, want 5 from config", cfg.Backup.Retain)
+	}
+}
+
+func TestParseImportArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    importOpts
+		wantErr string
+	}{
+		{
+			name: "putty file",
+			args: []string{"--from", "putty", "hosts.reg"},
+			want: importOpts{from: sourcePutty, file: "hosts.reg"},
+		},
+		{
+			name: "flags after file",
+			args: []string{"hosts.reg", "--from=putty", "--dry-run"},
+			want: importOpts{from: sourcePutty, file: "hosts.reg", dryRun: true},
+		},
+		{
+			name: "json records",
+			args: []string{"--format", "json", "-", "--dry-run"},
+			want: importOpts{format: formatJSON, file: "-", dryRun: true},
+		},
+		{
+			name:    "missing source",
+			args:    []string{"hosts.reg"},
+			wantErr: "import requires --from",
+		},
+		{
+			name:    "source and format",
+			args:    []string{"--from", "putty", "--format", "csv", "hosts.reg"},
+			wantErr: "either --from or --format",
+		},
+		{
+			name:    "unsupported format",
+			args:    []string{"--format", "tsv", "hosts.tsv"},
+			wantErr: "unsupported import format",
+		},
+		{
+			name:    "missing file",
+			args:    []string{"--from", "putty"},
+			wantErr: "exactly one file",
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--from", "putty", "--force", "hosts.reg"},
+			wantErr: "flag provided but not defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImportArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseImportArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportArgs() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseImportArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExportArgs(t *testing.T) {
+	if to, err := parseExportArgs([]string{"--to", "putty"}); err != nil || to != sourcePutty {
+		t.Errorf("parseExportArgs() = %q, %v, want putty", to, err)
+	}
+	if _, err := parseExportArgs(nil); err == nil {
+		t.Error("parseExportArgs() should require --to")
+	}
+	if _, err := parseExportArgs([]string{"--to", "putty", "extra"}); err == nil {
+		t.Error("parseExportArgs() should reject positional arguments")
+	}
+}
+
+func TestParseOutputArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantRest     []string
+		wantFormat   string
+		wantTemplate string
+		wantTag      string
+		wantErr      bool
+	}{
+		{name: "no flags", args: []string{"git"}, wantRest: []string{"git"}},
+		{name: "tag", args: []string{"git", "--tag", "prod"}, wantRest: []string{"git"}, wantTag: "prod"},
+		{name: "invalid tag", args: []string{"--tag", "a,b"}, wantErr: true},
+		{name: "json after pattern", args: []string{"git", "--format", "json"}, wantRest: []string{"git"}, wantFormat: formatJSON},
+		{name: "template implies format", args: []string{"--template", "{{.Key}}"}, wantFormat: formatTemplate, wantTemplate: "{{.Key}}"},
+		{name: "unknown format", args: []string{"--format", "yaml"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, out, err := parseOutputArgs(cmdSearch, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOutputArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) || out.format != tt.wantFormat || out.template != tt.wantTemplate || out.tag != tt.wantTag {
+				t.Errorf("parseOutputArgs() = %v, %+v", rest, out)
+			}
+		})
+	}
+}
+
+func TestPrintHostsStructured(t *testing.T) {
+	c := defaultConfig()
+	c.Format = formatJSON
+	setConfig(t, c)
+
+	lines := []sourceLine{
+		{Text: "github.com ssh-rsa key1", Source: "kh", Line: 1},
+		{Text: "gitlab.com ssh-rsa key2", Source: "kh", Line: 2},
+		{Text: "github.io broken", Source: "kh", Line: 3},
+	}
+
+	oldOut, oldErr := os.Stdout, os.Stderr
+	rOut, wOut, _ := os.Pipe()
+	rErr, wErr, _ := os.Pipe()
+	os.Stdout, os.Stderr = wOut, wErr
+
+	printHosts(lines, "github", "")
+
+	wOut.Close()
+	wErr.Close()
+	os.Stdout, os.Stderr = oldOut, oldErr
+
+	var stdout, stderr bytes.Buffer
+	_, _ = stdout.ReadFrom(rOut)
+	_, _ = stderr.ReadFrom(rErr)
+
+	var got []Record
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("stdout should only contain JSON: %v\n%s", err, stdout.String())
+	}
+	if len(got) != 1 || got[0].Patterns[0] != "github.com" || got[0].Line != 1 {
+		t.Errorf("printHosts() records = %+v, want github.com only", got)
+	}
+	if !strings.Contains(stderr.String(), "kh:3:") {
+		t.Errorf("printHosts() should warn on stderr, got %q", stderr.String())
+	}
+}
+
+func TestParseSyncArgs(t *testing.T) {
+	got, err := parseSyncArgs([]string{"--from", "team_known_hosts", "--prune", "--dry-run"})
+	if err != nil {
+		t.Fatalf("parseSyncArgs() error = %v", err)
+	}
+	want := syncOpts{from: "team_known_hosts", label: "team_known_hosts", prune: true, dryRun: true}
+	if got != want {
+		t.Errorf("parseSyncArgs() = %+v, want %+v", got, want)
+	}
+
+	got, err = parseSyncArgs([]string{"--from", "/shared/my team/known_hosts", "--label", "ops"})
+	if err != nil || got.label != "ops" {
+		t.Errorf("parseSyncArgs() label = %q, %v, want ops", got.label, err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"--from", "team", "extra"},
+		{"--from", "team", "--label", "my team"},
+		{"--from", "/shared/team hosts"},
+	} {
+		if _, err := parseSyncArgs(args); err == nil {
+			t.Errorf("parseSyncArgs(%v) should fail", args)
+		}
+	}
+}
+
+func TestParseMergeArgs(t *testing.T) {
+	got, err := parseMergeArgs([]string{"%O", "%A", "%B", "-o", "%A"})
+	if err != nil {
+		t.Fatalf("parseMergeArgs() error = %v", err)
+	}
+	want := mergeOpts{base: "%O", ours: "%A", theirs: "%B", output: "%A"}
+	if got != want {
+		t.Errorf("parseMergeArgs() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseMergeArgs([]string{"base", "ours"}); err == nil {
+		t.Error("parseMergeArgs() should require three files")
+	}
+}
+
+func TestParseDiffArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    diffOpts
+		wantErr bool
+	}{
+		{name: "two files", args: []string{"a", "b"}, want: diffOpts{a: "a", b: "b", format: formatText}},
+		{name: "one file", args: []string{"a"}, want: diffOpts{a: "a", format: formatText}},
+		{name: "json", args: []string{"a", "--format", "json", "b"}, want: diffOpts{a: "a", b: "b", format: formatJSON}},
+		{name: "no files", args: nil, wantErr: true},
+		{name: "too many files", args: []string{"a", "b", "c"}, wantErr: true},
+		{name: "unsupported format", args: []string{"a", "--format", "csv"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDiffArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDiffArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseDiffArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAuthorizedKeysArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     opts
+		wantErr bool
+	}{
+		{name: "known_hosts mode", opt: opts{operation: cmdImport}},
+		{name: "list", opt: opts{operation: cmdList, authorizedKeys: true}},
+		{name: "remove", opt: opts{operation: cmdRemove, remove: removeOpts{hosts: []string{"alice@laptop"}}, authorizedKeys: true}},
+		{name: "bulk remove", opt: opts{operation: cmdRemove, remove: removeOpts{hosts: []string{"a", "b"}}, authorizedKeys: true}, wantErr: true},
+		{name: "import", opt: opts{operation: cmdImport, authorizedKeys: true}, wantErr: true},
+		{name: "json", opt: opts{operation: cmdList, format: formatJSON, authorizedKeys: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAuthorizedKeysArgs(tt.opt); (err != nil) != tt.wantErr {
+				t.Errorf("checkAuthorizedKeysArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetupConfigAuthorizedKeys(t *testing.T) {
+	setConfig(t, defaultConfig())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if err := setupConfig(opts{authorizedKeys: true}); err != nil {
+		t.Fatalf("setupConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Files, []string{defaultAuthorizedKeys}) {
+		t.Errorf("setupConfig() files = %v, want %s", cfg.Files, defaultAuthorizedKeys)
+	}
+
+	// --file still wins
+	if err := setupConfig(opts{authorizedKeys: true, files: []string{"/tmp/keys"}}); err != nil {
+		t.Fatalf("setupConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Files, []string{"/tmp/keys"}) {
+		t.Errorf("setupConfig() files = %v, want /tmp/keys", cfg.Files)
+	}
+}
+
+func TestParseVerifySignatureArgs(t *testing.T) {
+	got, err := parseVerifySignatureArgs([]string{"team", "team.sig", "--allowed-signers", "signers", "--identity=ops@corp"})
+	if err != nil {
+		t.Fatalf("parseVerifySignatureArgs() error = %v", err)
+	}
+	want := verifyOpts{file: "team", sig: sigOpts{require: true, signature: "team.sig", allowedSigners: "signers", identity: "ops@corp"}}
+	if got != want {
+		t.Errorf("parseVerifySignatureArgs() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseVerifySignatureArgs([]string{"team"}); err == nil {
+		t.Error("parseVerifySignatureArgs() should require a signature file")
+	}
+}
+
+func TestRequireSignatureFlags(t *testing.T) {
+	imp, err := parseImportArgs([]string{"--format", "json", "-", "--require-signature", "--signature", "in.sig"})
+	if err != nil {
+		t.Fatalf("parseImportArgs() error = %v", err)
+	}
+	if want := (sigOpts{require: true, signature: "in.sig"}); imp.sig != want {
+		t.Errorf("parseImportArgs() sig = %+v, want %+v", imp.sig, want)
+	}
+
+	sync, err := parseSyncArgs([]string{"--from", "team", "--require-signature", "--allowed-signers", "signers"})
+	if err != nil {
+		t.Fatalf("parseSyncArgs() error = %v", err)
+	}
+	if want := (sigOpts{require: true, allowedSigners: "signers"}); sync.sig != want {
+		t.Errorf("parseSyncArgs() sig = %+v, want %+v", sync.sig, want)
+	}
+}
+
+func TestParseVerifyDNSArgs(t *testing.T) {
+	got, err := parseVerifyDNSArgs([]string{"a.example.com", "--resolver", "127.0.0.1:5353", "b.example.com", "--timeout=2s"})
+	if err != nil {
+		t.Fatalf("parseVerifyDNSArgs() error = %v", err)
+	}
+	want := verifyDNSOpts{hosts: []string{"a.example.com", "b.example.com"}, resolver: "127.0.0.1:5353", timeout: 2 * time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVerifyDNSArgs() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseVerifyDNSArgs([]string{"--timeout", "0s"}); err == nil {
+		t.Error("parseVerifyDNSArgs() should reject a zero timeout")
+	}
+}
+
+func TestParseScanArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    scanOpts
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{"example.com"},
+			want: scanOpts{targets: []string{"example.com"}, types: defaultScanTypes, timeout: defaultScanTimeout, concurrency: defaultScanConcurrency, network: "tcp"},
+		},
+		{
+			name: "all flags",
+			args: []string{"a", "--type", "ed25519,ed25519,rsa", "-6", "b:2222", "--timeout=1s", "--concurrency", "2", "--hash", "--append", "--dry-run"},
+			want: scanOpts{targets: []string{"a", "b:2222"}, types: []string{"ed25519", "rsa"}, timeout: time.Second, concurrency: 2, network: "tcp6", hash: true, append: true, dryRun: true},
+		},
+		{name: "no hosts", args: nil, wantErr: true},
+		{name: "unknown type", args: []string{"a", "--type", "x25519"}, wantErr: true},
+		{name: "both families", args: []string{"a", "-4", "-6"}, wantErr: true},
+		{name: "zero concurrency", args: []string{"a", "--concurrency", "0"}, wantErr: true},
+		{name: "dry run without append", args: []string{"a", "--dry-run"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScanArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScanArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseScanArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCheckArgs(t *testing.T) {
+	got, err := parseCheckArgs([]string{"a", "-4", "--timeout", "2s", "b:2222"})
+	if err != nil {
+		t.Fatalf("parseCheckArgs() error = %v", err)
+	}
+	want := scanOpts{targets: []string{"a", "b:2222"}, timeout: 2 * time.Second, concurrency: defaultScanConcurrency, network: "tcp4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCheckArgs() = %+v, want %+v", got, want)
+	}
+
+	if got, err := parseCheckArgs(nil); err != nil || got.targets != nil {
+		t.Errorf("parseCheckArgs() = %+v, %v, want all hosts", got, err)
+	}
+	if _, err := parseCheckArgs([]string{"-4", "-6"}); err == nil {
+		t.Error("parseCheckArgs() should reject -4 with -6")
+	}
+}
+
+func TestParseUpdateArgs(t *testing.T) {
+	got, err := parseUpdateArgs([]string{"db.example.com:2222", "--yes", "-6"})
+	if err != nil {
+		t.Fatalf("parseUpdateArgs() error = %v", err)
+	}
+	want := updateOpts{host: "db.example.com:2222", yes: true, conn: scanOpts{timeout: defaultScanTimeout, concurrency: defaultScanConcurrency, network: "tcp6"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseUpdateArgs() = %+v, want %+v", got, want)
+	}
+
+	for _, args := range [][]string{nil, {"a", "b"}} {
+		if _, err := parseUpdateArgs(args); err == nil {
+			t.Errorf("parseUpdateArgs(%v) should fail", args)
+		}
+	}
+}
+
+func TestParseAddArgs(t *testing.T) {
+	got, err := parseAddArgs([]string{"--hash", "db.example.com,10.0.0.5:2222", "ssh-ed25519", "AAAA", "deploy", "key"})
+	if err != nil {
+		t.Fatalf("parseAddArgs() error = %v", err)
+	}
+	want := addOpts{host: "db.example.com,10.0.0.5:2222", keyType: "ssh-ed25519", key: "AAAA", comment: "deploy key", hash: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAddArgs() = %+v, want %+v", got, want)
+	}
+
+	got, err = parseAddArgs([]string{"--stdin", "--dry-run"})
+	if err != nil || !got.stdin || !got.dryRun {
+		t.Errorf("parseAddArgs(--stdin --dry-run) = %+v, %v", got, err)
+	}
+
+	for _, args := range [][]string{nil, {"host", "ssh-ed25519"}, {"--stdin", "host"}} {
+		if _, err := parseAddArgs(args); err == nil {
+			t.Errorf("parseAddArgs(%v) should fail", args)
+		}
+	}
+}
+
+func TestParseStaleArgs(t *testing.T) {
+	got, err := parseStaleArgs([]string{"--resolver", "127.0.0.1:5353", "--fix", "--yes"})
+	if err != nil {
+		t.Fatalf("parseStaleArgs() error = %v", err)
+	}
+	want := staleOpts{resolver: "127.0.0.1:5353", timeout: defaultDNSTimeout, fix: true, yes: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStaleArgs() = %+v, want %+v", got, want)
+	}
+
+	for _, args := range [][]string{{"host"}, {"--yes"}, {"--timeout", "0s"}} {
+		if _, err := parseStaleArgs(args); err == nil {
+			t.Errorf("parseStaleArgs(%v) should fail", args)
+		}
+	}
+}
+
+func TestParseStatsArgs(t *testing.T) {
+	got, err := parseStatsArgs([]string{"--format", "json", "--top", "3"})
+	if err != nil {
+		t.Fatalf("parseStatsArgs() error = %v", err)
+	}
+	if want := (statsOpts{format: formatJSON, top: 3}); got != want {
+		t.Errorf("parseStatsArgs() = %+v, want %+v", got, want)
+	}
+
+	for _, args := range [][]string{{"host"}, {"--format", "csv"}, {"--top", "-1"}} {
+		if _, err := parseStatsArgs(args); err == nil {
+			t.Errorf("parseStatsArgs(%v) should fail", args)
+		}
+	}
+}
+
+func TestParseMetaArgs(t *testing.T) {
+	got, err := parseMetaArgs([]string{"github.com", "--tag", "prod,git", "--untag", "lab", "--note", ""})
+	if err != nil {
+		t.Fatalf("parseMetaArgs() error = %v", err)
+	}
+	want := metaOpts{host: "github.com", tags: []string{"prod", "git"}, untags: []string{"lab"}, setNote: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetaArgs() = %+v, want %+v", got, want)
+	}
+
+	for _, args := range [][]string{nil, {"a", "b"}, {"a", "--tag", "x y"}, {"a", "--note", "x", "--clear-note"}, {"a", "--note", "two\nlines"}} {
+		if _, err := parseMetaArgs(args); err == nil {
+			t.Errorf("parseMetaArgs(%q) should fail", args)
+		}
+	}
+}
+
+func TestParseTUIArgs(t *testing.T) {
+	if tag, err := parseTUIArgs([]string{"--tag", "prod"}); err != nil || tag != "prod" {
+		t.Errorf("parseTUIArgs() = %q, %v, want prod", tag, err)
+	}
+	if _, err := parseTUIArgs([]string{"extra"}); err == nil {
+		t.Error("parseTUIArgs() should reject arguments")
+	}
+}
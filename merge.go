@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mergeReport describes what happened to each entry given to mergeEntries
+type mergeReport struct {
+	Added      []Entry
+	Duplicates []Entry
+	Conflicts  []mergeConflict
+}
+
+// mergeConflict is an incoming entry whose host already has another key of
+// the same type
+type mergeConflict struct {
+	Entry    Entry
+	Existing Entry
+}
+
+// mergeEntries appends the incoming entries that aren't in lines yet.
+//
+// An entry is a duplicate when every one of its hosts already has the same
+// key, and a conflict when one of its hosts has a different key of the same
+// type. Conflicting entries are never written, the existing key wins.
+// When hash is set, added entries are written with hashed host patterns.
+func mergeEntries(lines []string, incoming []Entry, hash bool) (out []string, report mergeReport, err error) {
+	out = append(out, lines...)
+
+	var existing []Entry
+	for _, line := range lines {
+		if e, err := ParseEntry(line); err == nil {
+			existing = append(existing, e)
+		}
+	}
+
+	for _, e := range incoming {
+		duplicate, conflict := classifyEntry(existing, e)
+		switch {
+		case conflict != nil:
+			report.Conflicts = append(report.Conflicts, mergeConflict{Entry: e, Existing: *conflict})
+			continue
+		case duplicate:
+			report.Duplicates = append(report.Duplicates, e)
+			continue
+		}
+
+		written := []Entry{e}
+		if hash {
+			if written, err = hashEntry(e); err != nil {
+				return nil, report, fmt.Errorf("failed to hash %s: %w", strings.Join(e.Patterns, ","), err)
+			}
+		}
+
+		for _, w := range written {
+			out = append(out, w.String())
+		}
+		// Keep the plain entry so later duplicates in incoming are detected
+		existing = append(existing, e)
+		report.Added = append(report.Added, e)
+	}
+
+	return out, report, nil
+}
+
+// classifyEntry compares e with the existing entries of the same marker
+func classifyEntry(existing []Entry, e Entry) (duplicate bool, conflict *Entry) {
+	duplicate = true
+
+	for _, p := range e.Patterns {
+		found := false
+		for i := range existing {
+			x := existing[i]
+			if x.Marker != e.Marker || x.KeyType != e.KeyType || !x.HasHost(p) {
+				continue
+			}
+
+			if x.Key == e.Key {
+				found = true
+				continue
+			}
+
+			// CA and revocation lines may legitimately list several keys
+			if e.Marker == "" {
+				return false, &existing[i]
+			}
+		}
+
+		if !found {
+			duplicate = false
+		}
+	}
+
+	return duplicate, nil
+}
+
+// printMergeReport writes a human readable summary of report to w
+func printMergeReport(w io.Writer, report mergeReport, dryRun bool) {
+	verb := "Added"
+	if dryRun {
+		verb = "Dry run: would add"
+	}
+
+	fmt.Fprintf(w, "%s %d %s\n", verb, len(report.Added), plural(len(report.Added), "entry", "entries"))
+	for _, e := range report.Added {
+		fmt.Fprintf(w, "+ %s %s\n", strings.Join(e.Patterns, ","), e.KeyType)
+	}
+
+	if len(report.Duplicates) > 0 {
+		fmt.Fprintf(w, "Skipped %d %s:\n", len(report.Duplicates), plural(len(report.Duplicates), "duplicate", "duplicates"))
+		for _, e := range report.Duplicates {
+			fmt.Fprintf(w, "= %s %s\n", strings.Join(e.Patterns, ","), e.KeyType)
+		}
+	}
+
+	if len(report.Conflicts) > 0 {
+		fmt.Fprintf(w, "Rejected %d %s:\n", len(report.Conflicts), plural(len(report.Conflicts), "conflict", "conflicts"))
+		for _, c := range report.Conflicts {
+			fmt.Fprintf(w, "! %s %s: new key %s differs from existing %s\n",
+				strings.Join(c.Entry.Patterns, ","), c.Entry.KeyType,
+				c.Entry.Fingerprint(), c.Existing.Fingerprint())
+		}
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+
+	return many
+}
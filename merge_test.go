@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeEntries(t *testing.T) {
+	keyType, keyA := testPublicKey(t)
+	_, keyB := testPublicKey(t)
+
+	hashed, err := newHashedHost("hashed.example.com")
+	if err != nil {
+		t.Fatalf("newHashedHost() error = %v", err)
+	}
+
+	lines := []string{
+		"github.com " + keyType + " " + keyA,
+		hashed + " " + keyType + " " + keyA,
+		"@cert-authority *.corp " + keyType + " " + keyA,
+	}
+
+	incoming := []Entry{
+		{Patterns: []string{"github.com"}, KeyType: keyType, Key: keyA},         // duplicate
+		{Patterns: []string{"hashed.example.com"}, KeyType: keyType, Key: keyA}, // duplicate of hashed line
+		{Patterns: []string{"github.com"}, KeyType: keyType, Key: keyB},         // conflict
+		{Patterns: []string{"github.com"}, KeyType: "ssh-rsa", Key: keyB},       // new key type
+		{Patterns: []string{"new.example.com", "10.0.0.1"}, KeyType: keyType, Key: keyB},
+		{Patterns: []string{"new.example.com"}, KeyType: keyType, Key: keyB},                     // duplicate of the line above
+		{Marker: markerCertAuthority, Patterns: []string{"*.corp"}, KeyType: keyType, Key: keyB}, // second CA key
+	}
+
+	out, report, err := mergeEntries(lines, incoming, false)
+	if err != nil {
+		t.Fatalf("mergeEntries() error = %v", err)
+	}
+
+	wantOut := append(append([]string{}, lines...),
+		"github.com ssh-rsa "+keyB,
+		"new.example.com,10.0.0.1 "+keyType+" "+keyB,
+		"@cert-authority *.corp "+keyType+" "+keyB,
+	)
+	if !reflect.DeepEqual(out, wantOut) {
+		t.Errorf("mergeEntries() out = %v\nwant %v", out, wantOut)
+	}
+
+	if len(report.Added) != 3 || len(report.Duplicates) != 3 || len(report.Conflicts) != 1 {
+		t.Fatalf("mergeEntries() report = %d added, %d duplicates, %d conflicts, want 3, 3, 1",
+			len(report.Added), len(report.Duplicates), len(report.Conflicts))
+	}
+	if report.Conflicts[0].Existing.Key != keyA {
+		t.Errorf("conflict existing key = %q, want the stored key", report.Conflicts[0].Existing.Key)
+	}
+}
+
+func TestMergeEntries_Hash(t *testing.T) {
+	keyType, key := testPublicKey(t)
+
+	out, report, err := mergeEntries(nil, []Entry{{Patterns: []string{"a", "b"}, KeyType: keyType, Key: key}}, true)
+	if err != nil {
+		t.Fatalf("mergeEntries() error = %v", err)
+	}
+	if len(report.Added) != 1 || len(out) != 2 {
+		t.Fatalf("mergeEntries() out = %v, want one hashed line per pattern", out)
+	}
+
+	for i, host := range []string{"a", "b"} {
+		e, err := ParseEntry(out[i])
+		if err != nil || !e.Hashed() || !e.HasHost(host) {
+			t.Errorf("line %d = %q, want hashed %s", i, out[i], host)
+		}
+	}
+}
+
+func TestPrintMergeReport(t *testing.T) {
+	e := Entry{Patterns: []string{"github.com"}, KeyType: "ssh-ed25519", Key: "AAAA"}
+	report := mergeReport{
+		Added:      []Entry{e},
+		Duplicates: []Entry{e, e},
+		Conflicts:  []mergeConflict{{Entry: e, Existing: e}},
+	}
+
+	var buf bytes.Buffer
+	printMergeReport(&buf, report, true)
+
+	for _, want := range []string{
+		"Dry run: would add 1 entry",
+		"+ github.com ssh-ed25519",
+		"Skipped 2 duplicates:",
+		"Rejected 1 conflict:",
+		"! github.com ssh-ed25519",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("printMergeReport() should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
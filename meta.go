@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EntryMeta is what known_hosts lines can't carry about an entry. It is
+// kept in a sidecar file, keyed by the key fingerprint and the host
+// patterns of the line.
+type EntryMeta struct {
+	Fingerprint string    `json:"fingerprint"`
+	Pattern     string    `json:"pattern"`
+	Tags        []string  `json:"tags,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	Added       time.Time `json:"added,omitzero"`
+	Origin      string    `json:"origin,omitempty"`
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+}
+
+// metaStore is the metadata of the first known_hosts file by metaKey
+type metaStore map[string]EntryMeta
+
+// metaKey returns the store key of e
+func metaKey(e Entry) string {
+	return e.Fingerprint() + " " + strings.Join(e.Patterns, ",")
+}
+
+// lineMetaKey returns the store key of a known_hosts line
+func lineMetaKey(line string) (string, bool) {
+	e, err := ParseEntry(line)
+	if err != nil {
+		return "", false
+	}
+
+	return metaKey(e), true
+}
+
+// Get returns the metadata of line
+func (s metaStore) Get(line string) (EntryMeta, bool) {
+	key, ok := lineMetaKey(line)
+	if !ok {
+		return EntryMeta{}, false
+	}
+
+	m, ok := s[key]
+	return m, ok
+}
+
+// HasTag reports whether line is tagged with tag
+func (s metaStore) HasTag(line, tag string) bool {
+	m, _ := s.Get(line)
+	return slices.Contains(m.Tags, tag)
+}
+
+// Summary returns the tags and note of line for listings, empty when it
+// has neither
+func (s metaStore) Summary(line string) string {
+	m, _ := s.Get(line)
+
+	var parts []string
+	if len(m.Tags) > 0 {
+		parts = append(parts, "["+strings.Join(m.Tags, ",")+"]")
+	}
+	if m.Note != "" {
+		parts = append(parts, m.Note)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// filterTag returns the lines tagged with tag, all lines when tag is empty
+func filterTag(lines []sourceLine, meta metaStore, tag string) []sourceLine {
+	if tag == "" {
+		return lines
+	}
+
+	var out []sourceLine
+	for _, sl := range lines {
+		if meta.HasTag(sl.Text, tag) {
+			out = append(out, sl)
+		}
+	}
+
+	return out
+}
+
+// metaPath returns the metadata file, by default known_hosts.meta.json
+// next to the first known_hosts file
+func metaPath() (string, error) {
+	if cfg.Metadata != "" {
+		return expandPath(cfg.Metadata)
+	}
+
+	name, err := GetFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(name), filepath.Base(name)+".meta.json"), nil
+}
+
+// loadMeta reads the metadata file, a missing file is an empty store
+func loadMeta() (metaStore, error) {
+	name, err := metaPath()
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(metaStore)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	var entries []EntryMeta
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata %s: %w", name, err)
+	}
+	for _, m := range entries {
+		s[m.Fingerprint+" "+m.Pattern] = m
+	}
+
+	return s, nil
+}
+
+// saveMeta writes s sorted by pattern, so the file diffs well
+func saveMeta(s metaStore) error {
+	name, err := metaPath()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]EntryMeta, 0, len(s))
+	for _, m := range s {
+		entries = append(entries, m)
+	}
+	slices.SortFunc(entries, func(a, b EntryMeta) int {
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Fingerprint, b.Fingerprint)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(name, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// set stores m for e
+func (s metaStore) set(e Entry, m EntryMeta) {
+	m.Fingerprint, m.Pattern = e.Fingerprint(), strings.Join(e.Patterns, ",")
+	s[metaKey(e)] = m
+}
+
+// syncMeta keeps the metadata in step with a rewrite of known_hosts from
+// before to after. Lines new in after are recorded as added now from
+// origin, renamed lines (old line to new line) keep their metadata and the
+// metadata of lines that are gone is dropped. The file is only written
+// when something changed.
+func syncMeta(before, after []string, origin string, renamed map[string]string) error {
+	s, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	changed := false
+
+	for oldLine, newLine := range renamed {
+		oldKey, ok1 := lineMetaKey(oldLine)
+		e, err := ParseEntry(newLine)
+		if !ok1 || err != nil {
+			continue
+		}
+		if m, ok := s[oldKey]; ok {
+			delete(s, oldKey)
+			s.set(e, m)
+			changed = true
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, line := range before {
+		if key, ok := lineMetaKey(line); ok {
+			known[key] = true
+		}
+	}
+
+	present := make(map[string]bool)
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, line := range after {
+		e, err := ParseEntry(line)
+		if err != nil {
+			continue
+		}
+		key := metaKey(e)
+		present[key] = true
+
+		if _, ok := s[key]; ok || known[key] || origin == "" {
+			continue
+		}
+		s.set(e, EntryMeta{Added: now, Origin: origin})
+		changed = true
+	}
+
+	for key := range s {
+		if !present[key] {
+			delete(s, key)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return saveMeta(s)
+}
+
+// touchMeta records that the keys of entries were seen on their hosts
+func touchMeta(entries []Entry, seen time.Time) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	s, err := loadMeta()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		m := s[metaKey(e)]
+		m.LastSeen = seen.UTC().Truncate(time.Second)
+		s.set(e, m)
+	}
+
+	return saveMeta(s)
+}
+
+// validateTag checks that tag can be written in listings and queries
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag cannot be empty")
+	}
+	if strings.ContainsAny(tag, " \t\r\n,") {
+		return fmt.Errorf("tag %q cannot contain spaces or commas", tag)
+	}
+
+	return nil
+}
+
+// metaOpts are the options of meta
+type metaOpts struct {
+	host      string
+	tags      []string
+	untags    []string
+	note      string
+	setNote   bool
+	clearNote bool
+}
+
+// editMeta applies the tag and note changes of opt to the lines selected
+// by opt.host and returns them
+func editMeta(s metaStore, hosts []string, opt metaOpts) []Entry {
+	match := exactMatcher(opt.host)
+
+	var edited []Entry
+	for _, line := range hosts {
+		if line == "" || !match(line) {
+			continue
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			continue
+		}
+
+		m := s[metaKey(e)]
+		for _, t := range opt.tags {
+			if !slices.Contains(m.Tags, t) {
+				m.Tags = append(m.Tags, t)
+			}
+		}
+		m.Tags = slices.DeleteFunc(m.Tags, func(t string) bool { return slices.Contains(opt.untags, t) })
+		slices.Sort(m.Tags)
+		switch {
+		case opt.clearNote:
+			m.Note = ""
+		case opt.setNote:
+			m.Note = opt.note
+		}
+
+		if len(m.Tags) == 0 {
+			m.Tags = nil
+		}
+		if m.empty() {
+			delete(s, metaKey(e))
+		} else {
+			s.set(e, m)
+		}
+		edited = append(edited, e)
+	}
+
+	return edited
+}
+
+// empty reports whether m holds nothing worth keeping
+func (m EntryMeta) empty() bool {
+	return len(m.Tags) == 0 && m.Note == "" && m.Added.IsZero() && m.Origin == "" && m.LastSeen.IsZero()
+}
+
+// printMeta writes the metadata of e
+func printMeta(w io.Writer, e Entry, m EntryMeta) {
+	fmt.Fprintf(w, "%s %s %s\n", displayHostIdentifier(e.String()), e.KeyType, e.Fingerprint())
+	if len(m.Tags) > 0 {
+		fmt.Fprintf(w, "  tags:      %s\n", strings.Join(m.Tags, ", "))
+	}
+	if m.Note != "" {
+		fmt.Fprintf(w, "  note:      %s\n", m.Note)
+	}
+	if !m.Added.IsZero() {
+		added := m.Added.Format(time.RFC3339)
+		if m.Origin != "" {
+			added += " by " + m.Origin
+		}
+		fmt.Fprintf(w, "  added:     %s\n", added)
+	}
+	if !m.LastSeen.IsZero() {
+		fmt.Fprintf(w, "  last seen: %s\n", m.LastSeen.Format(time.RFC3339))
+	}
+}
+
+// runMeta shows or edits the metadata of the entries of a host
+func runMeta(hosts []string, opt metaOpts) {
+	s, err := loadMeta()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	editing := len(opt.tags) > 0 || len(opt.untags) > 0 || opt.setNote || opt.clearNote
+	entries := editMeta(s, hosts, opt)
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no entry for %s\n", opt.host)
+		os.Exit(1)
+	}
+
+	if editing {
+		if err := saveMeta(s); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, e := range entries {
+		printMeta(os.Stdout, e, s[metaKey(e)])
+	}
+}
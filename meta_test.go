@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setMetaConfig points the first known_hosts file and its metadata to a
+// temporary directory
+func setMetaConfig(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	c := defaultConfig()
+	c.Files = []string{filepath.Join(dir, "known_hosts")}
+	setConfig(t, c)
+
+	return dir
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	dir := setMetaConfig(t)
+	keyType, key := testPublicKey(t)
+	e := Entry{Patterns: []string{"github.com", "140.82.121.4"}, KeyType: keyType, Key: key}
+
+	s, err := loadMeta()
+	if err != nil || len(s) != 0 {
+		t.Fatalf("loadMeta() without file = %v, %v, want empty store", s, err)
+	}
+
+	added := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.set(e, EntryMeta{Tags: []string{"prod"}, Note: "GitHub", Added: added, Origin: cmdAdd})
+	if err := saveMeta(s); err != nil {
+		t.Fatalf("saveMeta() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "known_hosts.meta.json"))
+	if err != nil {
+		t.Fatalf("metadata file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("metadata file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	got, err := loadMeta()
+	if err != nil {
+		t.Fatalf("loadMeta() error = %v", err)
+	}
+	m, ok := got.Get(e.String())
+	want := EntryMeta{Fingerprint: e.Fingerprint(), Pattern: "github.com,140.82.121.4", Tags: []string{"prod"}, Note: "GitHub", Added: added, Origin: cmdAdd}
+	if !ok || !reflect.DeepEqual(m, want) {
+		t.Errorf("Get() = %+v, %v, want %+v", m, ok, want)
+	}
+	if s := got.Summary(e.String() + " comment"); s != "[prod] GitHub" {
+		t.Errorf("Summary() = %q, want %q", s, "[prod] GitHub")
+	}
+}
+
+func TestSyncMeta(t *testing.T) {
+	setMetaConfig(t)
+	keyType, key := testPublicKey(t)
+	_, other := testPublicKey(t)
+
+	kept := "github.com " + keyType + " " + key
+	deleted := "gitlab.com " + keyType + " " + key
+	renamedOld := "web1.corp,10.42.0.7 " + keyType + " " + other
+	renamedNew := "web1.corp " + keyType + " " + other
+	added := "new.example.com " + keyType + " " + other
+
+	s := make(metaStore)
+	for _, line := range []string{kept, deleted, renamedOld} {
+		e, _ := ParseEntry(line)
+		s.set(e, EntryMeta{Tags: []string{"lab"}})
+	}
+	if err := saveMeta(s); err != nil {
+		t.Fatalf("saveMeta() error = %v", err)
+	}
+
+	before := []string{kept, deleted, renamedOld}
+	after := []string{kept, renamedNew, added}
+	if err := syncMeta(before, after, cmdAdd, map[string]string{renamedOld: renamedNew}); err != nil {
+		t.Fatalf("syncMeta() error = %v", err)
+	}
+
+	got, _ := loadMeta()
+	if len(got) != 3 {
+		t.Errorf("syncMeta() left %d entries, want 3", len(got))
+	}
+	if _, ok := got.Get(deleted); ok {
+		t.Error("metadata of the deleted entry should be dropped")
+	}
+	if !got.HasTag(kept, "lab") || !got.HasTag(renamedNew, "lab") {
+		t.Error("metadata of kept and renamed entries should survive")
+	}
+	if m, _ := got.Get(added); m.Origin != cmdAdd || m.Added.IsZero() {
+		t.Errorf("added entry metadata = %+v, want origin and date", m)
+	}
+}
+
+func TestSyncMetaWithoutChanges(t *testing.T) {
+	dir := setMetaConfig(t)
+
+	lines := []string{"github.com ssh-rsa key1"}
+	if err := syncMeta(lines, lines, "", nil); err != nil {
+		t.Fatalf("syncMeta() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "known_hosts.meta.json")); !os.IsNotExist(err) {
+		t.Error("syncMeta() shouldn't create the file when nothing changed")
+	}
+}
+
+func TestEditMeta(t *testing.T) {
+	lines := []string{
+		"github.com ssh-rsa key1",
+		"github.com ssh-ed25519 key2",
+		"github.community ssh-rsa key3",
+	}
+	s := make(metaStore)
+
+	edited := editMeta(s, lines, metaOpts{host: "github.com", tags: []string{"prod", "git"}, note: "code", setNote: true})
+	if len(edited) != 2 {
+		t.Fatalf("editMeta() edited %d entries, want the 2 exact matches", len(edited))
+	}
+	if m, _ := s.Get(lines[1]); !reflect.DeepEqual(m.Tags, []string{"git", "prod"}) || m.Note != "code" {
+		t.Errorf("metadata = %+v, want sorted tags and note", m)
+	}
+	if _, ok := s.Get(lines[2]); ok {
+		t.Error("editMeta() must not match substrings")
+	}
+
+	editMeta(s, lines, metaOpts{host: "github.com", untags: []string{"git", "prod"}, clearNote: true})
+	if len(s) != 0 {
+		t.Errorf("emptied metadata should be removed, got %+v", s)
+	}
+}
+
+func TestFilterTag(t *testing.T) {
+	lines := []sourceLine{
+		{Text: "github.com ssh-rsa key1"},
+		{Text: "lab1.corp ssh-rsa key2"},
+	}
+	s := make(metaStore)
+	e, _ := ParseEntry(lines[1].Text)
+	s.set(e, EntryMeta{Tags: []string{"lab"}})
+
+	if got := filterTag(lines, s, ""); len(got) != 2 {
+		t.Errorf("filterTag() without tag = %v, want all lines", got)
+	}
+	if got := filterTag(lines, s, "lab"); len(got) != 1 || got[0].Text != lines[1].Text {
+		t.Errorf("filterTag(lab) = %v, want lab1.corp", got)
+	}
+}
+
+func TestTouchMeta(t *testing.T) {
+	setMetaConfig(t)
+	e := Entry{Patterns: []string{"github.com"}, KeyType: "ssh-rsa", Key: "key1"}
+
+	seen := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := touchMeta([]Entry{e}, seen); err != nil {
+		t.Fatalf("touchMeta() error = %v", err)
+	}
+
+	s, _ := loadMeta()
+	if m, _ := s.Get(e.String()); !m.LastSeen.Equal(seen) {
+		t.Errorf("LastSeen = %v, want %v", m.LastSeen, seen)
+	}
+}
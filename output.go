@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Record is the machine readable form of a known_hosts entry, used by the
+// json, csv, tsv and template output formats
+type Record struct {
+	Marker   string   `json:"marker"`
+	Patterns []string `json:"patterns"`
+	// Port is the port shared by the patterns, 22 unless they use
+	// [host]:port, and 0 (left out) when their ports differ. The patterns
+	// keep their own ports as written.
+	Port        int    `json:"port,omitempty"`
+	KeyType     string `json:"key_type"`
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment"`
+	Source      string `json:"source"`
+	Line        int    `json:"line"`
+	// Tags and Note come from the metadata file
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// recordColumns is the header of the csv and tsv formats
+var recordColumns = []string{"marker", "patterns", "port", "key_type", "key", "fingerprint", "comment", "source", "line", "tags", "note"}
+
+func newRecord(sl sourceLine) (Record, error) {
+	e, err := ParseEntry(sl.Text)
+	if err != nil {
+		return Record{}, err
+	}
+
+	_, port := splitHostPattern(e.Patterns[0])
+	for _, p := range e.Patterns[1:] {
+		if _, other := splitHostPattern(p); other != port {
+			port = 0
+			break
+		}
+	}
+
+	return Record{
+		Marker:      e.Marker,
+		Patterns:    e.Patterns,
+		Port:        port,
+		KeyType:     e.KeyType,
+		Key:         e.Key,
+		Fingerprint: e.Fingerprint(),
+		Comment:     e.Comment,
+		Source:      sl.Source,
+		Line:        sl.Line,
+	}, nil
+}
+
+// newRecords converts lines to records. Comment lines are skipped, other
+// lines that don't parse are reported through warn.
+func newRecords(lines []sourceLine, warn io.Writer) []Record {
+	records := make([]Record, 0, len(lines))
+
+	for _, sl := range lines {
+		if strings.HasPrefix(sl.Text, "#") {
+			continue
+		}
+
+		r, err := newRecord(sl)
+		if err != nil {
+			fmt.Fprintf(warn, "%s:%d: %v\n", sl.Source, sl.Line, err)
+			continue
+		}
+		records = append(records, r)
+	}
+
+	return records
+}
+
+func (r Record) fields() []string {
+	port := ""
+	if r.Port != 0 {
+		port = strconv.Itoa(r.Port)
+	}
+
+	return []string{
+		r.Marker,
+		strings.Join(r.Patterns, ","),
+		port,
+		r.KeyType,
+		r.Key,
+		r.Fingerprint,
+		r.Comment,
+		r.Source,
+		strconv.Itoa(r.Line),
+		strings.Join(r.Tags, ","),
+		r.Note,
+	}
+}
+
+// writeRecords writes records to w in one of the structured formats
+func writeRecords(w io.Writer, records []Record, format, tmpl string) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(recordColumns); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := cw.Write(r.fields()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case formatTSV:
+		// Fields never contain tabs, known_hosts lines are split on whitespace
+		if _, err := fmt.Fprintln(w, strings.Join(recordColumns, "\t")); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if _, err := fmt.Fprintln(w, strings.Join(r.fields(), "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case formatTemplate:
+		t, err := template.New("record").Funcs(template.FuncMap{"join": strings.Join}).Parse(tmpl)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		for _, r := range records {
+			if err := t.Execute(w, r); err != nil {
+				return fmt.Errorf("failed to execute template: %w", err)
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported format %q", format)
+}
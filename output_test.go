@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testRecordLines() []sourceLine {
+	return []sourceLine{
+		{Text: "# managed by hand", Source: "/tmp/known_hosts", Line: 1},
+		{Text: "github.com,140.82.112.3 ssh-rsa AAAAB3NzaC1yc2E", Source: "/tmp/known_hosts", Line: 2},
+		{Text: "@revoked [old.example.com]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 rotated 2024", Source: "/tmp/known_hosts", Line: 4},
+		{Text: "broken", Source: "/tmp/other", Line: 1},
+	}
+}
+
+func TestNewRecords(t *testing.T) {
+	var warn bytes.Buffer
+	got := newRecords(testRecordLines(), &warn)
+
+	want := []Record{
+		{
+			Patterns:    []string{"github.com", "140.82.112.3"},
+			Port:        22,
+			KeyType:     "ssh-rsa",
+			Key:         "AAAAB3NzaC1yc2E",
+			Fingerprint: Entry{Key: "AAAAB3NzaC1yc2E"}.Fingerprint(),
+			Source:      "/tmp/known_hosts",
+			Line:        2,
+		},
+		{
+			Marker:      markerRevoked,
+			Patterns:    []string{"[old.example.com]:2222"},
+			Port:        2222,
+			KeyType:     "ssh-ed25519",
+			Key:         "AAAAC3NzaC1lZDI1NTE5",
+			Fingerprint: Entry{Key: "AAAAC3NzaC1lZDI1NTE5"}.Fingerprint(),
+			Comment:     "rotated 2024",
+			Source:      "/tmp/known_hosts",
+			Line:        4,
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newRecords() = %+v\nwant %+v", got, want)
+	}
+	if !strings.Contains(warn.String(), "/tmp/other:1:") {
+		t.Errorf("newRecords() should warn about the broken line, got %q", warn.String())
+	}
+}
+
+func TestNewRecordPorts(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"a.example,b.example ssh-ed25519 AAAA", 22},
+		{"[a.example]:2222,[10.0.0.1]:2222 ssh-ed25519 AAAA", 2222},
+		{"[a.example]:2222,b.example ssh-ed25519 AAAA", 0},
+		{"a.example,[b.example]:2222 ssh-ed25519 AAAA", 0},
+	}
+
+	for _, tt := range tests {
+		r, err := newRecord(sourceLine{Text: tt.text})
+		if err != nil {
+			t.Fatalf("newRecord(%q) error = %v", tt.text, err)
+		}
+		if r.Port != tt.want {
+			t.Errorf("newRecord(%q).Port = %d, want %d", tt.text, r.Port, tt.want)
+		}
+		if f := r.fields()[2]; tt.want == 0 && f != "" {
+			t.Errorf("newRecord(%q) port column = %q, want empty", tt.text, f)
+		}
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	records := newRecords(testRecordLines(), &bytes.Buffer{})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeRecords(&buf, records, formatJSON, ""); err != nil {
+			t.Fatalf("writeRecords() error = %v", err)
+		}
+
+		var got []Record
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("json round trip = %+v, want %+v", got, records)
+		}
+		if !strings.Contains(buf.String(), `"key_type": "ssh-rsa"`) {
+			t.Errorf("json output should use snake_case keys, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeRecords(&buf, records, formatCSV, ""); err != nil {
+			t.Fatalf("writeRecords() error = %v", err)
+		}
+
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("output is not valid CSV: %v", err)
+		}
+		if len(rows) != 3 || !reflect.DeepEqual(rows[0], recordColumns) {
+			t.Fatalf("csv rows = %v, want header and 2 records", rows)
+		}
+		if rows[1][1] != "github.com,140.82.112.3" || rows[2][2] != "2222" || rows[2][8] != "4" {
+			t.Errorf("csv record fields = %v / %v", rows[1], rows[2])
+		}
+	})
+
+	t.Run("tsv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeRecords(&buf, records, formatTSV, ""); err != nil {
+			t.Fatalf("writeRecords() error = %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("tsv lines = %d, want 3", len(lines))
+		}
+		for _, l := range lines {
+			if n := len(strings.Split(l, "\t")); n != len(recordColumns) {
+				t.Errorf("tsv line %q has %d fields, want %d", l, n, len(recordColumns))
+			}
+		}
+	})
+
+	t.Run("template", func(t *testing.T) {
+		var buf bytes.Buffer
+		tmpl := `{{join .Patterns " "}} {{.Port}} {{.KeyType}}`
+		if err := writeRecords(&buf, records, formatTemplate, tmpl); err != nil {
+			t.Fatalf("writeRecords() error = %v", err)
+		}
+
+		want := "github.com 140.82.112.3 22 ssh-rsa\n[old.example.com]:2222 2222 ssh-ed25519\n"
+		if buf.String() != want {
+			t.Errorf("template output = %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		if err := writeRecords(&bytes.Buffer{}, records, formatTemplate, "{{.Nope"); err == nil {
+			t.Error("writeRecords() should reject an invalid template")
+		}
+		if err := writeRecords(&bytes.Buffer{}, records, formatTemplate, "{{.Nope}}"); err == nil {
+			t.Error("writeRecords() should report unknown fields")
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		if err := writeRecords(&bytes.Buffer{}, records, "yaml", ""); err == nil {
+			t.Error("writeRecords() should reject unknown formats")
+		}
+	})
+}
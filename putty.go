@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"crypto/dsa" //nolint:staticcheck // PuTTY still stores DSA host keys
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PuTTY host key names, as used in the SshHostKeys registry values
+const (
+	puttyRSA       = "rsa2"
+	puttyDSA       = "dss"
+	puttyEd25519   = "ssh-ed25519"
+	puttyECDSA256  = "ecdsa-sha2-nistp256"
+	puttyECDSA384  = "ecdsa-sha2-nistp384"
+	puttyECDSA521  = "ecdsa-sha2-nistp521"
+	puttyHostKeys  = `\sshhostkeys` // lower case suffix of the registry key
+	puttyRegHeader = "Windows Registry Editor Version 5.00"
+
+	// puttyHostKeysKey is the registry key PuTTY keeps its host keys in
+	puttyHostKeysKey = `HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\SshHostKeys`
+)
+
+// puttySkip is a registry value that couldn't be converted
+type puttySkip struct {
+	Name   string
+	Reason string
+}
+
+// ParsePuttyReg converts the SshHostKeys values of a PuTTY or KiTTY .reg
+// export into known_hosts entries. Both UTF-16 (regedit's default) and
+// UTF-8 exports are accepted. Values that can't be converted are returned
+// as skips rather than failing the whole file.
+func ParsePuttyReg(data []byte) (entries []Entry, skips []puttySkip, err error) {
+	text, err := decodeRegText(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inHostKeys := false
+	for _, line := range stringToLine(text) {
+		if strings.HasPrefix(line, "[") {
+			key := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			inHostKeys = !strings.HasPrefix(key, "-") && strings.HasSuffix(key, puttyHostKeys)
+			continue
+		}
+		if !inHostKeys || !strings.HasPrefix(line, `"`) {
+			continue
+		}
+
+		name, value, err := parseRegValue(line)
+		if err != nil {
+			skips = append(skips, puttySkip{Name: line, Reason: err.Error()})
+			continue
+		}
+
+		e, err := puttyValueToEntry(name, value)
+		if err != nil {
+			skips = append(skips, puttySkip{Name: name, Reason: err.Error()})
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, skips, nil
+}
+
+// decodeRegText returns the .reg content as a string, decoding UTF-16LE
+// exports by their byte order mark
+func decodeRegText(data []byte) (string, error) {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) {
+		data = data[2:]
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("invalid UTF-16 registry file")
+		}
+
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		return string(utf16.Decode(u)), nil
+	}
+
+	return string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))), nil
+}
+
+// parseRegValue parses a "name"="value" registry string value
+func parseRegValue(line string) (name, value string, err error) {
+	name, rest, err := readRegString(line)
+	if err != nil {
+		return "", "", err
+	}
+
+	rest, ok := strings.CutPrefix(rest, "=")
+	if !ok {
+		return "", "", fmt.Errorf("missing '=' in registry value")
+	}
+	if !strings.HasPrefix(rest, `"`) {
+		return "", "", fmt.Errorf("%s is not a string value", name)
+	}
+
+	value, _, err = readRegString(rest)
+	return name, value, err
+}
+
+// readRegString reads a quoted .reg string, undoing \\ and \" escapes
+func readRegString(s string) (str, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("expected quoted string")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// puttyValueToEntry converts one keytype@port:host value to an entry
+func puttyValueToEntry(name, value string) (Entry, error) {
+	keyType, rest, ok := strings.Cut(name, "@")
+	if !ok {
+		return Entry{}, fmt.Errorf("value name is not keytype@port:host")
+	}
+	portStr, host, ok := strings.Cut(rest, ":")
+	if !ok {
+		return Entry{}, fmt.Errorf("value name is not keytype@port:host")
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return Entry{}, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	// PuTTY %-escapes unusual characters of host names in registry keys
+	host, err = url.PathUnescape(host)
+	if err != nil || host == "" {
+		return Entry{}, fmt.Errorf("invalid host name")
+	}
+
+	pub, err := decodePuttyKey(keyType, value)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return entryFromPublicKey([]string{hostPattern(host, port)}, pub), nil
+}
+
+// decodePuttyKey decodes PuTTY's comma separated hex key parameters
+func decodePuttyKey(keyType, value string) (ssh.PublicKey, error) {
+	params := strings.Split(value, ",")
+
+	var (
+		pub any
+		err error
+	)
+	switch keyType {
+	case puttyRSA:
+		pub, err = decodePuttyRSA(params)
+	case puttyDSA:
+		pub, err = decodePuttyDSA(params)
+	case puttyECDSA256, puttyECDSA384, puttyECDSA521:
+		pub, err = decodePuttyECDSA(keyType, params)
+	case puttyEd25519:
+		pub, err = decodePuttyEd25519(params)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key: %w", keyType, err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key: %w", keyType, err)
+	}
+
+	// Round trip through the wire format to get OpenSSH's own validation
+	key, err = ssh.ParsePublicKey(key.Marshal())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key: %w", keyType, err)
+	}
+
+	return key, nil
+}
+
+func parsePuttyHex(params []string, want int) ([]*big.Int, error) {
+	if len(params) != want {
+		return nil, fmt.Errorf("want %d parameters, got %d", want, len(params))
+	}
+
+	out := make([]*big.Int, len(params))
+	for i, p := range params {
+		hex, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(p)), "0x")
+		if !ok {
+			return nil, fmt.Errorf("parameter %d is not 0x-prefixed hex", i+1)
+		}
+
+		n, ok := new(big.Int).SetString(hex, 16)
+		if !ok {
+			return nil, fmt.Errorf("parameter %d is not valid hex", i+1)
+		}
+		out[i] = n
+	}
+
+	return out, nil
+}
+
+func decodePuttyRSA(params []string) (*rsa.PublicKey, error) {
+	n, err := parsePuttyHex(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	if !n[0].IsInt64() || n[0].Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+
+	return &rsa.PublicKey{E: int(n[0].Int64()), N: n[1]}, nil
+}
+
+func decodePuttyDSA(params []string) (*dsa.PublicKey, error) {
+	n, err := parsePuttyHex(params, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dsa.PublicKey{
+		Parameters: dsa.Parameters{P: n[0], Q: n[1], G: n[2]},
+		Y:          n[3],
+	}, nil
+}
+
+func puttyCurve(keyType string) elliptic.Curve {
+	switch keyType {
+	case puttyECDSA256:
+		return elliptic.P256()
+	case puttyECDSA384:
+		return elliptic.P384()
+	default:
+		return elliptic.P521()
+	}
+}
+
+func decodePuttyECDSA(keyType string, params []string) (*ecdsa.PublicKey, error) {
+	if len(params) != 3 {
+		return nil, fmt.Errorf("want 3 parameters, got %d", len(params))
+	}
+
+	// The first parameter names the curve, e.g. nistp256
+	if "ecdsa-sha2-"+params[0] != keyType {
+		return nil, fmt.Errorf("curve %s doesn't match key type", params[0])
+	}
+
+	n, err := parsePuttyHex(params[1:], 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{Curve: puttyCurve(keyType), X: n[0], Y: n[1]}, nil
+}
+
+// Edwards25519 curve constants
+var (
+	ed25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	ed25519D = func() *big.Int {
+		// d = -121665/121666 mod p
+		d := new(big.Int).ModInverse(big.NewInt(121666), ed25519P)
+		d.Mul(d, big.NewInt(-121665))
+		return d.Mod(d, ed25519P)
+	}()
+)
+
+// decodePuttyEd25519 converts the affine x,y coordinates PuTTY stores into
+// the RFC 8032 encoding: y in little endian with the sign of x in the top bit
+func decodePuttyEd25519(params []string) (ed25519.PublicKey, error) {
+	n, err := parsePuttyHex(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	x, y := n[0], n[1]
+
+	if x.Cmp(ed25519P) >= 0 || y.Cmp(ed25519P) >= 0 || !onEd25519(x, y) {
+		return nil, fmt.Errorf("point is not on the curve")
+	}
+
+	be := y.FillBytes(make([]byte, ed25519.PublicKeySize))
+	key := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	for i := range be {
+		key[i] = be[len(be)-1-i]
+	}
+	if x.Bit(0) == 1 {
+		key[31] |= 0x80
+	}
+
+	return key, nil
+}
+
+// onEd25519 checks -x² + y² = 1 + d·x²·y² (mod p)
+func onEd25519(x, y *big.Int) bool {
+	x2 := new(big.Int).Mul(x, x)
+	y2 := new(big.Int).Mul(y, y)
+
+	left := new(big.Int).Sub(y2, x2)
+	left.Mod(left, ed25519P)
+
+	right := new(big.Int).Mul(x2, y2)
+	right.Mul(right, ed25519D)
+	right.Add(right, big.NewInt(1))
+	right.Mod(right, ed25519P)
+
+	return left.Cmp(right) == 0
+}
+
+// puttyValue is one exported SshHostKeys registry value
+type puttyValue struct {
+	Name  string
+	Value string
+}
+
+// ExportPutty converts known_hosts lines into PuTTY SshHostKeys values.
+// PuTTY only stores plain host names, so hashed, wildcard and marker lines
+// are returned as skips, as are key types PuTTY can't store.
+func ExportPutty(lines []string) (values []puttyValue, skips []puttySkip) {
+	seen := make(map[string]bool)
+
+	for _, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil {
+			if !strings.HasPrefix(line, "#") {
+				skips = append(skips, puttySkip{Name: line, Reason: err.Error()})
+			}
+			continue
+		}
+
+		name := strings.Join(e.Patterns, ",")
+		switch {
+		case e.Marker != "":
+			skips = append(skips, puttySkip{Name: name, Reason: e.Marker + " lines are not supported by PuTTY"})
+			continue
+		case e.Hashed():
+			skips = append(skips, puttySkip{Name: name, Reason: "hashed host names can't be recovered"})
+			continue
+		case e.Wildcard():
+			skips = append(skips, puttySkip{Name: name, Reason: "wildcard patterns are not supported by PuTTY"})
+			continue
+		}
+
+		keyType, value, err := encodePuttyKey(e)
+		if err != nil {
+			skips = append(skips, puttySkip{Name: name, Reason: err.Error()})
+			continue
+		}
+
+		for _, p := range e.Patterns {
+			host, port := splitHostPattern(p)
+			valueName := fmt.Sprintf("%s@%d:%s", keyType, port, escapePuttyHost(host))
+			if seen[valueName] {
+				skips = append(skips, puttySkip{Name: p, Reason: "PuTTY keeps only one " + e.KeyType + " key per host"})
+				continue
+			}
+			seen[valueName] = true
+			values = append(values, puttyValue{Name: valueName, Value: value})
+		}
+	}
+
+	return values, skips
+}
+
+// writePuttyReg writes values as a regedit importable file
+func writePuttyReg(w io.Writer, values []puttyValue) error {
+	lines := []string{puttyRegHeader, "", "[" + puttyHostKeysKey + "]"}
+	for _, v := range values {
+		lines = append(lines, quoteRegString(v.Name)+"="+quoteRegString(v.Value))
+	}
+	lines = append(lines, "")
+
+	// regedit expects Windows line endings whatever the platform
+	_, err := io.WriteString(w, strings.Join(lines, dosFormat)+dosFormat)
+	return err
+}
+
+func quoteRegString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// escapePuttyHost %-escapes host like PuTTY's escape_registry_key
+func escapePuttyHost(host string) string {
+	var b strings.Builder
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		if c == ' ' || c == '\\' || c == '*' || c == '?' || c == '%' ||
+			c < ' ' || c > '~' || (c == '.' && i == 0) {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// encodePuttyKey returns PuTTY's key type name and hex parameters for e
+func encodePuttyKey(e Entry) (keyType, value string, err error) {
+	blob, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid base64 key")
+	}
+
+	pub, err := ssh.ParsePublicKey(blob)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %s key: %v", e.KeyType, err)
+	}
+
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return "", "", fmt.Errorf("key type %s is not supported by PuTTY", pub.Type())
+	}
+
+	switch k := cpk.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return puttyRSA, puttyHexList(big.NewInt(int64(k.E)), k.N), nil
+	case *dsa.PublicKey:
+		return puttyDSA, puttyHexList(k.P, k.Q, k.G, k.Y), nil
+	case *ecdsa.PublicKey:
+		if pub.Type() != puttyECDSA256 && pub.Type() != puttyECDSA384 && pub.Type() != puttyECDSA521 {
+			return "", "", fmt.Errorf("key type %s is not supported by PuTTY", pub.Type())
+		}
+		curve := strings.TrimPrefix(pub.Type(), "ecdsa-sha2-")
+		return pub.Type(), curve + "," + puttyHexList(k.X, k.Y), nil
+	case ed25519.PublicKey:
+		x, y, err := ed25519Affine(k)
+		if err != nil {
+			return "", "", err
+		}
+		return puttyEd25519, puttyHexList(x, y), nil
+	}
+
+	return "", "", fmt.Errorf("key type %s is not supported by PuTTY", pub.Type())
+}
+
+func puttyHexList(params ...*big.Int) string {
+	hex := make([]string, len(params))
+	for i, p := range params {
+		hex[i] = "0x" + p.Text(16)
+	}
+
+	return strings.Join(hex, ",")
+}
+
+// ed25519Affine decompresses an RFC 8032 encoded point into the x,y
+// coordinates PuTTY stores
+func ed25519Affine(key ed25519.PublicKey) (x, y *big.Int, err error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("invalid ed25519 key size %d", len(key))
+	}
+
+	be := make([]byte, len(key))
+	for i := range key {
+		be[i] = key[len(key)-1-i]
+	}
+	sign := uint(be[0] >> 7)
+	be[0] &= 0x7f
+	y = new(big.Int).SetBytes(be)
+	if y.Cmp(ed25519P) >= 0 {
+		return nil, nil, fmt.Errorf("invalid ed25519 key")
+	}
+
+	// x² = (y² - 1) / (d·y² + 1)
+	y2 := new(big.Int).Mul(y, y)
+	u := new(big.Int).Sub(y2, big.NewInt(1))
+	v := new(big.Int).Mul(ed25519D, y2)
+	v.Add(v, big.NewInt(1))
+	x2 := new(big.Int).ModInverse(v.Mod(v, ed25519P), ed25519P)
+	x2.Mul(x2, u)
+	x2.Mod(x2, ed25519P)
+
+	// Candidate root x = x2^((p+3)/8), fixed up by sqrt(-1) when needed
+	exp := new(big.Int).Add(ed25519P, big.NewInt(3))
+	exp.Rsh(exp, 3)
+	x = new(big.Int).Exp(x2, exp, ed25519P)
+
+	check := new(big.Int).Mul(x, x)
+	if check.Mod(check, ed25519P).Cmp(x2) != 0 {
+		x.Mul(x, ed25519SqrtM1)
+		x.Mod(x, ed25519P)
+		check.Mul(x, x)
+		if check.Mod(check, ed25519P).Cmp(x2) != 0 {
+			return nil, nil, fmt.Errorf("invalid ed25519 key")
+		}
+	}
+
+	if x.Sign() == 0 && sign == 1 {
+		return nil, nil, fmt.Errorf("invalid ed25519 key")
+	}
+	if x.Bit(0) != sign {
+		x.Sub(ed25519P, x)
+	}
+
+	return x, y, nil
+}
+
+// ed25519SqrtM1 is sqrt(-1) = 2^((p-1)/4) mod p
+var ed25519SqrtM1 = func() *big.Int {
+	exp := new(big.Int).Sub(ed25519P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	return new(big.Int).Exp(big.NewInt(2), exp, ed25519P)
+}()
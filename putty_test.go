@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/dsa" //nolint:staticcheck // PuTTY still stores DSA host keys
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The Ed25519 base point, y = 4/5 with an even x
+const (
+	testEd25519X   = "0x216936d3cd6e53fec0a4e231fdd6dc5c692cc7609525a7b2c9562d608f25d51a"
+	testEd25519Y   = "0x6666666666666666666666666666666666666666666666666666666666666658"
+	testEd25519Key = "5866666666666666666666666666666666666666666666666666666666666666"
+)
+
+func puttyHex(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+func testPuttyReg(values ...string) string {
+	var b strings.Builder
+	b.WriteString(puttyRegHeader + "\r\n\r\n")
+	b.WriteString(`[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\SshHostKeys]` + "\r\n")
+	for _, v := range values {
+		b.WriteString(v + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func wantEntry(t *testing.T, pattern string, pub any) Entry {
+	t.Helper()
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert key: %v", err)
+	}
+
+	return entryFromPublicKey([]string{pattern}, key)
+}
+
+func TestParsePuttyReg(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	var dsaKey dsa.PrivateKey
+	if err := dsa.GenerateParameters(&dsaKey.Parameters, rand.Reader, dsa.L1024N160); err != nil {
+		t.Fatalf("Failed to generate DSA parameters: %v", err)
+	}
+	if err := dsa.GenerateKey(&dsaKey, rand.Reader); err != nil {
+		t.Fatalf("Failed to generate DSA key: %v", err)
+	}
+	edKey, _ := hex.DecodeString(testEd25519Key)
+
+	reg := testPuttyReg(
+		fmt.Sprintf(`"rsa2@22:github.com"="%s,%s"`, puttyHex(big.NewInt(int64(rsaKey.E))), puttyHex(rsaKey.N)),
+		fmt.Sprintf(`"ecdsa-sha2-nistp384@2222:10.0.0.1"="nistp384,%s,%s"`, puttyHex(ecKey.X), puttyHex(ecKey.Y)),
+		fmt.Sprintf(`"dss@22:old.example.com"="%s,%s,%s,%s"`, puttyHex(dsaKey.P), puttyHex(dsaKey.Q), puttyHex(dsaKey.G), puttyHex(dsaKey.Y)),
+		fmt.Sprintf(`"ssh-ed25519@22:my%%20host"="%s,%s"`, testEd25519X, testEd25519Y),
+	)
+
+	got, skips, err := ParsePuttyReg([]byte(reg))
+	if err != nil {
+		t.Fatalf("ParsePuttyReg() error = %v", err)
+	}
+	if len(skips) != 0 {
+		t.Fatalf("ParsePuttyReg() skips = %v, want none", skips)
+	}
+
+	want := []Entry{
+		wantEntry(t, "github.com", &rsaKey.PublicKey),
+		wantEntry(t, "[10.0.0.1]:2222", &ecKey.PublicKey),
+		wantEntry(t, "old.example.com", &dsaKey.PublicKey),
+		wantEntry(t, "my host", ed25519.PublicKey(edKey)),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePuttyReg() returned %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].String() != want[i].String() {
+			t.Errorf("entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParsePuttyReg_UTF16(t *testing.T) {
+	reg := testPuttyReg(fmt.Sprintf(`"ssh-ed25519@22:host"="%s,%s"`, testEd25519X, testEd25519Y))
+
+	u := utf16.Encode([]rune(reg))
+	data := []byte{0xFF, 0xFE}
+	for _, c := range u {
+		data = append(data, byte(c), byte(c>>8))
+	}
+
+	got, _, err := ParsePuttyReg(data)
+	if err != nil {
+		t.Fatalf("ParsePuttyReg() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Patterns[0] != "host" {
+		t.Errorf("ParsePuttyReg() = %v, want one entry for host", got)
+	}
+}
+
+func TestParsePuttyReg_Skips(t *testing.T) {
+	reg := testPuttyReg(
+		`"ssh-ed448@22:host"="0x1,0x2"`,
+		`"rsa2@22:host"="0x10001"`,
+		`"ssh-ed25519@22:host"="0x1,0x2"`,
+		`"ecdsa-sha2-nistp256@22:host"="nistp384,0x1,0x2"`,
+		`"rsa2@notaport:host"="0x10001,0x1"`,
+		`"nohost"="0x1"`,
+		`"rsa2@22:host"=dword:00000001`,
+	) + `[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\x]` + "\r\n" +
+		`"HostName"="ignored"` + "\r\n"
+
+	got, skips, err := ParsePuttyReg([]byte(reg))
+	if err != nil {
+		t.Fatalf("ParsePuttyReg() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ParsePuttyReg() entries = %v, want none", got)
+	}
+	if len(skips) != 7 {
+		t.Fatalf("ParsePuttyReg() skipped %d values, want 7: %v", len(skips), skips)
+	}
+	if !strings.Contains(skips[0].Reason, "unsupported key type") {
+		t.Errorf("skip reason = %q, want unsupported key type", skips[0].Reason)
+	}
+	if !strings.Contains(skips[2].Reason, "not on the curve") {
+		t.Errorf("skip reason = %q, want point validation", skips[2].Reason)
+	}
+}
+
+func TestReadRegString(t *testing.T) {
+	str, rest, err := readRegString(`"a\\b\"c"=rest`)
+	if err != nil {
+		t.Fatalf("readRegString() error = %v", err)
+	}
+	if str != `a\b"c` || rest != "=rest" {
+		t.Errorf("readRegString() = %q, %q", str, rest)
+	}
+
+	if _, _, err := readRegString(`"open`); err == nil {
+		t.Error("readRegString() should reject unterminated strings")
+	}
+}
+
+func TestExportPutty_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+
+	entries := []Entry{
+		wantEntry(t, "github.com", &rsaKey.PublicKey),
+		wantEntry(t, "[10.0.0.1]:2222", &ecKey.PublicKey),
+	}
+	// Random Ed25519 keys exercise both signs of x
+	for range 8 {
+		keyType, key := testPublicKey(t)
+		entries = append(entries, Entry{Patterns: []string{fmt.Sprintf("ed%d.example.com", len(entries))}, KeyType: keyType, Key: key})
+	}
+
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.String())
+	}
+
+	values, skips := ExportPutty(lines)
+	if len(skips) != 0 {
+		t.Fatalf("ExportPutty() skips = %v, want none", skips)
+	}
+
+	var buf strings.Builder
+	if err := writePuttyReg(&buf, values); err != nil {
+		t.Fatalf("writePuttyReg() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), puttyRegHeader+"\r\n") {
+		t.Errorf("writePuttyReg() should start with the regedit header, got %q", buf.String()[:40])
+	}
+
+	got, skips, err := ParsePuttyReg([]byte(buf.String()))
+	if err != nil || len(skips) != 0 {
+		t.Fatalf("ParsePuttyReg() error = %v, skips = %v", err, skips)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("round trip returned %d entries, want %d", len(got), len(entries))
+	}
+	for i := range entries {
+		if got[i].String() != entries[i].String() {
+			t.Errorf("round trip entry %d = %q, want %q", i, got[i], entries[i])
+		}
+	}
+}
+
+func TestExportPutty_Values(t *testing.T) {
+	edKey, _ := hex.DecodeString(testEd25519Key)
+	e := wantEntry(t, "name,[.hidden]:2222", ed25519.PublicKey(edKey))
+
+	values, skips := ExportPutty([]string{e.String()})
+	if len(skips) != 0 {
+		t.Fatalf("ExportPutty() skips = %v", skips)
+	}
+
+	want := []puttyValue{
+		{Name: "ssh-ed25519@22:name", Value: testEd25519X + "," + testEd25519Y},
+		{Name: "ssh-ed25519@2222:%2Ehidden", Value: testEd25519X + "," + testEd25519Y},
+	}
+	if len(values) != len(want) {
+		t.Fatalf("ExportPutty() = %v, want %v", values, want)
+	}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("ExportPutty()[%d] = %v, want %v", i, values[i], want[i])
+		}
+	}
+}
+
+func TestExportPutty_Skips(t *testing.T) {
+	keyType, key := testPublicKey(t)
+	hashed, _ := newHashedHost("secret.example.com")
+
+	lines := []string{
+		"# comment lines are ignored silently",
+		hashed + " " + keyType + " " + key,
+		"*.example.com " + keyType + " " + key,
+		"@cert-authority ca.example.com " + keyType + " " + key,
+		"host sk-ssh-ed25519@openssh.com AAAA",
+		"host " + keyType + " " + key,
+		"host " + keyType + " " + key,
+		"broken",
+	}
+
+	values, skips := ExportPutty(lines)
+	if len(values) != 1 {
+		t.Errorf("ExportPutty() values = %v, want only the first plain host", values)
+	}
+
+	wantReasons := []string{"hashed", "wildcard", "@cert-authority", "invalid", "only one", "invalid host"}
+	if len(skips) != len(wantReasons) {
+		t.Fatalf("ExportPutty() skips = %v, want %d", skips, len(wantReasons))
+	}
+	for i, want := range wantReasons {
+		if !strings.Contains(skips[i].Reason, want) {
+			t.Errorf("skip %d reason = %q, want %q", i, skips[i].Reason, want)
+		}
+	}
+}
+
+func TestEscapePuttyHost(t *testing.T) {
+	tests := map[string]string{
+		"github.com": "github.com",
+		"my host":    "my%20host",
+		".hidden":    "%2Ehidden",
+		"a%b*c?":     "a%25b%2Ac%3F",
+	}
+
+	for in, want := range tests {
+		if got := escapePuttyHost(in); got != want {
+			t.Errorf("escapePuttyHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query fields
+const (
+	queryHost    = "host"
+	queryType    = "type"
+	queryFP      = "fp"
+	queryPort    = "port"
+	queryMarker  = "marker"
+	queryTag     = "tag"
+	queryComment = "comment"
+)
+
+// queryFields lists the field:value terms understood by ParseQuery
+var queryFields = []string{queryHost, queryType, queryFP, queryPort, queryMarker, queryTag, queryComment}
+
+// Query is a parsed search query, a list of terms that all have to match:
+//
+//	type:ed25519 host:*.corp -tag:lab fp:SHA256:abc port:2222 marker:revoked
+//
+// Plain words are case-insensitive substrings of the host patterns. A
+// leading - or ! negates a term.
+type Query struct {
+	terms []queryTerm
+}
+
+// queryTerm is a single term of a Query. field is empty for plain words.
+type queryTerm struct {
+	field  string
+	value  string
+	negate bool
+}
+
+// ParseQuery parses a search query. Words whose prefix before the first
+// colon isn't a known field, such as IPv6 addresses, are plain words.
+func ParseQuery(s string) (q Query, err error) {
+	for _, word := range strings.Fields(s) {
+		var t queryTerm
+		if len(word) > 1 && (word[0] == '-' || word[0] == '!') {
+			t.negate = true
+			word = word[1:]
+		}
+
+		if field, value, ok := strings.Cut(word, ":"); ok && isQueryField(strings.ToLower(field)) {
+			t.field = strings.ToLower(field)
+			if t.value, err = queryValue(t.field, value); err != nil {
+				return Query{}, err
+			}
+		} else {
+			t.value = strings.ToLower(word)
+		}
+
+		q.terms = append(q.terms, t)
+	}
+
+	return q, nil
+}
+
+func isQueryField(field string) bool {
+	for _, f := range queryFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryValue validates and normalizes the value of a field term
+func queryValue(field, value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("%s: needs a value", field)
+	}
+
+	switch field {
+	case queryPort:
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q", value)
+		}
+	case queryMarker:
+		value = strings.TrimPrefix(strings.ToLower(value), "@")
+		if "@"+value != markerRevoked && "@"+value != markerCertAuthority && value != "none" {
+			return "", fmt.Errorf("unknown marker %q (want revoked, cert-authority or none)", value)
+		}
+	case queryFP:
+		// Fingerprints are base64, only the prefix is case-insensitive
+		if len(value) > len("SHA256:") && strings.EqualFold(value[:len("SHA256:")], "SHA256:") {
+			value = value[len("SHA256:"):]
+		}
+		value = "SHA256:" + value
+	case queryTag:
+		if err := validateTag(value); err != nil {
+			return "", err
+		}
+	default:
+		value = strings.ToLower(value)
+	}
+
+	return value, nil
+}
+
+// Empty reports whether the query has no terms and matches every entry
+func (q Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// Match reports whether line matches every term of q. Tags are looked up
+// in meta. Field terms never match lines that aren't host entries.
+func (q Query) Match(line string, meta metaStore) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	e, err := ParseEntry(line)
+	parsed := err == nil
+
+	for _, t := range q.terms {
+		var ok bool
+		switch {
+		case t.field == "":
+			host := fields[0]
+			if parsed {
+				host = strings.Join(e.Patterns, ",")
+			}
+			ok = strings.Contains(strings.ToLower(host), t.value)
+		case !parsed:
+			ok = false
+		default:
+			ok = t.matchEntry(e, line, meta)
+		}
+
+		if ok == t.negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchEntry matches a field term against a parsed entry
+func (t queryTerm) matchEntry(e Entry, line string, meta metaStore) bool {
+	switch t.field {
+	case queryHost:
+		return queryHostMatches(e, t.value)
+	case queryType:
+		return keyTypeMatches(e.KeyType, t.value)
+	case queryFP:
+		return strings.HasPrefix(e.Fingerprint(), t.value)
+	case queryPort:
+		if e.Hashed() {
+			return false
+		}
+		for _, p := range e.Patterns {
+			if _, port := splitHostPattern(p); strconv.Itoa(port) == t.value {
+				return true
+			}
+		}
+		return false
+	case queryMarker:
+		if t.value == "none" {
+			return e.Marker == ""
+		}
+		return e.Marker == "@"+t.value
+	case queryTag:
+		return meta.HasTag(line, t.value)
+	case queryComment:
+		return strings.Contains(strings.ToLower(e.Comment), t.value)
+	}
+
+	return false
+}
+
+// queryHostMatches matches a host: value, which may use * and ? wildcards,
+// against each pattern as written and without its [host]:port brackets.
+// Hashed patterns only match an exact host name.
+func queryHostMatches(e Entry, value string) bool {
+	for _, p := range e.Patterns {
+		if strings.HasPrefix(p, hashPrefix) {
+			if !strings.ContainsAny(value, "*?") && hashMatches(p, value) {
+				return true
+			}
+			continue
+		}
+
+		host, _ := splitHostPattern(p)
+		if wildcardMatch(value, strings.ToLower(p)) || wildcardMatch(value, strings.ToLower(host)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyTypeMatches matches a type: value against a key type, accepting the
+// short names ed25519, rsa, ecdsa and dsa
+func keyTypeMatches(keyType, value string) bool {
+	keyType = strings.ToLower(keyType)
+	if value == "dsa" {
+		value = "dss"
+	}
+
+	return keyType == value ||
+		strings.TrimPrefix(keyType, "ssh-") == value ||
+		strings.HasPrefix(keyType, value+"-")
+}
+
+// splitWords separates the plain words of q, which the TUI matches
+// fuzzily, from the field terms and negated words
+func (q Query) splitWords() (rest Query, words []string) {
+	for _, t := range q.terms {
+		if t.field == "" && !t.negate {
+			words = append(words, t.value)
+			continue
+		}
+		rest.terms = append(rest.terms, t)
+	}
+
+	return rest, words
+}
+
+// Filter returns the lines of input matching q
+func (q Query) Filter(input []string, meta metaStore) []string {
+	var out []string
+	for _, line := range input {
+		if q.Match(line, meta) {
+			out = append(out, line)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []queryTerm
+		wantErr string
+	}{
+		{query: "", want: nil},
+		{query: "GitHub", want: []queryTerm{{value: "github"}}},
+		{
+			query: "type:ED25519 -tag:lab !host:*.corp",
+			want: []queryTerm{
+				{field: queryType, value: "ed25519"},
+				{field: queryTag, value: "lab", negate: true},
+				{field: queryHost, value: "*.corp", negate: true},
+			},
+		},
+		{query: "fp:SHA256:AbC", want: []queryTerm{{field: queryFP, value: "SHA256:AbC"}}},
+		{query: "fp:AbC", want: []queryTerm{{field: queryFP, value: "SHA256:AbC"}}},
+		{query: "marker:@Revoked", want: []queryTerm{{field: queryMarker, value: "revoked"}}},
+		{query: "fe80::1", want: []queryTerm{{value: "fe80::1"}}},
+		{query: "-", want: []queryTerm{{value: "-"}}},
+		{query: "port:", wantErr: "needs a value"},
+		{query: "port:ssh", wantErr: "invalid port"},
+		{query: "port:70000", wantErr: "invalid port"},
+		{query: "marker:trusted", wantErr: "unknown marker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseQuery() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if len(q.terms) != len(tt.want) {
+				t.Fatalf("ParseQuery() = %+v, want %+v", q.terms, tt.want)
+			}
+			for i := range tt.want {
+				if q.terms[i] != tt.want[i] {
+					t.Errorf("term %d = %+v, want %+v", i, q.terms[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	hashed := hashHost("secret.corp", []byte("0123456789abcdefghij"))
+	lines := map[string]string{
+		"db":      "db1.corp,10.0.0.1 ssh-ed25519 AAAA db primary",
+		"web":     "[WEB.corp]:2222 ssh-rsa BBBB",
+		"github":  "github.com ecdsa-sha2-nistp256 CCCC",
+		"revoked": "@revoked old.corp ssh-rsa DDDD",
+		"ca":      "@cert-authority *.corp ssh-ed25519 EEEE",
+		"hashed":  hashed + " ssh-ed25519 FFFF",
+		"comment": "# db1.corp",
+	}
+	meta := metaStore{}
+	key, _ := lineMetaKey(lines["db"])
+	meta[key] = EntryMeta{Tags: []string{"prod", "lab"}}
+	key, _ = lineMetaKey(lines["web"])
+	meta[key] = EntryMeta{Tags: []string{"prod"}}
+
+	dbFP, _ := ParseEntry(lines["db"])
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"db", "web", "github", "revoked", "ca", "hashed", "comment"}},
+		{query: "CORP", want: []string{"db", "web", "revoked", "ca"}},
+		{query: "db1", want: []string{"db"}},
+		{query: "-db1", want: []string{"web", "github", "revoked", "ca", "hashed", "comment"}},
+		{query: "type:ed25519", want: []string{"db", "ca", "hashed"}},
+		{query: "type:ecdsa", want: []string{"github"}},
+		{query: "type:ssh-rsa", want: []string{"web", "revoked"}},
+		{query: "host:*.corp", want: []string{"db", "web", "revoked", "ca"}},
+		{query: "host:10.0.0.*", want: []string{"db"}},
+		{query: "host:secret.corp", want: []string{"hashed"}},
+		{query: "host:secret.*", want: nil},
+		{query: "port:2222", want: []string{"web"}},
+		{query: "port:22 type:ed25519", want: []string{"db", "ca"}},
+		{query: "marker:revoked", want: []string{"revoked"}},
+		{query: "marker:cert-authority", want: []string{"ca"}},
+		{query: "marker:none corp", want: []string{"db", "web"}},
+		{query: "tag:prod", want: []string{"db", "web"}},
+		{query: "tag:prod -tag:lab", want: []string{"web"}},
+		{query: "fp:" + dbFP.Fingerprint()[:12], want: []string{"db"}},
+		{query: "comment:Primary", want: []string{"db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			var got []string
+			for _, name := range []string{"db", "web", "github", "revoked", "ca", "hashed", "comment"} {
+				if q.Match(lines[name], meta) {
+					got = append(got, name)
+				}
+			}
+			if !slicesEqual(got, tt.want) {
+				t.Errorf("Match() selected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// removeOpts are the options of rm
+type removeOpts struct {
+	hosts    []string
+	fromFile string
+	stdin    bool
+	glob     bool
+	regex    bool
+	cidr     string
+	query    string
+	dryRun   bool
+	yes      bool
+}
+
+// removeMatch is an rm pattern and the lines it selected
+type removeMatch struct {
+	Pattern string
+	Lines   []string
+}
+
+// lineMatcher reports whether a known_hosts line is selected by a pattern
+type lineMatcher func(line string) bool
+
+// exactMatcher selects the lines deleteMatches removes for pattern: the
+// exact full line or the exact host part, never a substring
+func exactMatcher(pattern string) lineMatcher {
+	return func(line string) bool {
+		_, removed := deleteMatches([]string{line}, pattern)
+		return len(removed) > 0
+	}
+}
+
+// hostNameMatcher selects the lines with a host matching match. Each
+// pattern of the line is tried as written and without its [host]:port
+// brackets. Hashed hosts can't be matched by name.
+func hostNameMatcher(match func(host string) bool) lineMatcher {
+	return func(line string) bool {
+		e, err := ParseEntry(line)
+		if err != nil || e.Hashed() {
+			return false
+		}
+
+		for _, p := range e.Patterns {
+			host, _ := splitHostPattern(p)
+			if match(p) || match(host) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// queryMatcher selects the lines matching a search query, looking up
+// tags in the metadata
+func queryMatcher(query string) (lineMatcher, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	if q.Empty() {
+		return nil, fmt.Errorf("--query cannot be empty")
+	}
+
+	meta, err := loadMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(line string) bool { return q.Match(line, meta) }, nil
+}
+
+// newLineMatcher returns the matcher of one rm pattern
+func newLineMatcher(pattern string, opt removeOpts) (lineMatcher, error) {
+	switch {
+	case opt.query != "":
+		return queryMatcher(pattern)
+	case opt.glob:
+		return hostNameMatcher(func(host string) bool { return wildcardMatch(pattern, host) }), nil
+	case opt.regex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		return hostNameMatcher(re.MatchString), nil
+	}
+
+	return exactMatcher(pattern), nil
+}
+
+// planRemove splits lines into the remaining lines and the lines selected
+// by each pattern. A line matched by several patterns is reported once,
+// under the first of them.
+func planRemove(lines, patterns []string, opt removeOpts) (remaining []string, matches []removeMatch, err error) {
+	matchers := make([]lineMatcher, len(patterns))
+	for i, p := range patterns {
+		if matchers[i], err = newLineMatcher(p, opt); err != nil {
+			return nil, nil, err
+		}
+		matches = append(matches, removeMatch{Pattern: p})
+	}
+
+	for _, line := range lines {
+		removed := false
+		for i, match := range matchers {
+			if line != "" && match(line) {
+				matches[i].Lines = append(matches[i].Lines, line)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			remaining = append(remaining, line)
+		}
+	}
+
+	return remaining, matches, nil
+}
+
+// readPatternList reads one rm pattern per line, skipping blank lines and
+// # comments
+func readPatternList(name string) ([]string, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host list: %w", err)
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := validateHost(line); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, nil
+}
+
+// addressStrip is a name,ip line rewritten without the addresses of a
+// removed range
+type addressStrip struct {
+	Old string
+	New string
+}
+
+// patternAddr returns the address of a host pattern, if it is one
+func patternAddr(pattern string) (netip.Addr, bool) {
+	host, _ := splitHostPattern(pattern)
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.WithZone("").Unmap(), true
+}
+
+// planRemoveCIDR drops the lines whose hosts are all addresses in prefix
+// and strips the addresses in prefix from the other lines. Hashed lines
+// are left alone.
+func planRemoveCIDR(lines []string, prefix netip.Prefix) (remaining, removed []string, stripped []addressStrip) {
+	for _, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil || e.Hashed() {
+			remaining = append(remaining, line)
+			continue
+		}
+
+		var kept []string
+		for _, p := range e.Patterns {
+			if addr, ok := patternAddr(p); ok && prefix.Contains(addr) {
+				continue
+			}
+			kept = append(kept, p)
+		}
+
+		switch {
+		case len(kept) == 0:
+			removed = append(removed, line)
+		case len(kept) < len(e.Patterns):
+			e.Patterns = kept
+			stripped = append(stripped, addressStrip{Old: line, New: e.String()})
+			remaining = append(remaining, e.String())
+		default:
+			remaining = append(remaining, line)
+		}
+	}
+
+	return remaining, removed, stripped
+}
+
+// printStripped lists the lines that keep their names after verb
+func printStripped(w io.Writer, verb string, stripped []addressStrip) {
+	fmt.Fprintf(w, "%s %d %s:\n", verb, len(stripped), plural(len(stripped), "entry", "entries"))
+	for _, s := range stripped {
+		fmt.Fprintf(w, "~ %s -> %s\n", displayHostIdentifier(s.Old), displayHostIdentifier(s.New))
+	}
+}
+
+// runRemoveCIDR removes the addresses of a range, confirming first when
+// more than one entry changes
+func runRemoveCIDR(hosts []string, opt removeOpts) {
+	prefix, err := netip.ParsePrefix(opt.cidr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid CIDR %q: %v\n", opt.cidr, err)
+		os.Exit(1)
+	}
+	prefix = prefix.Masked()
+
+	remaining, removed, stripped := planRemoveCIDR(hosts, prefix)
+	matches := []removeMatch{{Pattern: prefix.String(), Lines: removed}}
+	n := len(removed) + len(stripped)
+	if n == 0 {
+		printUnmatched(os.Stdout, matches, opt.dryRun)
+		return
+	}
+
+	show := func(removeVerb, stripVerb string) {
+		if len(removed) > 0 {
+			printRemoved(os.Stdout, removeVerb, matches)
+		}
+		if len(stripped) > 0 {
+			printStripped(os.Stdout, stripVerb, stripped)
+		}
+	}
+
+	if opt.dryRun {
+		show("Dry run: would remove", "Dry run: would strip addresses from")
+		return
+	}
+
+	if n > 1 && !opt.yes {
+		show("Would remove", "Would strip addresses from")
+		question := fmt.Sprintf("Change %d %s?", n, plural(n, "entry", "entries"))
+		if !confirm(os.Stdin, os.Stdout, question) {
+			fmt.Println("Removal cancelled")
+			os.Exit(1)
+		}
+	}
+
+	if err := SaveFile(remaining); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to delete host: %v\n", err)
+		os.Exit(1)
+	}
+	renamed := make(map[string]string)
+	for _, s := range stripped {
+		renamed[s.Old] = s.New
+	}
+	if err := syncMeta(hosts, remaining, "", renamed); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	show("Removed", "Stripped addresses from")
+}
+
+// removedCount is the number of lines selected by all patterns
+func removedCount(matches []removeMatch) int {
+	n := 0
+	for _, m := range matches {
+		n += len(m.Lines)
+	}
+
+	return n
+}
+
+// printUnmatched reports the patterns that selected no line
+func printUnmatched(w io.Writer, matches []removeMatch, dryRun bool) {
+	for _, m := range matches {
+		if len(m.Lines) > 0 {
+			continue
+		}
+		if dryRun {
+			fmt.Fprintln(w, "Dry run: no matching hosts would be removed for:", m.Pattern)
+		} else {
+			fmt.Fprintln(w, "No matching hosts for:", m.Pattern)
+		}
+	}
+}
+
+// printRemoved lists the lines selected by the patterns after verb, such
+// as "Removed" or "Dry run: would remove"
+func printRemoved(w io.Writer, verb string, matches []removeMatch) {
+	n := removedCount(matches)
+	fmt.Fprintf(w, "%s %d %s:\n", verb, n, plural(n, "entry", "entries"))
+	for _, m := range matches {
+		for _, line := range m.Lines {
+			keyType := ""
+			if fields := strings.Fields(line); len(fields) > 1 {
+				keyType = " " + fields[1]
+			}
+			fmt.Fprintf(w, "- %s%s\n", displayHostIdentifier(line), keyType)
+		}
+	}
+}
+
+// needsConfirmation reports whether a pattern selected more than one line
+func needsConfirmation(matches []removeMatch) bool {
+	for _, m := range matches {
+		if len(m.Lines) > 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runRemove deletes the lines selected by the rm patterns. Removing more
+// than one entry with a single glob, regex or query needs confirmation
+// unless --yes is given; exact hosts are removed with all of their keys
+// like before.
+func runRemove(hosts []string, opt removeOpts) {
+	if opt.cidr != "" {
+		runRemoveCIDR(hosts, opt)
+		return
+	}
+
+	patterns := opt.hosts
+	if opt.query != "" {
+		patterns = []string{opt.query}
+	}
+	if opt.fromFile != "" || opt.stdin {
+		name := opt.fromFile
+		if opt.stdin {
+			name = "-"
+		}
+		list, err := readPatternList(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		patterns = append(append([]string(nil), patterns...), list...)
+	}
+	if len(patterns) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no hosts to remove")
+		os.Exit(1)
+	}
+
+	remaining, matches, err := planRemove(hosts, patterns, opt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printUnmatched(os.Stdout, matches, opt.dryRun)
+	n := removedCount(matches)
+	if n == 0 {
+		return
+	}
+	if opt.dryRun {
+		printRemoved(os.Stdout, "Dry run: would remove", matches)
+		return
+	}
+
+	exact := !opt.glob && !opt.regex && opt.query == ""
+	if !exact && needsConfirmation(matches) && !opt.yes {
+		if opt.stdin {
+			fmt.Fprintln(os.Stderr, "Error: a pattern matches several entries, confirm with --yes when reading hosts from stdin")
+			os.Exit(1)
+		}
+		printRemoved(os.Stdout, "Would remove", matches)
+		question := fmt.Sprintf("Remove %d %s?", n, plural(n, "entry", "entries"))
+		if !confirm(os.Stdin, os.Stdout, question) {
+			fmt.Println("Removal cancelled")
+			os.Exit(1)
+		}
+	}
+
+	if exact {
+		for _, m := range matches {
+			if len(m.Lines) > 0 {
+				fmt.Println("Removing host:", m.Pattern)
+			}
+		}
+	}
+
+	if err := SaveFile(remaining); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to delete host: %v\n", err)
+		os.Exit(1)
+	}
+	if err := syncMeta(hosts, remaining, "", nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !exact {
+		printRemoved(os.Stdout, "Removed", matches)
+	}
+}
+
+// previewDelete prints the entries rm --dry-run host would remove
+func previewDelete(hosts []string, host string) {
+	runRemove(hosts, removeOpts{hosts: []string{host}, dryRun: true})
+}
+
+// deleteHost removes every entry of host
+func deleteHost(hosts []string, host string) {
+	runRemove(hosts, removeOpts{hosts: []string{host}})
+}
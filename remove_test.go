@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRemove(t *testing.T) {
+	lines := []string{
+		"web1.staging.corp,10.1.0.1 ssh-ed25519 key1",
+		"web2.staging.corp ssh-ed25519 key2",
+		"[db.staging.corp]:2222 ssh-rsa key3",
+		"staging.corp ssh-ed25519 key4",
+		"github.com ssh-ed25519 key5",
+		"# keep this comment",
+		"|1|c2FsdA==|aGFzaA== ssh-ed25519 key6",
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		opt      removeOpts
+		want     [][]string
+	}{
+		{
+			name:     "exact match is the default",
+			patterns: []string{"staging.corp", "github.com"},
+			want:     [][]string{{lines[3]}, {lines[4]}},
+		},
+		{
+			name:     "exact never matches substrings",
+			patterns: []string{"web1.staging.corp", "*.staging.corp"},
+			want:     [][]string{nil, nil},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"*.staging.corp"},
+			opt:      removeOpts{glob: true},
+			want:     [][]string{{lines[0], lines[1], lines[2]}},
+		},
+		{
+			name:     "glob on ip",
+			patterns: []string{"10.1.0.?"},
+			opt:      removeOpts{glob: true},
+			want:     [][]string{{lines[0]}},
+		},
+		{
+			name:     "regex",
+			patterns: []string{`^web\d\.`, `^github`},
+			opt:      removeOpts{regex: true},
+			want:     [][]string{{lines[0], lines[1]}, {lines[4]}},
+		},
+		{
+			name:     "line reported under first pattern",
+			patterns: []string{"web*", "*.staging.corp"},
+			opt:      removeOpts{glob: true},
+			want:     [][]string{{lines[0], lines[1]}, {lines[2]}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, matches, err := planRemove(lines, tt.patterns, tt.opt)
+			if err != nil {
+				t.Fatalf("planRemove() error = %v", err)
+			}
+
+			var got [][]string
+			removed := 0
+			for _, m := range matches {
+				got = append(got, m.Lines)
+				removed += len(m.Lines)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planRemove() matches = %q, want %q", got, tt.want)
+			}
+			if len(remaining) != len(lines)-removed {
+				t.Errorf("planRemove() kept %d lines, want %d", len(remaining), len(lines)-removed)
+			}
+		})
+	}
+
+	if _, _, err := planRemove(lines, []string{"("}, removeOpts{regex: true}); err == nil {
+		t.Error("planRemove() should reject an invalid regex")
+	}
+}
+
+func TestNeedsConfirmation(t *testing.T) {
+	if needsConfirmation([]removeMatch{{Lines: []string{"a"}}, {Lines: []string{"b"}}}) {
+		t.Error("one entry per pattern shouldn't need confirmation")
+	}
+	if !needsConfirmation([]removeMatch{{Lines: []string{"a", "b"}}}) {
+		t.Error("several entries for a pattern should need confirmation")
+	}
+}
+
+func TestReadPatternList(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hosts.txt")
+	writeTestFile(t, name, "# decommissioned\nweb1.staging.corp\n\n  web2.staging.corp  \r\n")
+
+	got, err := readPatternList(name)
+	if err != nil {
+		t.Fatalf("readPatternList() error = %v", err)
+	}
+	if want := []string{"web1.staging.corp", "web2.staging.corp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readPatternList() = %q, want %q", got, want)
+	}
+}
+
+func TestRunRemoveSeveralHosts(t *testing.T) {
+	tmpDir := t.TempDir()
+	setConfig(t, Config{Files: []string{filepath.Join(tmpDir, "known_hosts")}, Hash: hashNever})
+
+	hosts := []string{
+		"web1.staging.corp ssh-ed25519 key1",
+		"web2.staging.corp ssh-ed25519 key2",
+		"github.com ssh-ed25519 key3",
+	}
+	list := filepath.Join(tmpDir, "hosts.txt")
+	writeTestFile(t, list, "web2.staging.corp\n")
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	runRemove(hosts, removeOpts{hosts: []string{"web1.staging.corp", "gone.example.com"}, fromFile: list})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	for _, want := range []string{"No matching hosts for: gone.example.com", "Removing host: web1.staging.corp", "Removing host: web2.staging.corp"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("runRemove() output should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	got, _ := ReadFile()
+	if len(got) != 1 || got[0] != hosts[2] {
+		t.Errorf("known_hosts = %q, want only github.com", got)
+	}
+}
+
+func TestPlanRemoveCIDR(t *testing.T) {
+	lines := []string{
+		"10.42.0.5 ssh-ed25519 key1",
+		"[10.42.3.9]:2222 ssh-ed25519 key2",
+		"web1.corp,10.42.1.7 ssh-ed25519 key3 web",
+		"web2.corp,10.43.0.1 ssh-ed25519 key4",
+		"10.42.0.6,10.43.0.2 ssh-rsa key5",
+		"2001:db8:42::1 ssh-ed25519 key6",
+		"v6.corp,2001:db8:42::2 ssh-ed25519 key7",
+		"@revoked 10.42.0.8 ssh-rsa key8",
+		"|1|c2FsdA==|aGFzaA== ssh-ed25519 key9",
+		"# 10.42.0.10",
+	}
+
+	tests := []struct {
+		name         string
+		cidr         string
+		wantRemoved  []string
+		wantStripped []addressStrip
+	}{
+		{
+			name:        "ipv4",
+			cidr:        "10.42.0.0/16",
+			wantRemoved: []string{lines[0], lines[1], lines[7]},
+			wantStripped: []addressStrip{
+				{Old: lines[2], New: "web1.corp ssh-ed25519 key3 web"},
+				{Old: lines[4], New: "10.43.0.2 ssh-rsa key5"},
+			},
+		},
+		{
+			name:         "ipv6",
+			cidr:         "2001:db8:42::/48",
+			wantRemoved:  []string{lines[5]},
+			wantStripped: []addressStrip{{Old: lines[6], New: "v6.corp ssh-ed25519 key7"}},
+		},
+		{
+			name:        "single address",
+			cidr:        "10.42.0.5/32",
+			wantRemoved: []string{lines[0]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, removed, stripped := planRemoveCIDR(lines, netip.MustParsePrefix(tt.cidr))
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("planRemoveCIDR() removed = %q, want %q", removed, tt.wantRemoved)
+			}
+			if !reflect.DeepEqual(stripped, tt.wantStripped) {
+				t.Errorf("planRemoveCIDR() stripped = %q, want %q", stripped, tt.wantStripped)
+			}
+			if len(remaining) != len(lines)-len(removed) {
+				t.Errorf("planRemoveCIDR() kept %d lines, want %d", len(remaining), len(lines)-len(removed))
+			}
+		})
+	}
+}
+
+func TestRunRemoveCIDRDryRun(t *testing.T) {
+	hosts := []string{
+		"10.42.0.5 ssh-ed25519 key1",
+		"web1.corp,10.42.1.7 ssh-ed25519 key2",
+	}
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	runRemove(hosts, removeOpts{cidr: "10.42.0.0/16", dryRun: true})
+	runRemove(hosts, removeOpts{cidr: "192.168.0.0/24", dryRun: true})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	for _, want := range []string{
+		"Dry run: would remove 1 entry:\n- 10.42.0.5 ssh-ed25519",
+		"Dry run: would strip addresses from 1 entry:\n~ web1.corp, 10.42.1.7 -> web1.corp",
+		"Dry run: no matching hosts would be removed for: 192.168.0.0/24",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("runRemove() output should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunRemoveQuery(t *testing.T) {
+	setMetaConfig(t)
+
+	hosts := []string{
+		"web1.corp ssh-dss key1",
+		"web2.corp ssh-dss key2",
+		"lab.corp ssh-dss key3",
+		"web1.corp ssh-ed25519 key4",
+	}
+	meta := metaStore{}
+	e, _ := ParseEntry(hosts[2])
+	meta.set(e, EntryMeta{Tags: []string{"lab"}})
+	if err := saveMeta(meta); err != nil {
+		t.Fatal(err)
+	}
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	runRemove(hosts, removeOpts{query: "type:dsa -tag:lab", yes: true})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	if !strings.Contains(buf.String(), "Removed 2 entries:") {
+		t.Errorf("runRemove() output = %q", buf.String())
+	}
+
+	got, _ := ReadFile()
+	if !slicesEqual(got, hosts[2:]) {
+		t.Errorf("known_hosts = %q, want %q", got, hosts[2:])
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultScanTimeout     = 5 * time.Second
+	defaultScanConcurrency = 16
+)
+
+// scanKeyTypes maps the -t names of ssh-keyscan to the host key algorithms
+// offered for them, one handshake per list. Every ECDSA curve is a key of
+// its own, while the RSA algorithms all sign with the same key.
+var scanKeyTypes = map[string][][]string{
+	"rsa":     {{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+	"ecdsa":   {{ssh.KeyAlgoECDSA256}, {ssh.KeyAlgoECDSA384}, {ssh.KeyAlgoECDSA521}},
+	"ed25519": {{ssh.KeyAlgoED25519}},
+	"dsa":     {{ssh.InsecureKeyAlgoDSA}},
+}
+
+// defaultScanTypes are the key types fetched when --type isn't given
+var defaultScanTypes = []string{"rsa", "ecdsa", "ed25519"}
+
+// scanOpts are the options of scan
+type scanOpts struct {
+	targets     []string
+	types       []string
+	timeout     time.Duration
+	concurrency int
+	network     string // tcp, tcp4 or tcp6
+	hash        bool
+	append      bool
+	dryRun      bool
+}
+
+// scanTarget is a host to scan
+type scanTarget struct {
+	Host string
+	Port int
+}
+
+// Addr returns the dial address of t
+func (t scanTarget) Addr() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// parseScanTarget parses host, host:port, [host]:port or a bare IPv6
+// address
+func parseScanTarget(s string) (scanTarget, error) {
+	t := scanTarget{Host: s, Port: defaultSSHPort}
+
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return t, fmt.Errorf("invalid port in %q", s)
+		}
+		t.Host, t.Port = host, n
+	} else if strings.Count(s, ":") < 2 && strings.Contains(s, ":") {
+		return t, fmt.Errorf("invalid host %q: %v", s, err)
+	}
+
+	t.Host = strings.Trim(t.Host, "[]")
+	if t.Host == "" {
+		return t, fmt.Errorf("invalid host %q", s)
+	}
+
+	return t, nil
+}
+
+// scanResult is the key of one type fetched from a target, or the error
+type scanResult struct {
+	Target scanTarget
+	Type   string
+	Key    ssh.PublicKey
+	Err    error
+}
+
+// errHostKeyReceived aborts the handshake once the host key is known
+var errHostKeyReceived = errors.New("host key received")
+
+// fetchHostKey runs an SSH key exchange with addr offering only algs and
+// returns the host key the server proves it owns. A nil key and error
+// means the server has no key of those algorithms.
+func fetchHostKey(network, addr string, algs []string, timeout time.Duration) (ssh.PublicKey, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              "known_hosts",
+		HostKeyAlgorithms: algs,
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKeyReceived
+		},
+		Timeout: timeout,
+	}
+
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if key != nil {
+		return key, nil
+	}
+
+	var negotiation *ssh.AlgorithmNegotiationError
+	if errors.As(err, &negotiation) && negotiation.What == "host key" {
+		return nil, nil
+	}
+
+	return nil, err
+}
+
+// scanHosts fetches every key type of every target, running at most
+// opt.concurrency handshakes at a time. Results keep the order of targets
+// and types; types a server doesn't have are left out.
+func scanHosts(targets []scanTarget, opt scanOpts) []scanResult {
+	type job struct {
+		index  int
+		target scanTarget
+		typ    string
+		algs   []string
+	}
+
+	var jobs []job
+	for _, t := range targets {
+		for _, typ := range opt.types {
+			for _, algs := range scanKeyTypes[typ] {
+				jobs = append(jobs, job{len(jobs), t, typ, algs})
+			}
+		}
+	}
+
+	results := make([]scanResult, len(jobs))
+	sem := make(chan struct{}, max(opt.concurrency, 1))
+	var wg sync.WaitGroup
+
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			key, err := fetchHostKey(opt.network, j.target.Addr(), j.algs, opt.timeout)
+			results[j.index] = scanResult{Target: j.target, Type: j.typ, Key: key, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return slices.DeleteFunc(results, func(r scanResult) bool { return r.Key == nil && r.Err == nil })
+}
+
+// scanEntries turns the fetched keys into entries and returns the targets
+// that failed. The same key is only listed once per target.
+func scanEntries(results []scanResult) (entries []Entry, failed map[scanTarget]error) {
+	failed = make(map[scanTarget]error)
+	found := make(map[scanTarget]bool)
+
+	for _, r := range results {
+		if r.Err != nil {
+			if _, ok := failed[r.Target]; !ok {
+				failed[r.Target] = r.Err
+			}
+			continue
+		}
+
+		e := entryFromPublicKey([]string{hostPattern(r.Target.Host, r.Target.Port)}, r.Key)
+		if !slices.ContainsFunc(entries, func(x Entry) bool { return x.String() == e.String() }) {
+			entries = append(entries, e)
+		}
+		found[r.Target] = true
+	}
+
+	// A target is only failed when no key type worked
+	for t := range found {
+		delete(failed, t)
+	}
+
+	return entries, failed
+}
+
+// runScan prints the keys of the targets, or appends them to hosts
+func runScan(hosts []string, opt scanOpts) {
+	var targets []scanTarget
+	for _, s := range opt.targets {
+		t, err := parseScanTarget(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, t)
+	}
+
+	entries, failed := scanEntries(scanHosts(targets, opt))
+	for _, t := range targets {
+		if err, ok := failed[t]; ok {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", t.Addr(), err)
+		}
+	}
+
+	if opt.append {
+		report, err := addEntries(hosts, entries, cmdScan, opt.hash || cfg.Hash == hashAlways, opt.dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printMergeReport(os.Stdout, report, opt.dryRun)
+		if len(report.Conflicts) > 0 {
+			os.Exit(1)
+		}
+	} else {
+		for _, e := range entries {
+			written := []Entry{e}
+			if opt.hash {
+				var err error
+				if written, err = hashEntry(e); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			for _, w := range written {
+				fmt.Println(w)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer runs an in-process SSH server with the given host keys
+// and returns its target
+func startSSHServer(t *testing.T, hostKeys ...ssh.Signer) scanTarget {
+	t.Helper()
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	for _, k := range hostKeys {
+		config.AddHostKey(k)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// The scanner aborts after the key exchange
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	return scanTarget{Host: "127.0.0.1", Port: port}
+}
+
+func testECDSASigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	return testECDSASignerCurve(t, elliptic.P384())
+}
+
+func testECDSASignerCurve(t *testing.T, curve elliptic.Curve) ssh.Signer {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	return signer
+}
+
+func testScanOpts() scanOpts {
+	return scanOpts{
+		types:       defaultScanTypes,
+		timeout:     5 * time.Second,
+		concurrency: 4,
+		network:     "tcp",
+	}
+}
+
+func TestParseScanTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    scanTarget
+		wantErr bool
+	}{
+		{in: "example.com", want: scanTarget{"example.com", 22}},
+		{in: "example.com:2222", want: scanTarget{"example.com", 2222}},
+		{in: "[example.com]:2222", want: scanTarget{"example.com", 2222}},
+		{in: "10.0.0.1", want: scanTarget{"10.0.0.1", 22}},
+		{in: "::1", want: scanTarget{"::1", 22}},
+		{in: "[::1]:2222", want: scanTarget{"::1", 2222}},
+		{in: "[::1]", want: scanTarget{"::1", 22}},
+		{in: "example.com:ssh", wantErr: true},
+		{in: "example.com:70000", wantErr: true},
+		{in: ":22", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseScanTarget(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScanTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseScanTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanHosts(t *testing.T) {
+	ed, _ := testSigner(t)
+	ec := testECDSASigner(t)
+	target := startSSHServer(t, ed, ec)
+
+	t.Run("fetches every offered key type", func(t *testing.T) {
+		entries, failed := scanEntries(scanHosts([]scanTarget{target}, testScanOpts()))
+		if len(failed) != 0 {
+			t.Fatalf("scanEntries() failed = %v", failed)
+		}
+
+		pattern := "[127.0.0.1]:" + strconv.Itoa(target.Port)
+		want := []Entry{
+			entryFromPublicKey([]string{pattern}, ec.PublicKey()),
+			entryFromPublicKey([]string{pattern}, ed.PublicKey()),
+		}
+		if !reflect.DeepEqual(entries, want) {
+			t.Errorf("scanEntries() = %v, want %v", entries, want)
+		}
+	})
+
+	t.Run("selected type", func(t *testing.T) {
+		opt := testScanOpts()
+		opt.types = []string{"ed25519"}
+
+		entries, _ := scanEntries(scanHosts([]scanTarget{target}, opt))
+		if len(entries) != 1 || entries[0].KeyType != ssh.KeyAlgoED25519 {
+			t.Errorf("scanEntries() = %v, want only the ed25519 key", entries)
+		}
+	})
+
+	t.Run("every ecdsa curve", func(t *testing.T) {
+		p256 := testECDSASignerCurve(t, elliptic.P256())
+		p521 := testECDSASignerCurve(t, elliptic.P521())
+		curves := startSSHServer(t, p256, ec, p521)
+		opt := testScanOpts()
+		opt.types = []string{"ecdsa"}
+
+		entries, _ := scanEntries(scanHosts([]scanTarget{curves}, opt))
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.KeyType)
+		}
+		want := []string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("scanEntries() key types = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("type the server lacks is not an error", func(t *testing.T) {
+		opt := testScanOpts()
+		opt.types = []string{"rsa"}
+
+		results := scanHosts([]scanTarget{target}, opt)
+		if len(results) != 0 {
+			t.Errorf("scanHosts() = %v, want nothing", results)
+		}
+	})
+
+	t.Run("order is kept with limited concurrency", func(t *testing.T) {
+		other := startSSHServer(t, ed)
+		opt := testScanOpts()
+		opt.concurrency = 1
+
+		results := scanHosts([]scanTarget{other, target, other}, opt)
+		var got []scanTarget
+		for _, r := range results {
+			got = append(got, r.Target)
+		}
+		want := []scanTarget{other, target, target, other}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("scanHosts() order = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("unreachable host", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		closed := scanTarget{"127.0.0.1", l.Addr().(*net.TCPAddr).Port}
+		l.Close()
+
+		entries, failed := scanEntries(scanHosts([]scanTarget{closed, target}, testScanOpts()))
+		if _, ok := failed[closed]; !ok || len(failed) != 1 {
+			t.Errorf("scanEntries() failed = %v, want only the closed port", failed)
+		}
+		if len(entries) != 2 {
+			t.Errorf("scanEntries() = %v, want the keys of the reachable host", entries)
+		}
+	})
+
+	t.Run("ipv6 only", func(t *testing.T) {
+		opt := testScanOpts()
+		opt.network = "tcp6"
+
+		_, failed := scanEntries(scanHosts([]scanTarget{target}, opt))
+		if _, ok := failed[target]; !ok {
+			t.Error("scanHosts() should not reach an IPv4 address over tcp6")
+		}
+	})
+}
+
+func TestFetchHostKeyTimeout(t *testing.T) {
+	// A server that accepts but never speaks
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = fetchHostKey("tcp", l.Addr().String(), scanKeyTypes["ed25519"][0], 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("fetchHostKey() should time out")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("fetchHostKey() took %v, want about the timeout", time.Since(start))
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshsigMagic   = "SSHSIG"
+	sshsigVersion = 1
+	sshsigBegin   = "-----BEGIN SSH SIGNATURE-----"
+	sshsigEnd     = "-----END SSH SIGNATURE-----"
+
+	// defaultSigNamespace is the namespace ssh-keygen -Y sign -n file uses
+	defaultSigNamespace = "file"
+
+	optionNamespaces    = "namespaces"
+	optionValidAfter    = "valid-after"
+	optionValidBefore   = "valid-before"
+	optionCertAuthority = "cert-authority"
+)
+
+// sigOpts are the signature flags shared by verify-signature and the
+// commands that import a file
+type sigOpts struct {
+	require        bool
+	signature      string
+	allowedSigners string
+	namespace      string
+	identity       string
+}
+
+// verify reports whether the input has to be verified: --require-signature
+// or one of the flags naming what to verify against was given
+func (o sigOpts) verify() bool {
+	return o.require || o.signature != "" || o.allowedSigners != "" || o.identity != ""
+}
+
+// sshSignature is a decoded SSHSIG blob, see PROTOCOL.sshsig
+type sshSignature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+// parseSSHSig decodes an armored ssh-keygen -Y sign signature
+func parseSSHSig(armored []byte) (*sshSignature, error) {
+	text := strings.TrimSpace(strings.ReplaceAll(string(armored), "\r\n", "\n"))
+	if !strings.HasPrefix(text, sshsigBegin) || !strings.HasSuffix(text, sshsigEnd) {
+		return nil, fmt.Errorf("not an SSH signature")
+	}
+
+	body := strings.Join(strings.Fields(text[len(sshsigBegin):len(text)-len(sshsigEnd)]), "")
+	blob, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if !bytes.HasPrefix(blob, []byte(sshsigMagic)) {
+		return nil, fmt.Errorf("invalid signature: missing %s preamble", sshsigMagic)
+	}
+
+	var raw struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob[len(sshsigMagic):], &raw); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if raw.Version != sshsigVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", raw.Version)
+	}
+
+	pub, err := ssh.ParsePublicKey(raw.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature key: %w", err)
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(raw.Signature, sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	return &sshSignature{
+		PublicKey:     pub,
+		Namespace:     raw.Namespace,
+		HashAlgorithm: raw.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// signedData returns the bytes an SSHSIG signature covers for message
+func signedData(namespace, hashAlgorithm string, message []byte) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported signature hash %q", hashAlgorithm)
+	}
+	h.Write(message)
+
+	data := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", hashAlgorithm, h.Sum(nil)})
+
+	return append([]byte(sshsigMagic), data...), nil
+}
+
+// allowedSigner is a line of an ssh-keygen ALLOWED SIGNERS file:
+//
+//	principals [options] keytype base64-key [comment]
+type allowedSigner struct {
+	Principals  string
+	Namespaces  string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Key         ssh.PublicKey
+}
+
+// parseAllowedSigners parses an allowed signers file. Any malformed line is
+// an error, the file decides what we trust.
+func parseAllowedSigners(data []byte) ([]allowedSigner, error) {
+	var signers []allowedSigner
+
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		signers = append(signers, s)
+	}
+
+	return signers, nil
+}
+
+func parseAllowedSigner(line string) (s allowedSigner, err error) {
+	// Like ssh-keygen, principals are either quoted or end at the first
+	// space or tab
+	var rest string
+	if quoted, ok := strings.CutPrefix(line, `"`); ok {
+		end := strings.IndexByte(quoted, '"')
+		if end < 0 {
+			return s, fmt.Errorf("unterminated quoted principals")
+		}
+		s.Principals, rest = quoted[:end], quoted[end+1:]
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			return s, fmt.Errorf("missing space after the quoted principals")
+		}
+	} else if end := strings.IndexAny(line, " \t"); end >= 0 {
+		s.Principals, rest = line[:end], line[end:]
+	} else {
+		s.Principals = line
+	}
+	if s.Principals == "" {
+		return s, fmt.Errorf("principals cannot be empty")
+	}
+	rest = strings.TrimSpace(rest)
+
+	// Options and key use the authorized_keys syntax
+	k, err := ParseAuthorizedKey(rest)
+	if err != nil {
+		return s, err
+	}
+
+	for _, o := range k.Options {
+		name, _, _ := strings.Cut(o, "=")
+		switch strings.ToLower(name) {
+		case optionNamespaces:
+			s.Namespaces, _ = k.Option(optionNamespaces)
+		case optionValidAfter, optionValidBefore:
+			v, _ := k.Option(name)
+			t, err := parseSSHTime(v)
+			if err != nil {
+				return s, fmt.Errorf("%s: %w", name, err)
+			}
+			if strings.EqualFold(name, optionValidAfter) {
+				s.ValidAfter = t
+			} else {
+				s.ValidBefore = t
+			}
+		case optionCertAuthority:
+			return s, fmt.Errorf("%s signers are not supported", optionCertAuthority)
+		default:
+			return s, fmt.Errorf("unknown option %q", o)
+		}
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return s, fmt.Errorf("invalid base64 key: %w", err)
+	}
+	if s.Key, err = ssh.ParsePublicKey(blob); err != nil {
+		return s, fmt.Errorf("invalid %s key: %w", k.KeyType, err)
+	}
+
+	return s, nil
+}
+
+// verifySignature checks that armored is a valid signature of message in
+// namespace by a key of signers. When identity is set, it must be one of
+// the principals of that key. It returns the principals of the signer.
+func verifySignature(message, armored []byte, signers []allowedSigner, identity, namespace string, now time.Time) (string, ssh.PublicKey, error) {
+	sig, err := parseSSHSig(armored)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, ok := sig.PublicKey.(*ssh.Certificate); ok {
+		return "", nil, fmt.Errorf("certificate signatures are not supported")
+	}
+	if sig.Namespace != namespace {
+		return "", nil, fmt.Errorf("signature namespace %q doesn't match %q", sig.Namespace, namespace)
+	}
+	// Like ssh-keygen, refuse RSA signatures made with SHA-1
+	if sig.PublicKey.Type() == ssh.KeyAlgoRSA &&
+		sig.Signature.Format != ssh.KeyAlgoRSASHA256 && sig.Signature.Format != ssh.KeyAlgoRSASHA512 {
+		return "", nil, fmt.Errorf("RSA signature algorithm %q is not allowed, want %s or %s",
+			sig.Signature.Format, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512)
+	}
+
+	data, err := signedData(sig.Namespace, sig.HashAlgorithm, message)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := sig.PublicKey.Verify(data, sig.Signature); err != nil {
+		return "", nil, fmt.Errorf("bad signature: %w", err)
+	}
+
+	fp := ssh.FingerprintSHA256(sig.PublicKey)
+	for _, s := range signers {
+		if !bytes.Equal(s.Key.Marshal(), sig.PublicKey.Marshal()) {
+			continue
+		}
+		if identity != "" && !matchPatternList(s.Principals, identity) {
+			continue
+		}
+		if s.Namespaces != "" && !matchPatternList(s.Namespaces, namespace) {
+			continue
+		}
+		if !s.ValidAfter.IsZero() && now.Before(s.ValidAfter) {
+			continue
+		}
+		if !s.ValidBefore.IsZero() && now.After(s.ValidBefore) {
+			continue
+		}
+
+		principal := s.Principals
+		if identity != "" {
+			principal = identity
+		}
+		return principal, sig.PublicKey, nil
+	}
+
+	return "", nil, fmt.Errorf("signing key %s is not an allowed signer", fp)
+}
+
+// checkSignature verifies the signature of data read from name according
+// to opt. The signature defaults to name.sig, as written by ssh-keygen -Y
+// sign, and the allowed signers to the configured file.
+func checkSignature(name string, data []byte, opt sigOpts) (string, error) {
+	sigFile := opt.signature
+	if sigFile == "" {
+		if name == "-" {
+			return "", fmt.Errorf("--signature is required when reading stdin")
+		}
+		sigFile = name + ".sig"
+	}
+
+	signersFile := opt.allowedSigners
+	if signersFile == "" {
+		signersFile = cfg.AllowedSigners
+	}
+	if signersFile == "" {
+		return "", fmt.Errorf("--allowed-signers is required to verify signatures")
+	}
+	signersFile, err := expandPath(signersFile)
+	if err != nil {
+		return "", err
+	}
+
+	armored, err := os.ReadFile(sigFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	signersData, err := os.ReadFile(signersFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+	signers, err := parseAllowedSigners(signersData)
+	if err != nil {
+		return "", fmt.Errorf("invalid allowed signers %s: %w", signersFile, err)
+	}
+
+	namespace := opt.namespace
+	if namespace == "" {
+		namespace = defaultSigNamespace
+	}
+
+	principal, pub, err := verifySignature(data, armored, signers, opt.identity, namespace, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("signature verification failed for %s: %w", name, err)
+	}
+
+	return fmt.Sprintf("Good %q signature for %s by %s with %s key %s",
+		namespace, name, principal, pub.Type(), ssh.FingerprintSHA256(pub)), nil
+}
+
+// verifyInput reads name and, when opt asks for verification, refuses to
+// return the data unless its signature checks out
+func verifyInput(name string, opt sigOpts) ([]byte, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if !opt.verify() {
+		return data, nil
+	}
+
+	msg, err := checkSignature(name, data, opt)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, msg)
+
+	return data, nil
+}
+
+// runVerifySignature implements verify-signature file sigfile
+func runVerifySignature(file string, opt sigOpts) {
+	data, err := readInput(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read %s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	msg, err := checkSignature(file, data, opt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(msg)
+}
+
+// addSignatureFlags registers the signature flags on fs
+func addSignatureFlags(fs *flag.FlagSet, opt *sigOpts) {
+	fs.StringVar(&opt.allowedSigners, "allowed-signers", "", "ssh-keygen allowed signers file")
+	fs.StringVar(&opt.namespace, "namespace", "", "signature namespace, defaults to "+defaultSigNamespace)
+	fs.StringVar(&opt.identity, "identity", "", "required signer principal")
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Generated with ssh-keygen -Y sign -f alice -n file team
+const (
+	testSigMessage = "github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl\n"
+	testSignature  = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgH3KE9aSxr+F1fhWVejrerChFLe
+AfUWa2S8SLn8FkyVUAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAED0XqIU3UpUCk1x3BGhtzUrvupYp6JtCjCnQ23/3WB0J9p4CZGq02StgRnH7vjnDK
+gZ4o0TRM0pn73uMEzH/MoN
+-----END SSH SIGNATURE-----
+`
+	testSignerKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB9yhPWksa/hdX4VlXo63qwoRS3gH1FmtkvEi5/BZMlV"
+)
+
+// signSSHSig signs message like ssh-keygen -Y sign does
+func signSSHSig(t *testing.T, signer ssh.Signer, namespace string, message []byte) []byte {
+	t.Helper()
+
+	h := sha512.Sum512(message)
+	data := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{namespace, "", "sha512", h[:]})...)
+
+	sig, err := signer.Sign(rand.Reader, data)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{sshsigVersion, signer.PublicKey().Marshal(), namespace, "", "sha512", ssh.Marshal(sig)})...)
+
+	enc := base64.StdEncoding.EncodeToString(blob)
+	return []byte(sshsigBegin + "\n" + enc + "\n" + sshsigEnd + "\n")
+}
+
+func testSigner(t *testing.T) (ssh.Signer, string) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	return signer, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func mustParseAllowedSigners(t *testing.T, data string) []allowedSigner {
+	t.Helper()
+
+	signers, err := parseAllowedSigners([]byte(data))
+	if err != nil {
+		t.Fatalf("parseAllowedSigners() error = %v", err)
+	}
+
+	return signers
+}
+
+func TestVerifySignatureOpenSSH(t *testing.T) {
+	signers := mustParseAllowedSigners(t, "alice@corp "+testSignerKey+"\n")
+
+	principal, pub, err := verifySignature([]byte(testSigMessage), []byte(testSignature), signers, "", defaultSigNamespace, time.Now())
+	if err != nil {
+		t.Fatalf("verifySignature() error = %v", err)
+	}
+	if principal != "alice@corp" {
+		t.Errorf("verifySignature() principal = %q", principal)
+	}
+	if fp := ssh.FingerprintSHA256(pub); fp != "SHA256:hzTMYmP+Hse+WMBkk4R6DgaK8wc9t5/tylTE1PtS2nE" {
+		t.Errorf("verifySignature() key = %s", fp)
+	}
+
+	tampered := strings.Replace(testSigMessage, "AAAAC3", "AAAAC4", 1)
+	if _, _, err := verifySignature([]byte(tampered), []byte(testSignature), signers, "", defaultSigNamespace, time.Now()); err == nil {
+		t.Error("verifySignature() accepted a tampered file")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer, line := testSigner(t)
+	_, other := testSigner(t)
+	message := []byte("a ssh-rsa AAAA\n")
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		signers   string
+		identity  string
+		namespace string
+		sigNS     string
+		wantErr   string
+	}{
+		{name: "allowed", signers: "ops@corp " + line},
+		{name: "wildcard principal and identity", signers: "*@corp " + line, identity: "bob@corp"},
+		{name: "identity mismatch", signers: "ops@corp " + line, identity: "bob@corp", wantErr: "not an allowed signer"},
+		{name: "negated identity", signers: "*@corp,!bob@corp " + line, identity: "bob@corp", wantErr: "not an allowed signer"},
+		{name: "unknown key", signers: "ops@corp " + other, wantErr: "not an allowed signer"},
+		{name: "wrong namespace", signers: "ops@corp " + line, sigNS: "git", wantErr: "namespace"},
+		{name: "namespaces option", signers: `ops@corp namespaces="file,git" ` + line},
+		{name: "namespace not allowed", signers: `ops@corp namespaces="git" ` + line, wantErr: "not an allowed signer"},
+		{name: "valid window", signers: `ops@corp valid-after="20250101",valid-before="20260101" ` + line},
+		{name: "expired signer", signers: `ops@corp valid-before="20250101Z" ` + line, wantErr: "not an allowed signer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sigNS := tt.sigNS
+			if sigNS == "" {
+				sigNS = defaultSigNamespace
+			}
+			sig := signSSHSig(t, signer, sigNS, message)
+
+			_, _, err := verifySignature(message, sig, mustParseAllowedSigners(t, tt.signers), tt.identity, defaultSigNamespace, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifySignature() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifySignature() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// algorithmSigner signs with a fixed algorithm
+type algorithmSigner struct {
+	ssh.AlgorithmSigner
+	algorithm string
+}
+
+func (s algorithmSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, s.algorithm)
+}
+
+func TestVerifySignatureRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	signers := mustParseAllowedSigners(t, "ops@corp "+line+"\n")
+	message := []byte("a ssh-rsa AAAA\n")
+
+	tests := []struct {
+		algorithm string
+		wantErr   bool
+	}{
+		{algorithm: ssh.KeyAlgoRSASHA256},
+		{algorithm: ssh.KeyAlgoRSASHA512},
+		{algorithm: ssh.KeyAlgoRSA, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			s := algorithmSigner{signer.(ssh.AlgorithmSigner), tt.algorithm}
+			sig := signSSHSig(t, s, defaultSigNamespace, message)
+
+			_, _, err := verifySignature(message, sig, signers, "", defaultSigNamespace, time.Now())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "not allowed") {
+					t.Fatalf("verifySignature() error = %v, want SHA-1 refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySignature() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseSSHSig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not armored", data: "hello"},
+		{name: "bad base64", data: sshsigBegin + "\n!!!\n" + sshsigEnd},
+		{name: "wrong preamble", data: sshsigBegin + "\n" + base64.StdEncoding.EncodeToString([]byte("NOTSIG")) + "\n" + sshsigEnd},
+		{name: "truncated", data: sshsigBegin + "\n" + base64.StdEncoding.EncodeToString([]byte(sshsigMagic)) + "\n" + sshsigEnd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSSHSig([]byte(tt.data)); err == nil {
+				t.Error("parseSSHSig() should fail")
+			}
+		})
+	}
+
+	if sig, err := parseSSHSig([]byte(strings.ReplaceAll(testSignature, "\n", "\r\n"))); err != nil || sig.Namespace != "file" {
+		t.Errorf("parseSSHSig() = %+v, %v", sig, err)
+	}
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{name: "comments and blank lines", data: "# team\n\nalice@corp " + testSignerKey + " laptop\n", want: 1},
+		{name: "quoted principals", data: `"alice@corp,bob@corp" ` + testSignerKey, want: 1},
+		{name: "quoted principals with spaces", data: `"alice smith@corp" namespaces="file" ` + testSignerKey, want: 1},
+		{name: "tab after principals", data: "alice@corp\t" + testSignerKey, want: 1},
+		{name: "unterminated quote", data: `"alice@corp ` + testSignerKey, wantErr: true},
+		{name: "empty principals", data: `"" ` + testSignerKey, wantErr: true},
+		{name: "cert authority", data: "*@corp cert-authority " + testSignerKey, wantErr: true},
+		{name: "unknown option", data: "alice@corp no-touch " + testSignerKey, wantErr: true},
+		{name: "bad time", data: `alice@corp valid-before="soon" ` + testSignerKey, wantErr: true},
+		{name: "bad key", data: "alice@corp ssh-ed25519 AAAA", wantErr: true},
+		{name: "missing key", data: "alice@corp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAllowedSigners([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAllowedSigners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseAllowedSigners() = %d signers, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyInput(t *testing.T) {
+	setConfig(t, defaultConfig())
+	dir := t.TempDir()
+
+	team := filepath.Join(dir, "team")
+	signers := filepath.Join(dir, "allowed_signers")
+	writeTestFile(t, team, testSigMessage)
+	writeTestFile(t, team+".sig", testSignature)
+	writeTestFile(t, signers, "alice@corp "+testSignerKey+"\n")
+
+	opt := sigOpts{require: true, allowedSigners: signers}
+
+	t.Run("default signature path", func(t *testing.T) {
+		data, err := verifyInput(team, opt)
+		if err != nil {
+			t.Fatalf("verifyInput() error = %v", err)
+		}
+		if string(data) != testSigMessage {
+			t.Errorf("verifyInput() = %q", data)
+		}
+	})
+
+	t.Run("allowed signers from config", func(t *testing.T) {
+		c := defaultConfig()
+		c.AllowedSigners = signers
+		setConfig(t, c)
+
+		if _, err := verifyInput(team, sigOpts{require: true}); err != nil {
+			t.Fatalf("verifyInput() error = %v", err)
+		}
+	})
+
+	t.Run("tampered file", func(t *testing.T) {
+		tampered := filepath.Join(dir, "tampered")
+		writeTestFile(t, tampered, testSigMessage+"evil.example.com ssh-ed25519 AAAA\n")
+		writeTestFile(t, tampered+".sig", testSignature)
+
+		if _, err := verifyInput(tampered, opt); err == nil || !strings.Contains(err.Error(), "bad signature") {
+			t.Fatalf("verifyInput() error = %v, want bad signature", err)
+		}
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		unsigned := filepath.Join(dir, "unsigned")
+		writeTestFile(t, unsigned, testSigMessage)
+
+		if _, err := verifyInput(unsigned, opt); err == nil {
+			t.Fatal("verifyInput() accepted an unsigned file")
+		}
+	})
+
+	t.Run("stdin needs explicit signature", func(t *testing.T) {
+		if _, err := checkSignature("-", []byte(testSigMessage), opt); err == nil {
+			t.Fatal("checkSignature() should require --signature for stdin")
+		}
+	})
+
+	t.Run("no allowed signers", func(t *testing.T) {
+		setConfig(t, defaultConfig())
+		if _, err := verifyInput(team, sigOpts{require: true}); err == nil {
+			t.Fatal("verifyInput() should require allowed signers")
+		}
+	})
+
+	t.Run("signature flag verifies without --require-signature", func(t *testing.T) {
+		unsigned := filepath.Join(dir, "given")
+		writeTestFile(t, unsigned, testSigMessage)
+		writeTestFile(t, unsigned+".sig", "not a signature")
+
+		for _, o := range []sigOpts{{signature: unsigned + ".sig", allowedSigners: signers}, {allowedSigners: signers}} {
+			if _, err := verifyInput(unsigned, o); err == nil {
+				t.Errorf("verifyInput(%+v) accepted an invalid signature", o)
+			}
+		}
+	})
+
+	t.Run("not required", func(t *testing.T) {
+		unsigned := filepath.Join(dir, "plain")
+		writeTestFile(t, unsigned, testSigMessage)
+
+		if _, err := verifyInput(unsigned, sigOpts{}); err != nil {
+			t.Fatalf("verifyInput() error = %v", err)
+		}
+	})
+}
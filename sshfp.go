@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// SSHFP fingerprint types, RFC 4255 and RFC 6594
+const (
+	sshfpSHA1   uint8 = 1
+	sshfpSHA256 uint8 = 2
+)
+
+// sshfpAlgorithms maps key types to SSHFP algorithm numbers (RFC 4255,
+// 6594, 7479 and 8709). Every ECDSA curve uses algorithm 3.
+var sshfpAlgorithms = map[string]uint8{
+	"ssh-rsa":             1,
+	"ssh-dss":             2,
+	"ecdsa-sha2-nistp256": 3,
+	"ecdsa-sha2-nistp384": 3,
+	"ecdsa-sha2-nistp521": 3,
+	"ssh-ed25519":         4,
+	"ssh-ed448":           6,
+}
+
+// sshfpRecord is one SSHFP resource record
+type sshfpRecord struct {
+	Host        string
+	Algorithm   uint8
+	Type        uint8
+	Fingerprint string // lowercase hex
+}
+
+// String formats r like ssh-keygen -r
+func (r sshfpRecord) String() string {
+	return fmt.Sprintf("%s IN SSHFP %d %d %s", r.Host, r.Algorithm, r.Type, r.Fingerprint)
+}
+
+// sshfpSkip is a host that got no SSHFP records and why
+type sshfpSkip struct {
+	Name   string
+	Reason string
+}
+
+// sshfpFingerprint hashes the key blob for fingerprint type fpType
+func sshfpFingerprint(key string, fpType uint8) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 key: %w", err)
+	}
+
+	switch fpType {
+	case sshfpSHA1:
+		sum := sha1.Sum(blob)
+		return hex.EncodeToString(sum[:]), nil
+	case sshfpSHA256:
+		sum := sha256.Sum256(blob)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	return "", fmt.Errorf("unsupported SSHFP fingerprint type %d", fpType)
+}
+
+// entrySSHFP returns the SHA1 and SHA256 records of e for host
+func entrySSHFP(e Entry, host string) ([]sshfpRecord, error) {
+	alg, ok := sshfpAlgorithms[e.KeyType]
+	if !ok {
+		return nil, fmt.Errorf("key type %s has no SSHFP algorithm", e.KeyType)
+	}
+
+	var records []sshfpRecord
+	for _, fpType := range []uint8{sshfpSHA1, sshfpSHA256} {
+		fp, err := sshfpFingerprint(e.Key, fpType)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, sshfpRecord{Host: host, Algorithm: alg, Type: fpType, Fingerprint: fp})
+	}
+
+	return records, nil
+}
+
+// sshfpHost returns the DNS name of pattern, or a reason it has none
+func sshfpHost(pattern string) (string, string) {
+	switch {
+	case strings.HasPrefix(pattern, hashPrefix):
+		return "", "hashed host"
+	case strings.ContainsAny(pattern, "*?!"):
+		return "", "wildcard pattern"
+	}
+
+	host, _ := splitHostPattern(pattern)
+	if net.ParseIP(host) != nil {
+		return "", "IP address"
+	}
+
+	return host, ""
+}
+
+// SSHFPRecords builds the SSHFP records of the entries in lines. When
+// hosts isn't empty only those names are included. Marker lines, hashed
+// hosts, wildcards, IP addresses and key types without an SSHFP algorithm
+// are skipped.
+func SSHFPRecords(lines []string, hosts []string) (records []sshfpRecord, skips []sshfpSkip) {
+	for _, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil {
+			continue
+		}
+
+		for _, p := range e.Patterns {
+			host, reason := sshfpHost(p)
+			if len(hosts) > 0 && !slices.Contains(hosts, host) {
+				continue
+			}
+
+			switch {
+			case reason != "":
+				skips = append(skips, sshfpSkip{Name: p, Reason: reason})
+				continue
+			case e.Marker != "":
+				skips = append(skips, sshfpSkip{Name: p, Reason: e.Marker + " line"})
+				continue
+			}
+
+			rr, err := entrySSHFP(e, host)
+			if err != nil {
+				skips = append(skips, sshfpSkip{Name: p, Reason: err.Error()})
+				continue
+			}
+			for _, r := range rr {
+				if !slices.Contains(records, r) {
+					records = append(records, r)
+				}
+			}
+		}
+	}
+
+	return records, skips
+}
+
+// runSSHFP prints the SSHFP records of hosts, or of every entry
+func runSSHFP(lines []sourceLine, hosts []string) {
+	texts := make([]string, len(lines))
+	for i, sl := range lines {
+		texts[i] = sl.Text
+	}
+
+	records, skips := SSHFPRecords(texts, hosts)
+	for _, r := range records {
+		fmt.Println(r)
+	}
+
+	for _, s := range skips {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", s.Name, s.Reason)
+	}
+
+	missing := false
+	for _, h := range hosts {
+		if !slices.ContainsFunc(records, func(r sshfpRecord) bool { return r.Host == h }) {
+			fmt.Fprintf(os.Stderr, "No SSHFP records for %s\n", h)
+			missing = true
+		}
+	}
+	if missing {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSSHFPRecords(t *testing.T) {
+	// Expected records from ssh-keygen -r
+	lines := []string{
+		"server.example.com,10.0.0.1 " + testSignerKey + " alice@corp",
+		"db.example.com ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQDE8Y7EKUoATFB8N7PHqv3ZKpXJPx7I/CMjU8VI3RGMSxvi6y+IYtCz8bZ3/7Oy93YSdsHK1t9GtFZd/vZedZX1wVqGIIa5lTEWue2Xk+bsIGsZkNFRMhYtrqxzF61vhddbBifOkm6jmaNPU6Mn0o5+NBNXPqh2SpOvIBIJA7ZqVQ==",
+		"|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs= " + testSignerKey,
+		"*.example.com " + testSignerKey,
+		"@cert-authority ca.example.com " + testSignerKey,
+		"sk.example.com sk-ssh-ed25519@openssh.com AAAA",
+		"# comment",
+	}
+	server := []sshfpRecord{
+		{"server.example.com", 4, 1, "9e60c0aa81119f41de82de59db993c340772d593"},
+		{"server.example.com", 4, 2, "8734cc6263fe1ec7be58c06493847a0e068af3073db79fedca54c4d4fb52da71"},
+	}
+	db := []sshfpRecord{
+		{"db.example.com", 1, 1, "df83a441263767b6077210465a286d1d55943428"},
+		{"db.example.com", 1, 2, "1efb2df79fea1a1798e3a3f5cf0f64dbb364bdcbdeeaca188301dc3b05966f13"},
+	}
+
+	t.Run("all hosts", func(t *testing.T) {
+		records, skips := SSHFPRecords(lines, nil)
+		if want := append(append([]sshfpRecord{}, server...), db...); !reflect.DeepEqual(records, want) {
+			t.Errorf("SSHFPRecords() = %v, want %v", records, want)
+		}
+
+		var skipped []string
+		for _, s := range skips {
+			skipped = append(skipped, s.Name)
+		}
+		want := []string{"10.0.0.1", lines[2][:strings.Index(lines[2], " ")], "*.example.com", "ca.example.com", "sk.example.com"}
+		if !reflect.DeepEqual(skipped, want) {
+			t.Errorf("SSHFPRecords() skipped = %v, want %v", skipped, want)
+		}
+	})
+
+	t.Run("selected host", func(t *testing.T) {
+		records, skips := SSHFPRecords(lines, []string{"db.example.com"})
+		if !reflect.DeepEqual(records, db) {
+			t.Errorf("SSHFPRecords() = %v, want %v", records, db)
+		}
+		if len(skips) != 0 {
+			t.Errorf("SSHFPRecords() skips = %v, want none", skips)
+		}
+	})
+
+	t.Run("duplicate lines", func(t *testing.T) {
+		records, _ := SSHFPRecords([]string{lines[0], lines[0]}, []string{"server.example.com"})
+		if !reflect.DeepEqual(records, server) {
+			t.Errorf("SSHFPRecords() = %v, want %v", records, server)
+		}
+	})
+
+	t.Run("non-default port", func(t *testing.T) {
+		records, _ := SSHFPRecords([]string{"[server.example.com]:2222 " + testSignerKey}, nil)
+		if !reflect.DeepEqual(records, server) {
+			t.Errorf("SSHFPRecords() = %v, want %v", records, server)
+		}
+	})
+}
+
+func TestSSHFPRecordString(t *testing.T) {
+	r := sshfpRecord{"db.example.com", 1, 2, "abcd"}
+	if got, want := r.String(), "db.example.com IN SSHFP 1 2 abcd"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Results of resolving the name of a name,ip entry
+const (
+	staleUnresolvable = "unresolvable"
+	staleChanged      = "changed"
+	staleError        = "error"
+)
+
+// staleOpts are the options of stale
+type staleOpts struct {
+	resolver string
+	timeout  time.Duration
+	fix      bool
+	yes      bool
+}
+
+// addrLookup returns the addresses of host, see dnsClient.lookupAddrs
+type addrLookup func(host string) ([]netip.Addr, error)
+
+// systemLookup resolves names like ssh does, through the system resolver
+// which applies the search domains of resolv.conf and /etc/hosts. A name
+// without addresses isn't an error.
+func systemLookup(timeout time.Duration) addrLookup {
+	return func(host string) ([]netip.Addr, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+
+		return addrs, err
+	}
+}
+
+// qualifiedLookup refuses single-label names, which a single DNS server
+// can't resolve without the search domains of the system resolver. They
+// are reported as errors and never pruned.
+func qualifiedLookup(lookup addrLookup) addrLookup {
+	return func(host string) ([]netip.Addr, error) {
+		if !strings.Contains(strings.TrimSuffix(host, "."), ".") {
+			return nil, fmt.Errorf("short name needs the search domains of the system resolver, run stale without --resolver")
+		}
+
+		return lookup(host)
+	}
+}
+
+// staleEntry is a name,ip line whose recorded addresses DNS no longer
+// confirms
+type staleEntry struct {
+	Index   int // index in the known_hosts lines
+	Entry   Entry
+	Names   []string
+	Stale   []string // patterns of the addresses DNS doesn't return
+	Current []netip.Addr
+	Status  string
+	Err     error
+}
+
+// String formats s for the stale output
+func (s staleEntry) String() string {
+	var addrs []string
+	for _, p := range s.Entry.Patterns {
+		if _, ok := patternAddr(p); ok {
+			addrs = append(addrs, p)
+		}
+	}
+
+	line := fmt.Sprintf("%-12s %s %s", s.Status, strings.Join(s.Names, ","), strings.Join(addrs, ","))
+	switch s.Status {
+	case staleChanged:
+		current := make([]string, len(s.Current))
+		for i, a := range s.Current {
+			current[i] = a.String()
+		}
+		line += " -> " + strings.Join(current, ",")
+	case staleError:
+		line += ": " + s.Err.Error()
+	}
+
+	return line
+}
+
+// FindStale resolves the names of every unhashed name,ip entry and returns
+// the entries whose names don't resolve or no longer resolve to all of the
+// recorded addresses. Each name is looked up once.
+func FindStale(lines []string, lookup addrLookup) []staleEntry {
+	type result struct {
+		addrs []netip.Addr
+		err   error
+	}
+	cache := make(map[string]result)
+
+	var found []staleEntry
+	for i, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil || e.Hashed() || e.Wildcard() {
+			continue
+		}
+
+		var names, addrPatterns []string
+		var addrs []netip.Addr
+		for _, p := range e.Patterns {
+			if addr, ok := patternAddr(p); ok {
+				addrPatterns = append(addrPatterns, p)
+				addrs = append(addrs, addr)
+				continue
+			}
+			host, _ := splitHostPattern(p)
+			names = append(names, host)
+		}
+		if len(names) == 0 || len(addrs) == 0 {
+			continue
+		}
+
+		s := staleEntry{Index: i, Entry: e, Names: names}
+		for _, name := range names {
+			r, ok := cache[name]
+			if !ok {
+				r.addrs, r.err = lookup(name)
+				cache[name] = r
+			}
+			if r.err != nil {
+				s.Err = r.err
+				break
+			}
+			for _, a := range r.addrs {
+				if a = a.Unmap(); !slices.Contains(s.Current, a) {
+					s.Current = append(s.Current, a)
+				}
+			}
+		}
+
+		switch {
+		case s.Err != nil:
+			s.Status = staleError
+		case len(s.Current) == 0:
+			s.Status = staleUnresolvable
+		default:
+			for j, a := range addrs {
+				if !slices.Contains(s.Current, a) {
+					s.Stale = append(s.Stale, addrPatterns[j])
+				}
+			}
+			if len(s.Stale) == 0 {
+				continue
+			}
+			s.Status = staleChanged
+		}
+
+		found = append(found, s)
+	}
+
+	return found
+}
+
+// fixStale removes the lines of unresolvable names and strips the
+// addresses that changed from the others. The new addresses aren't added,
+// DNS alone doesn't vouch for the key of an address.
+func fixStale(lines []string, found []staleEntry) (out []string, pruned int, renamed map[string]string) {
+	drop := make(map[int]bool)
+	rewrite := make(map[int]string)
+	renamed = make(map[string]string)
+	for _, s := range found {
+		switch s.Status {
+		case staleUnresolvable:
+			drop[s.Index] = true
+			pruned++
+		case staleChanged:
+			e := s.Entry
+			e.Patterns = slices.DeleteFunc(slices.Clone(e.Patterns), func(p string) bool { return slices.Contains(s.Stale, p) })
+			rewrite[s.Index] = e.String()
+			renamed[lines[s.Index]] = e.String()
+		}
+	}
+
+	for i, line := range lines {
+		switch {
+		case drop[i]:
+		case rewrite[i] != "":
+			out = append(out, rewrite[i])
+		default:
+			out = append(out, line)
+		}
+	}
+
+	return out, pruned, renamed
+}
+
+// runStale prints the stale name,ip entries and, with --fix, prunes or
+// rewrites them after confirmation. Without --fix it exits with 1 when an
+// entry is stale.
+func runStale(hosts []string, opt staleOpts) {
+	server := opt.resolver
+	if server == "" {
+		server = cfg.Resolver
+	}
+	lookup := systemLookup(opt.timeout)
+	if server != "" {
+		client, err := newDNSClient(server, opt.timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		lookup = qualifiedLookup(client.lookupAddrs)
+	}
+
+	found := FindStale(hosts, lookup)
+	if len(found) == 0 {
+		fmt.Println("No stale entries")
+		return
+	}
+	for _, s := range found {
+		fmt.Println(s)
+	}
+
+	if !opt.fix {
+		os.Exit(1)
+	}
+
+	out, pruned, renamed := fixStale(hosts, found)
+	rewritten := len(renamed)
+	if pruned+rewritten == 0 {
+		return
+	}
+
+	question := fmt.Sprintf("Remove %d and rewrite %d %s?", pruned, rewritten, plural(pruned+rewritten, "entry", "entries"))
+	if !opt.yes && !confirm(os.Stdin, os.Stdout, question) {
+		fmt.Println("Fix cancelled")
+		os.Exit(1)
+	}
+
+	if err := SaveFile(out); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save known_hosts: %v\n", err)
+		os.Exit(1)
+	}
+	if err := syncMeta(hosts, out, "", renamed); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed %d and rewrote %d %s\n", pruned, rewritten, plural(pruned+rewritten, "entry", "entries"))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindStale(t *testing.T) {
+	lines := []string{
+		"web1.corp,10.0.0.5 ssh-ed25519 key1",
+		"web2.corp,10.0.0.6 ssh-ed25519 key2",
+		"gone.corp,10.0.0.7 ssh-ed25519 key3",
+		"[db.corp]:2222,[10.0.0.8]:2222 ssh-ed25519 key4",
+		"broken.corp,10.0.0.9 ssh-ed25519 key5",
+		"name-only.corp ssh-ed25519 key6",
+		"10.0.0.10 ssh-ed25519 key7",
+		"web1.corp,10.0.0.5 ssh-rsa key8",
+		"v6.corp,2001:db8::6 ssh-ed25519 key9",
+	}
+
+	zone := map[string][]netip.Addr{
+		"web1.corp": {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("10.0.0.50")},
+		"web2.corp": {netip.MustParseAddr("10.0.1.6")},
+		"db.corp":   {netip.MustParseAddr("10.0.0.8")},
+		"v6.corp":   {netip.MustParseAddr("2001:db8::7")},
+	}
+	lookups := make(map[string]int)
+	lookup := func(host string) ([]netip.Addr, error) {
+		lookups[host]++
+		if host == "broken.corp" {
+			return nil, errors.New("SERVFAIL")
+		}
+		return zone[host], nil
+	}
+
+	found := FindStale(lines, lookup)
+
+	type result struct {
+		Index  int
+		Status string
+		Stale  []string
+	}
+	var got []result
+	for _, s := range found {
+		got = append(got, result{s.Index, s.Status, s.Stale})
+	}
+	want := []result{
+		{1, staleChanged, []string{"10.0.0.6"}},
+		{2, staleUnresolvable, nil},
+		{4, staleError, nil},
+		{8, staleChanged, []string{"2001:db8::6"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindStale() = %+v, want %+v", got, want)
+	}
+
+	if lookups["web1.corp"] != 1 {
+		t.Errorf("web1.corp looked up %d times, want 1", lookups["web1.corp"])
+	}
+	if lookups["name-only.corp"] != 0 {
+		t.Error("entries without an address shouldn't be resolved")
+	}
+
+	if s := found[0].String(); s != "changed      web2.corp 10.0.0.6 -> 10.0.1.6" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestFixStale(t *testing.T) {
+	lines := []string{
+		"web2.corp,10.0.0.6 ssh-ed25519 key2 comment",
+		"gone.corp,10.0.0.7 ssh-ed25519 key3",
+		"broken.corp,10.0.0.9 ssh-ed25519 key5",
+		"github.com ssh-ed25519 key6",
+	}
+	found := FindStale(lines, func(host string) ([]netip.Addr, error) {
+		switch host {
+		case "web2.corp":
+			return []netip.Addr{netip.MustParseAddr("10.0.1.6")}, nil
+		case "broken.corp":
+			return nil, errors.New("timeout")
+		}
+		return nil, nil
+	})
+
+	out, pruned, renamed := fixStale(lines, found)
+	want := []string{
+		"web2.corp ssh-ed25519 key2 comment",
+		"broken.corp,10.0.0.9 ssh-ed25519 key5",
+		"github.com ssh-ed25519 key6",
+	}
+	if !reflect.DeepEqual(out, want) || pruned != 1 {
+		t.Errorf("fixStale() = %q, %d, want %q, 1", out, pruned, want)
+	}
+	if want := map[string]string{lines[0]: want[0]}; !reflect.DeepEqual(renamed, want) {
+		t.Errorf("fixStale() renamed = %q, want %q", renamed, want)
+	}
+}
+
+func TestFindStaleWithResolver(t *testing.T) {
+	stub := &stubDNS{addrs: map[string][]netip.Addr{
+		"web.example.com.": {netip.MustParseAddr("192.0.2.10")},
+	}}
+	c, err := newDNSClient(stub.start(t), time.Second)
+	if err != nil {
+		t.Fatalf("newDNSClient() error = %v", err)
+	}
+
+	found := FindStale([]string{
+		"web.example.com,192.0.2.10 ssh-ed25519 key1",
+		"old.example.com,192.0.2.11 ssh-ed25519 key2",
+	}, c.lookupAddrs)
+	if len(found) != 1 || found[0].Status != staleUnresolvable || found[0].Names[0] != "old.example.com" {
+		t.Errorf("FindStale() = %+v, want old.example.com unresolvable", found)
+	}
+}
+
+func TestStaleKeepsShortNames(t *testing.T) {
+	// The stub answers NXDOMAIN for db1. as a server without search
+	// domains would
+	stub := &stubDNS{addrs: map[string][]netip.Addr{}}
+	c, err := newDNSClient(stub.start(t), time.Second)
+	if err != nil {
+		t.Fatalf("newDNSClient() error = %v", err)
+	}
+
+	lines := []string{"db1,10.0.0.5 ssh-ed25519 key1"}
+	found := FindStale(lines, qualifiedLookup(c.lookupAddrs))
+	if len(found) != 1 || found[0].Status != staleError {
+		t.Fatalf("FindStale() = %+v, want db1 reported as an error", found)
+	}
+
+	out, pruned, renamed := fixStale(lines, found)
+	if pruned != 0 || len(renamed) != 0 || !slicesEqual(out, lines) {
+		t.Errorf("fixStale() = %q, %d, %v, short name entry should survive", out, pruned, renamed)
+	}
+}
+
+func TestSystemLookup(t *testing.T) {
+	// localhost comes from /etc/hosts, never from a DNS server
+	found := FindStale([]string{"localhost,127.0.0.1 ssh-ed25519 key1"}, systemLookup(time.Second))
+	if len(found) != 0 {
+		t.Errorf("FindStale() = %+v, want localhost resolved by the system resolver", found)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultStatsTop is the number of domains listed by stats
+const defaultStatsTop = 10
+
+// statsOpts are the options of stats
+type statsOpts struct {
+	format string
+	top    int
+}
+
+// Stats summarizes the entries of the known_hosts files
+type Stats struct {
+	Entries  int            `json:"entries"`
+	Invalid  int            `json:"invalid"`
+	KeyTypes map[string]int `json:"key_types"`
+	Hashed   int            `json:"hashed"`
+	Plain    int            `json:"plain"`
+	// Host patterns of the plain entries by kind
+	IPv4      int            `json:"ipv4"`
+	IPv6      int            `json:"ipv6"`
+	Names     int            `json:"names"`
+	Wildcards int            `json:"wildcards"`
+	Markers   map[string]int `json:"markers"`
+	// Duplicates are keys listed more than once for the same host
+	Duplicates []statsHost `json:"duplicates"`
+	// MultipleKeys are hosts with several keys of the same type
+	MultipleKeys []statsHost   `json:"multiple_keys"`
+	TopDomains   []statsDomain `json:"top_domains"`
+}
+
+// statsHost is a host and key type found on several lines
+type statsHost struct {
+	Host    string   `json:"host"`
+	KeyType string   `json:"key_type"`
+	Lines   []string `json:"lines"` // file:line
+}
+
+// statsDomain is the number of entries under a domain
+type statsDomain struct {
+	Domain  string `json:"domain"`
+	Entries int    `json:"entries"`
+}
+
+// ComputeStats summarizes lines, listing the top domains with the most
+// entries. Hosts are compared as written, so hashed entries only count as
+// duplicates when their hashes are identical. CA and revocation lines
+// may list several keys and never count as multiple keys.
+func ComputeStats(lines []sourceLine, top int) Stats {
+	s := Stats{
+		KeyTypes:     make(map[string]int),
+		Markers:      make(map[string]int),
+		Duplicates:   []statsHost{},
+		MultipleKeys: []statsHost{},
+		TopDomains:   []statsDomain{},
+	}
+
+	type hostKey struct{ marker, host, keyType string }
+	type keyLine struct{ key, where string }
+	keys := make(map[hostKey][]keyLine)
+	var order []hostKey
+	domains := make(map[string]int)
+
+	for _, sl := range lines {
+		text := strings.TrimSpace(sl.Text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		e, err := ParseEntry(text)
+		if err != nil {
+			s.Invalid++
+			continue
+		}
+
+		s.Entries++
+		s.KeyTypes[e.KeyType]++
+		if e.Marker != "" {
+			s.Markers[e.Marker]++
+		}
+		if path := domainPath(text); len(path) > 0 && !strings.HasPrefix(path[0], "(") {
+			domains[path[0]]++
+		}
+
+		if e.Hashed() {
+			s.Hashed++
+		} else {
+			s.Plain++
+			for _, p := range e.Patterns {
+				switch addr, ok := patternAddr(p); {
+				case ok && addr.Is4():
+					s.IPv4++
+				case ok:
+					s.IPv6++
+				case strings.ContainsAny(p, "*?!"):
+					s.Wildcards++
+				default:
+					s.Names++
+				}
+			}
+		}
+
+		where := fmt.Sprintf("%s:%d", sl.Source, sl.Line)
+		for _, p := range e.Patterns {
+			k := hostKey{marker: e.Marker, host: strings.ToLower(p), keyType: e.KeyType}
+			if keys[k] == nil {
+				order = append(order, k)
+			}
+			keys[k] = append(keys[k], keyLine{key: e.Key, where: where})
+		}
+	}
+
+	for _, k := range order {
+		host := strings.TrimSpace(markerPrefix(k.marker) + k.host)
+
+		var blobs []string
+		byKey := make(map[string][]string)
+		var all []string
+		for _, kl := range keys[k] {
+			if byKey[kl.key] == nil {
+				blobs = append(blobs, kl.key)
+			}
+			byKey[kl.key] = append(byKey[kl.key], kl.where)
+			all = append(all, kl.where)
+		}
+
+		for _, blob := range blobs {
+			if len(byKey[blob]) > 1 {
+				s.Duplicates = append(s.Duplicates, statsHost{Host: host, KeyType: k.keyType, Lines: byKey[blob]})
+			}
+		}
+		if k.marker == "" && len(blobs) > 1 {
+			s.MultipleKeys = append(s.MultipleKeys, statsHost{Host: host, KeyType: k.keyType, Lines: all})
+		}
+	}
+
+	for d, n := range domains {
+		s.TopDomains = append(s.TopDomains, statsDomain{Domain: d, Entries: n})
+	}
+	slices.SortFunc(s.TopDomains, func(a, b statsDomain) int {
+		if a.Entries != b.Entries {
+			return b.Entries - a.Entries
+		}
+		return strings.Compare(a.Domain, b.Domain)
+	})
+	if len(s.TopDomains) > top {
+		s.TopDomains = s.TopDomains[:top]
+	}
+
+	return s
+}
+
+// writeStats prints s in text or json format
+func writeStats(w io.Writer, s Stats, format string) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	fmt.Fprintf(w, "Entries: %d\n", s.Entries)
+	if s.Invalid > 0 {
+		fmt.Fprintf(w, "Invalid lines: %d\n", s.Invalid)
+	}
+
+	fmt.Fprintln(w, "\nKey types:")
+	writeCounts(w, s.KeyTypes)
+
+	fmt.Fprintf(w, "\nHashed: %d\nPlain: %d\n", s.Hashed, s.Plain)
+	fmt.Fprintf(w, "\nHost patterns:\n  IPv4       %d\n  IPv6       %d\n  names      %d\n  wildcards  %d\n",
+		s.IPv4, s.IPv6, s.Names, s.Wildcards)
+
+	fmt.Fprintln(w, "\nMarkers:")
+	if len(s.Markers) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	writeCounts(w, s.Markers)
+
+	fmt.Fprintf(w, "\nDuplicates: %d\n", len(s.Duplicates))
+	for _, d := range s.Duplicates {
+		fmt.Fprintf(w, "  %s %s (%s)\n", d.Host, d.KeyType, strings.Join(d.Lines, ", "))
+	}
+
+	fmt.Fprintf(w, "\nHosts with several keys of one type: %d\n", len(s.MultipleKeys))
+	for _, m := range s.MultipleKeys {
+		fmt.Fprintf(w, "  %s %s (%s)\n", m.Host, m.KeyType, strings.Join(m.Lines, ", "))
+	}
+
+	fmt.Fprintln(w, "\nTop domains:")
+	if len(s.TopDomains) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, d := range s.TopDomains {
+		fmt.Fprintf(w, "  %-30s %d\n", d.Domain, d.Entries)
+	}
+
+	return nil
+}
+
+// writeCounts prints counts, largest first
+func writeCounts(w io.Writer, counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-30s %d\n", name, counts[name])
+	}
+}
+
+// runStats prints the statistics of every configured known_hosts file
+func runStats(lines []sourceLine, opt statsOpts) {
+	if err := writeStats(os.Stdout, ComputeStats(lines, opt.top), opt.format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
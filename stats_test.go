@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	lines := toSourceLines([]string{
+		"# comment",
+		"db1.corp.example,10.0.0.1 ssh-ed25519 key1",
+		"DB1.corp.example ssh-ed25519 key2",
+		"web.corp.example ssh-rsa key3",
+		"web.corp.example,10.0.0.2 ssh-rsa key3",
+		"[2001:db8::1]:2222 ssh-rsa key4",
+		"@revoked old.acme.io ssh-rsa key5",
+		"@cert-authority *.corp.example ssh-ed25519 key6",
+		"@cert-authority *.corp.example ssh-ed25519 key7",
+		"|1|c2FsdA==|aGFzaA== ssh-ed25519 key8",
+		"broken",
+		"",
+	})
+
+	got := ComputeStats(lines, 1)
+
+	want := Stats{
+		Entries:   9,
+		Invalid:   1,
+		KeyTypes:  map[string]int{"ssh-ed25519": 5, "ssh-rsa": 4},
+		Hashed:    1,
+		Plain:     8,
+		IPv4:      2,
+		IPv6:      1,
+		Names:     5,
+		Wildcards: 2,
+		Markers:   map[string]int{markerRevoked: 1, markerCertAuthority: 2},
+		Duplicates: []statsHost{
+			{Host: "web.corp.example", KeyType: "ssh-rsa", Lines: []string{"test:4", "test:5"}},
+		},
+		MultipleKeys: []statsHost{
+			{Host: "db1.corp.example", KeyType: "ssh-ed25519", Lines: []string{"test:2", "test:3"}},
+		},
+		TopDomains: []statsDomain{{Domain: "corp.example", Entries: 6}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputeStats() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestComputeStatsTopDomains(t *testing.T) {
+	got := ComputeStats(toSourceLines([]string{
+		"web.shop.co.uk ssh-ed25519 key1",
+		"db.shop.co.uk ssh-ed25519 key2",
+		"www.bank.co.uk ssh-ed25519 key3",
+		"api.github.io ssh-ed25519 key4",
+	}), defaultStatsTop).TopDomains
+
+	want := []statsDomain{{"shop.co.uk", 2}, {"api.github.io", 1}, {"bank.co.uk", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputeStats() top domains = %v, want %v", got, want)
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	s := ComputeStats(toSourceLines([]string{
+		"github.com ssh-ed25519 key1",
+		"github.com ssh-ed25519 key1",
+	}), defaultStatsTop)
+
+	var buf bytes.Buffer
+	if err := writeStats(&buf, s, formatText); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Entries: 2\n",
+		"ssh-ed25519                    2\n",
+		"Markers:\n  none\n",
+		"Duplicates: 1\n  github.com ssh-ed25519 (test:1, test:2)\n",
+		"Hosts with several keys of one type: 0\n",
+		"Top domains:\n  github.com ",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("writeStats() should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := writeStats(&buf, s, formatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if decoded["entries"] != float64(2) || len(decoded["duplicates"].([]any)) != 1 || len(decoded["top_domains"].([]any)) != 1 {
+		t.Errorf("unexpected JSON:\n%s", buf.String())
+	}
+}
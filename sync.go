@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// originTag marks the lines written by sync, followed by the team label
+const originTag = "origin="
+
+// syncResult is the outcome of syncEntries
+type syncResult struct {
+	Lines   []string
+	Report  mergeReport
+	Removed []string
+}
+
+// entryOrigin returns the origin label of a synced entry, or "" for
+// personal entries
+func entryOrigin(e Entry) string {
+	for _, f := range strings.Fields(e.Comment) {
+		if label, ok := strings.CutPrefix(f, originTag); ok {
+			return label
+		}
+	}
+
+	return ""
+}
+
+// tagOrigin adds the origin label to the comment of e
+func tagOrigin(e Entry, label string) Entry {
+	if entryOrigin(e) == label {
+		return e
+	}
+
+	e.Comment = strings.TrimSpace(e.Comment + " " + originTag + label)
+	return e
+}
+
+// sameKeyEntry reports whether a and b hold the same key for at least one
+// common host, looking through hashed patterns of a
+func sameKeyEntry(a, b Entry) bool {
+	if a.Marker != b.Marker || a.KeyType != b.KeyType || a.Key != b.Key {
+		return false
+	}
+
+	for _, p := range b.Patterns {
+		if a.HasHost(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncEntries merges the team entries into lines, tagging every added line
+// with label. With prune set it also removes lines previously synced from
+// label that the team file no longer has, and lines whose key the team
+// file marks as @revoked.
+func syncEntries(lines []string, team []Entry, label string, prune, hash bool) (res syncResult, err error) {
+	kept := lines
+	if prune {
+		kept = nil
+
+		revoked := make(map[string]bool)
+		for _, t := range team {
+			if t.Marker == markerRevoked {
+				revoked[t.KeyType+" "+t.Key] = true
+			}
+		}
+
+		for _, line := range lines {
+			e, err := ParseEntry(line)
+			if err != nil {
+				kept = append(kept, line)
+				continue
+			}
+
+			if e.Marker == "" && revoked[e.KeyType+" "+e.Key] {
+				res.Removed = append(res.Removed, line)
+				continue
+			}
+
+			if entryOrigin(e) == label && !teamHas(team, e) {
+				res.Removed = append(res.Removed, line)
+				continue
+			}
+
+			kept = append(kept, line)
+		}
+	}
+
+	tagged := make([]Entry, len(team))
+	for i, t := range team {
+		tagged[i] = tagOrigin(t, label)
+	}
+
+	res.Lines, res.Report, err = mergeEntries(kept, tagged, hash)
+	return res, err
+}
+
+func teamHas(team []Entry, e Entry) bool {
+	for _, t := range team {
+		if sameKeyEntry(e, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readTeamEntries parses the team known_hosts file. Lines that don't parse
+// are fatal, a reviewed file is expected to be clean.
+func readTeamEntries(name string) ([]Entry, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return parseTeamEntries(name, data)
+}
+
+// parseTeamEntries parses the contents of the team file name
+func parseTeamEntries(name string, data []byte) ([]Entry, error) {
+	var entries []Entry
+	for i, line := range stringToLine(string(data)) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := ParseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %w", name, i+1, err)
+		}
+		if err := validateKey(e.KeyType, e.Key); err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %w", name, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func runSync(hosts []string, opt syncOpts) {
+	data, err := verifyInput(opt.from, opt.sig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	team, err := parseTeamEntries(opt.from, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	res, err := syncEntries(hosts, team, opt.label, opt.prune, cfg.Hash == hashAlways)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !opt.dryRun && (len(res.Report.Added) > 0 || len(res.Removed) > 0) {
+		if err := SaveFile(res.Lines); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to save known_hosts: %v\n", err)
+			os.Exit(1)
+		}
+		if err := syncMeta(hosts, res.Lines, cmdSync+" "+opt.label, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	printMergeReport(os.Stdout, res.Report, opt.dryRun)
+	if len(res.Removed) > 0 {
+		verb := "Removed"
+		if opt.dryRun {
+			verb = "Dry run: would remove"
+		}
+		fmt.Printf("%s %d %s:\n", verb, len(res.Removed), plural(len(res.Removed), "entry", "entries"))
+		for _, line := range res.Removed {
+			fmt.Printf("- %s\n", displayHostIdentifier(line))
+		}
+	}
+
+	if len(res.Report.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagOrigin(t *testing.T) {
+	e := Entry{Patterns: []string{"h"}, KeyType: "ssh-rsa", Key: "AAAA", Comment: "db server"}
+
+	tagged := tagOrigin(e, "team")
+	if tagged.Comment != "db server origin=team" {
+		t.Errorf("tagOrigin() comment = %q", tagged.Comment)
+	}
+	if entryOrigin(tagged) != "team" {
+		t.Errorf("entryOrigin() = %q, want team", entryOrigin(tagged))
+	}
+	if again := tagOrigin(tagged, "team"); again.Comment != tagged.Comment {
+		t.Errorf("tagOrigin() should not tag twice, got %q", again.Comment)
+	}
+	if entryOrigin(e) != "" {
+		t.Errorf("entryOrigin() of a personal entry = %q, want empty", entryOrigin(e))
+	}
+}
+
+func TestSyncEntries(t *testing.T) {
+	keyType, keyA := testPublicKey(t)
+	_, keyB := testPublicKey(t)
+	_, keyC := testPublicKey(t)
+	_, keyD := testPublicKey(t)
+
+	line := func(s string) string { return strings.TrimSpace(s) }
+
+	lines := []string{
+		line("personal.example.com " + keyType + " " + keyA),
+		line("db.corp " + keyType + " " + keyB + " origin=team"),       // still in the team file
+		line("old.corp " + keyType + " " + keyC + " origin=team"),      // dropped by the team
+		line("conflict.corp " + keyType + " " + keyA),                  // personal, differs from team
+		line("compromised.example.com " + keyType + " " + keyD),        // revoked by the team
+		line("other.corp " + keyType + " " + keyC + " origin=another"), // another team's line
+	}
+
+	team := []Entry{
+		{Patterns: []string{"db.corp"}, KeyType: keyType, Key: keyB},
+		{Patterns: []string{"web.corp"}, KeyType: keyType, Key: keyB},
+		{Patterns: []string{"conflict.corp"}, KeyType: keyType, Key: keyB},
+		{Marker: markerRevoked, Patterns: []string{"*"}, KeyType: keyType, Key: keyD},
+	}
+
+	t.Run("without prune only adds", func(t *testing.T) {
+		res, err := syncEntries(lines, team, "team", false, false)
+		if err != nil {
+			t.Fatalf("syncEntries() error = %v", err)
+		}
+
+		want := append(append([]string{}, lines...),
+			"web.corp "+keyType+" "+keyB+" origin=team",
+			"@revoked * "+keyType+" "+keyD+" origin=team",
+		)
+		if !reflect.DeepEqual(res.Lines, want) {
+			t.Errorf("syncEntries() lines = %v\nwant %v", res.Lines, want)
+		}
+		if len(res.Report.Duplicates) != 1 || len(res.Report.Conflicts) != 1 || len(res.Removed) != 0 {
+			t.Errorf("syncEntries() report = %+v, removed = %v", res.Report, res.Removed)
+		}
+	})
+
+	t.Run("prune removes dropped and revoked entries", func(t *testing.T) {
+		res, err := syncEntries(lines, team, "team", true, false)
+		if err != nil {
+			t.Fatalf("syncEntries() error = %v", err)
+		}
+
+		wantRemoved := []string{lines[2], lines[4]}
+		if !reflect.DeepEqual(res.Removed, wantRemoved) {
+			t.Errorf("syncEntries() removed = %v, want %v", res.Removed, wantRemoved)
+		}
+		for _, l := range res.Lines {
+			if l == lines[2] || l == lines[4] {
+				t.Errorf("syncEntries() kept removed line %q", l)
+			}
+		}
+		if !strings.Contains(strings.Join(res.Lines, "\n"), "origin=another") {
+			t.Error("syncEntries() should keep lines of other origins")
+		}
+	})
+
+	t.Run("hashed synced lines are recognized", func(t *testing.T) {
+		hashed, _ := newHashedHost("db.corp")
+		res, err := syncEntries([]string{hashed + " " + keyType + " " + keyB + " origin=team"}, team[:1], "team", true, false)
+		if err != nil {
+			t.Fatalf("syncEntries() error = %v", err)
+		}
+		if len(res.Removed) != 0 || len(res.Report.Added) != 0 {
+			t.Errorf("syncEntries() should treat the hashed line as synced, got %+v", res)
+		}
+	})
+}
+
+func TestReadTeamEntries(t *testing.T) {
+	keyType, key := testPublicKey(t)
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "team")
+	content := "# reviewed 2026-10-01\n\nweb.corp " + keyType + " " + key + "\n"
+	if err := os.WriteFile(good, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write team file: %v", err)
+	}
+
+	got, err := readTeamEntries(good)
+	if err != nil {
+		t.Fatalf("readTeamEntries() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Patterns[0] != "web.corp" {
+		t.Errorf("readTeamEntries() = %v", got)
+	}
+
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("web.corp "+keyType+" AAAA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write team file: %v", err)
+	}
+	if _, err := readTeamEntries(bad); err == nil {
+		t.Error("readTeamEntries() should reject invalid keys")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"os"
 	"runtime"
 	"testing"
@@ -31,3 +32,32 @@ func setHomeDir(t *testing.T, newDir string) (restore func()) {
 		}
 	}
 }
+
+// setConfig replaces the effective configuration for the duration of the test
+func setConfig(t *testing.T, c Config) {
+	t.Helper()
+
+	old := cfg
+	cfg = c
+	t.Cleanup(func() { cfg = old })
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Failed to decode base64: %v", err)
+	}
+
+	return b
+}
+
+// writeTestFile writes content to name or fails the test
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
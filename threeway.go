@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Sides of a three-way merge
+const (
+	sideBoth = iota
+	sideOurs
+	sideTheirs
+)
+
+const (
+	conflictStart  = "<<<<<<< ours"
+	conflictMiddle = "======="
+	conflictEnd    = ">>>>>>> theirs"
+)
+
+// mergedLine is a line of the merge result and the side that added it
+type mergedLine struct {
+	Text string
+	Side int
+}
+
+// entryIdentity identifies a line independently of whitespace, pattern
+// order and comments. Lines that aren't entries are identified by text.
+func entryIdentity(line string) string {
+	e, err := ParseEntry(line)
+	if err != nil {
+		return "#" + strings.Join(strings.Fields(line), " ")
+	}
+
+	patterns := slices.Clone(e.Patterns)
+	slices.Sort(patterns)
+
+	return strings.Join([]string{e.Marker, strings.Join(patterns, ","), e.KeyType, e.Key}, " ")
+}
+
+func identitySet(lines []string) map[string]bool {
+	set := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		set[entryIdentity(l)] = true
+	}
+
+	return set
+}
+
+// Merge3 merges known_hosts files at the entry level. Entries added on
+// either side are kept, entries removed on either side are dropped. When
+// both sides leave the same host with different keys of the same type, the
+// conflicting lines are wrapped in conflict markers and conflict is true.
+func Merge3(base, ours, theirs []string) (out []string, conflict bool) {
+	inBase := identitySet(base)
+	inOurs := identitySet(ours)
+	inTheirs := identitySet(theirs)
+
+	var merged []mergedLine
+	seen := make(map[string]bool)
+	for _, l := range ours {
+		id := entryIdentity(l)
+		if seen[id] || (inBase[id] && !inTheirs[id]) {
+			continue
+		}
+		seen[id] = true
+
+		side := sideBoth
+		if !inBase[id] && !inTheirs[id] {
+			side = sideOurs
+		}
+		merged = append(merged, mergedLine{Text: l, Side: side})
+	}
+	for _, l := range theirs {
+		id := entryIdentity(l)
+		if seen[id] || inOurs[id] || inBase[id] {
+			continue
+		}
+		seen[id] = true
+		merged = append(merged, mergedLine{Text: l, Side: sideTheirs})
+	}
+
+	return resolveConflicts(merged)
+}
+
+// conflictGroups returns, for every host and key type that both sides gave
+// a different key, the indexes of the lines involved
+func conflictGroups(merged []mergedLine) [][]int {
+	type hostKey struct{ host, keyType string }
+
+	lines := make(map[hostKey][]int)
+	var order []hostKey
+	for i, m := range merged {
+		e, err := ParseEntry(m.Text)
+		if err != nil || e.Marker != "" {
+			continue
+		}
+		for _, p := range e.Patterns {
+			k := hostKey{p, e.KeyType}
+			if _, ok := lines[k]; !ok {
+				order = append(order, k)
+			}
+			lines[k] = append(lines[k], i)
+		}
+	}
+
+	var groups [][]int
+	grouped := make(map[int]bool)
+	for _, k := range order {
+		idx := lines[k]
+
+		var ours, theirs bool
+		for _, i := range idx {
+			ours = ours || merged[i].Side == sideOurs
+			theirs = theirs || merged[i].Side == sideTheirs
+		}
+		if !ours || !theirs || slices.ContainsFunc(idx, func(i int) bool { return grouped[i] }) {
+			continue
+		}
+
+		for _, i := range idx {
+			grouped[i] = true
+		}
+		groups = append(groups, idx)
+	}
+
+	return groups
+}
+
+func resolveConflicts(merged []mergedLine) (out []string, conflict bool) {
+	groups := conflictGroups(merged)
+
+	// The conflict block replaces the first line of its group
+	blockAt := make(map[int][]int)
+	skip := make(map[int]bool)
+	for _, g := range groups {
+		blockAt[g[0]] = g
+		for _, i := range g {
+			skip[i] = true
+		}
+	}
+
+	for i, m := range merged {
+		if g, ok := blockAt[i]; ok {
+			out = append(out, conflictStart)
+			for _, j := range g {
+				if merged[j].Side != sideTheirs {
+					out = append(out, merged[j].Text)
+				}
+			}
+			out = append(out, conflictMiddle)
+			for _, j := range g {
+				if merged[j].Side != sideOurs {
+					out = append(out, merged[j].Text)
+				}
+			}
+			out = append(out, conflictEnd)
+			continue
+		}
+
+		if !skip[i] {
+			out = append(out, m.Text)
+		}
+	}
+
+	return out, len(groups) > 0
+}
+
+// readLines reads a known_hosts file given on the command line
+func readLines(name string) ([]string, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringToLine(string(data)), nil
+}
+
+// writeMerged writes the merge result to name with perm, also when name
+// already exists with another mode
+func writeMerged(name, str string, perm os.FileMode) error {
+	if err := os.WriteFile(name, []byte(str), perm); err != nil {
+		return err
+	}
+
+	return os.Chmod(name, perm)
+}
+
+// runMerge implements the merge command. It can be used as a git merge
+// driver with "known_hosts merge %O %A %B -o %A": the exit status is 1
+// when conflict markers were written.
+func runMerge(opt mergeOpts) {
+	var files [3][]string
+	for i, name := range []string{opt.base, opt.ours, opt.theirs} {
+		lines, err := readLines(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		files[i] = lines
+	}
+
+	out, conflict := Merge3(files[0], files[1], files[2])
+	str := strings.Join(out, getLinebreak()) + getLinebreak()
+
+	// Like SaveFile, keep the permissions of the local file
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(opt.ours); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if opt.output == "" {
+		fmt.Print(str)
+	} else if err := writeMerged(opt.output, str, perm); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write %s: %v\n", opt.output, err)
+		os.Exit(1)
+	}
+
+	if conflict {
+		fmt.Fprintln(os.Stderr, "Conflict: the same host has different keys on both sides")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         []string
+		ours         []string
+		theirs       []string
+		want         []string
+		wantConflict bool
+	}{
+		{
+			name:   "non-overlapping adds",
+			base:   []string{"a ssh-rsa A"},
+			ours:   []string{"a ssh-rsa A", "b ssh-rsa B"},
+			theirs: []string{"a ssh-rsa A", "c ssh-rsa C"},
+			want:   []string{"a ssh-rsa A", "b ssh-rsa B", "c ssh-rsa C"},
+		},
+		{
+			name:   "removal on one side wins",
+			base:   []string{"a ssh-rsa A", "b ssh-rsa B"},
+			ours:   []string{"a ssh-rsa A", "b ssh-rsa B"},
+			theirs: []string{"b ssh-rsa B"},
+			want:   []string{"b ssh-rsa B"},
+		},
+		{
+			name:   "add and remove on different sides",
+			base:   []string{"a ssh-rsa A", "b ssh-rsa B"},
+			ours:   []string{"b ssh-rsa B", "c ssh-rsa C"},
+			theirs: []string{"a ssh-rsa A", "b ssh-rsa B", "d ssh-rsa D"},
+			want:   []string{"b ssh-rsa B", "c ssh-rsa C", "d ssh-rsa D"},
+		},
+		{
+			name:   "same add on both sides",
+			base:   nil,
+			ours:   []string{"a ssh-rsa A"},
+			theirs: []string{"a  ssh-rsa  A"},
+			want:   []string{"a ssh-rsa A"},
+		},
+		{
+			name:   "whitespace, pattern order and comments are not changes",
+			base:   []string{"a,10.0.0.1 ssh-rsa A"},
+			ours:   []string{"10.0.0.1,a ssh-rsa A old comment"},
+			theirs: []string{"a,10.0.0.1\tssh-rsa A"},
+			want:   []string{"10.0.0.1,a ssh-rsa A old comment"},
+		},
+		{
+			name:   "key rotated on one side",
+			base:   []string{"a ssh-rsa A", "b ssh-rsa B"},
+			ours:   []string{"a ssh-rsa A2", "b ssh-rsa B"},
+			theirs: []string{"a ssh-rsa A", "b ssh-rsa B"},
+			want:   []string{"a ssh-rsa A2", "b ssh-rsa B"},
+		},
+		{
+			name:   "different key type is not a conflict",
+			base:   nil,
+			ours:   []string{"a ssh-rsa A"},
+			theirs: []string{"a ssh-ed25519 E"},
+			want:   []string{"a ssh-rsa A", "a ssh-ed25519 E"},
+		},
+		{
+			name:   "same host rotated to different keys",
+			base:   []string{"x ssh-rsa X", "a ssh-rsa A"},
+			ours:   []string{"x ssh-rsa X", "a ssh-rsa B"},
+			theirs: []string{"x ssh-rsa X", "a ssh-rsa C", "y ssh-rsa Y"},
+			want: []string{
+				"x ssh-rsa X",
+				conflictStart,
+				"a ssh-rsa B",
+				conflictMiddle,
+				"a ssh-rsa C",
+				conflictEnd,
+				"y ssh-rsa Y",
+			},
+			wantConflict: true,
+		},
+		{
+			name:   "comment lines merge as text",
+			base:   []string{"# old header"},
+			ours:   []string{"# new header"},
+			theirs: []string{"# old header", "a ssh-rsa A"},
+			want:   []string{"# new header", "a ssh-rsa A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := Merge3(tt.base, tt.ours, tt.theirs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge3() = %q\nwant %q", got, tt.want)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("Merge3() conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+		})
+	}
+}
+
+func TestEntryIdentity(t *testing.T) {
+	if entryIdentity("a,b ssh-rsa K c1") != entryIdentity("b,a\tssh-rsa K") {
+		t.Error("entryIdentity() should ignore pattern order, whitespace and comments")
+	}
+	if entryIdentity("a ssh-rsa K") == entryIdentity("@revoked a ssh-rsa K") {
+		t.Error("entryIdentity() should include the marker")
+	}
+	if entryIdentity("a ssh-rsa K") == entryIdentity("a ssh-rsa L") {
+		t.Error("entryIdentity() should include the key")
+	}
+}
+
+func TestRunMergeKeepsMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	opt := mergeOpts{
+		base:   filepath.Join(tmpDir, "base"),
+		ours:   filepath.Join(tmpDir, "ours"),
+		theirs: filepath.Join(tmpDir, "theirs"),
+		output: filepath.Join(tmpDir, "merged"),
+	}
+	writeTestFile(t, opt.base, "a.example ssh-ed25519 key1\n")
+	writeTestFile(t, opt.ours, "a.example ssh-ed25519 key1\n")
+	writeTestFile(t, opt.theirs, "a.example ssh-ed25519 key1\nb.example ssh-ed25519 key2\n")
+	if err := os.Chmod(opt.ours, 0600); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	// git hands the driver an existing output file, with its own mode
+	writeTestFile(t, opt.output, "")
+	if err := os.Chmod(opt.output, 0644); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+
+	runMerge(opt)
+
+	info, err := os.Stat(opt.output)
+	if err != nil {
+		t.Fatalf("runMerge() didn't write the output: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("runMerge() output mode = %o, want 600", perm)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Groups of the tree view for entries without a domain name
+const (
+	groupAddresses = "(addresses)"
+	groupHashed    = "(hashed)"
+	groupOther     = "(other)"
+)
+
+// treeNode is a domain suffix in the TUI tree view, such as corp.example
+// or db.corp.example
+type treeNode struct {
+	label    string
+	path     string // key of the expanded state, the full suffix
+	children []*treeNode
+	lines    []string // entries grouped directly under this suffix
+}
+
+// treeRow is a visible row of the tree view, a group or an entry
+type treeRow struct {
+	node  *treeNode // nil for entries
+	line  string
+	depth int
+}
+
+// domainPath returns the groups of a line from the outermost one, the
+// registrable domain (eTLD+1) of the public suffix list: db1.db.corp.co.uk
+// is grouped under corp.co.uk and then db. Names without a domain aren't
+// grouped.
+func domainPath(line string) []string {
+	e, err := ParseEntry(line)
+	if err != nil {
+		return []string{groupOther}
+	}
+	if e.Hashed() {
+		return []string{groupHashed}
+	}
+
+	name := ""
+	for _, p := range e.Patterns {
+		if _, ok := patternAddr(p); !ok {
+			name, _ = splitHostPattern(p)
+			break
+		}
+	}
+	if name == "" {
+		return []string{groupAddresses}
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return nil
+	}
+
+	path := []string{domain}
+	if name != domain {
+		labels := strings.Split(strings.TrimSuffix(name, "."+domain), ".")
+		for i := len(labels) - 1; i >= 1; i-- {
+			path = append(path, labels[i])
+		}
+	}
+
+	return path
+}
+
+// buildTree groups lines by domainPath
+func buildTree(lines []string) *treeNode {
+	root := &treeNode{}
+
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		n := root
+		for _, label := range domainPath(line) {
+			i := slices.IndexFunc(n.children, func(c *treeNode) bool { return c.label == label })
+			if i < 0 {
+				path := label
+				if n.path != "" {
+					path = label + "." + n.path
+				}
+				n.children = append(n.children, &treeNode{label: label, path: path})
+				i = len(n.children) - 1
+			}
+			n = n.children[i]
+		}
+		n.lines = append(n.lines, line)
+	}
+
+	root.sort()
+	return root
+}
+
+// sort orders the children by label, the groups without a domain last
+func (n *treeNode) sort() {
+	slices.SortFunc(n.children, func(a, b *treeNode) int {
+		if ap, bp := strings.HasPrefix(a.label, "("), strings.HasPrefix(b.label, "("); ap != bp {
+			if ap {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.label, b.label)
+	})
+
+	for _, c := range n.children {
+		c.sort()
+	}
+}
+
+// allLines returns the entries of n and of every group below it
+func (n *treeNode) allLines() []string {
+	lines := slices.Clone(n.lines)
+	for _, c := range n.children {
+		lines = append(lines, c.allLines()...)
+	}
+
+	return lines
+}
+
+// count is the number of entries below n
+func (n *treeNode) count() int {
+	total := len(n.lines)
+	for _, c := range n.children {
+		total += c.count()
+	}
+
+	return total
+}
+
+// treeRows flattens the groups of root and the entries of the expanded
+// groups. Entries of a group come before its subgroups.
+func treeRows(root *treeNode, expanded map[string]bool) []treeRow {
+	var rows []treeRow
+
+	var walk func(n *treeNode, depth int)
+	walk = func(n *treeNode, depth int) {
+		for _, c := range n.children {
+			rows = append(rows, treeRow{node: c, depth: depth})
+			if !expanded[c.path] {
+				continue
+			}
+			for _, line := range c.lines {
+				rows = append(rows, treeRow{line: line, depth: depth + 1})
+			}
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 0)
+
+	for _, line := range root.lines {
+		rows = append(rows, treeRow{line: line})
+	}
+
+	return rows
+}
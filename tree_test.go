@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDomainPath(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "db1.db.corp.example ssh-rsa key", want: []string{"corp.example", "db"}},
+		{line: "web.corp.example,10.0.0.1 ssh-rsa key", want: []string{"corp.example"}},
+		{line: "corp.example ssh-rsa key", want: []string{"corp.example"}},
+		{line: "[DB2.db.corp.example]:2222 ssh-rsa key", want: []string{"corp.example", "db"}},
+		{line: "db1.db.corp.co.uk ssh-rsa key", want: []string{"corp.co.uk", "db"}},
+		{line: "co.uk ssh-rsa key", want: nil},
+		{line: "10.0.0.1 ssh-rsa key", want: []string{groupAddresses}},
+		{line: "|1|c2FsdA==|aGFzaA== ssh-rsa key", want: []string{groupHashed}},
+		{line: "myserver ssh-rsa key", want: nil},
+		{line: "broken", want: []string{groupOther}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := domainPath(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("domainPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTreeRows(t *testing.T) {
+	lines := []string{
+		"db1.db.corp.example ssh-rsa key1",
+		"db2.db.corp.example ssh-rsa key2",
+		"web.corp.example ssh-rsa key3",
+		"10.0.0.1 ssh-rsa key4",
+		"api.acme.io ssh-rsa key5",
+		"myserver ssh-rsa key6",
+	}
+	root := buildTree(lines)
+
+	describe := func(rows []treeRow) []string {
+		var out []string
+		for _, r := range rows {
+			if r.node != nil {
+				out = append(out, r.node.path)
+			} else {
+				out = append(out, r.line)
+			}
+		}
+		return out
+	}
+
+	got := describe(treeRows(root, map[string]bool{}))
+	want := []string{"acme.io", "corp.example", groupAddresses, lines[5]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collapsed rows = %q, want %q", got, want)
+	}
+
+	got = describe(treeRows(root, map[string]bool{"corp.example": true, "db.corp.example": true}))
+	want = []string{"acme.io", "corp.example", lines[2], "db.corp.example", lines[0], lines[1], groupAddresses, lines[5]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expanded rows = %q, want %q", got, want)
+	}
+
+	corp := root.children[1]
+	if corp.count() != 3 || len(corp.allLines()) != 3 {
+		t.Errorf("corp.example count = %d, lines = %v, want 3", corp.count(), corp.allLines())
+	}
+}
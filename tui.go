@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,14 +12,25 @@ import (
 
 // Model represents the TUI application state
 type Model struct {
-	hosts       []string // List of all hosts
-	filtered    []string // Filtered hosts (for search)
-	cursor      int      // Current selected index
-	search      string   // Current search query
-	isSearching bool     // Whether in search mode
-	mode        viewMode // Current view mode
-	err         error    // Error state
-	status      string   // Last user-visible status message
+	hosts       []string         // List of all hosts
+	filtered    []string         // Filtered hosts (for search)
+	cursor      int              // Current selected index
+	search      string           // Current search query
+	highlights  map[string][]int // Fuzzy matched rune positions of each filtered line
+	queryErr    error            // Why search isn't a valid query
+	isSearching bool             // Whether in search mode
+	mode        viewMode         // Current view mode
+	err         error            // Error state
+	status      string           // Last user-visible status message
+	authorized  bool             // Whether hosts are authorized_keys lines
+	meta        metaStore
+	tag         string // Only entries with this tag are listed
+	treeView    bool   // Whether entries are grouped by domain
+	expanded    map[string]bool
+	rows        []treeRow // Visible rows of the tree view
+	width       int       // Terminal size, 0 until the first tea.WindowSizeMsg
+	height      int
+	offset      int // First row shown in the viewport
 }
 
 type viewMode int
@@ -43,13 +55,21 @@ func (m Model) Init() tea.Cmd {
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		return m.handleKeyMsg(msg)
+		updated, cmd := m.handleKeyMsg(msg)
+		next := updated.(Model)
+		next.scrollToCursor()
+		return next, cmd
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scrollToCursor()
+		return m, nil
 	case errMsg:
 		m.err = msg.err
 		return m, nil
 	case hostsLoadedMsg:
 		m.hosts = msg.hosts
-		m.filtered = msg.hosts
+		m.filterHosts()
+		m.scrollToCursor()
 		return m, nil
 	case TickMsg:
 		// Can be used for periodic updates
@@ -74,115 +94,322 @@ func (m Model) View() string {
 	}
 }
 
-// Styles
+// Styles, built from the configured colors by applyColors
 var (
+	titleStyle    lipgloss.Style
+	selectedStyle lipgloss.Style
+	normalStyle   lipgloss.Style
+	errorStyle    lipgloss.Style
+	searchStyle   lipgloss.Style
+	matchStyle    lipgloss.Style
+	statusStyle   lipgloss.Style
+	footerStyle   lipgloss.Style
+)
+
+func init() {
+	applyColors(cfg.Colors)
+}
+
+// applyColors rebuilds the TUI styles from c
+func applyColors(c ColorConfig) {
 	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4")).
-			Padding(0, 1)
+		Foreground(lipgloss.Color(c.TitleForeground)).
+		Background(lipgloss.Color(c.TitleBackground)).
+		Padding(0, 1)
 
 	selectedStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#7D56F4")).
-			Bold(true)
+		Foreground(lipgloss.Color(c.Selected)).
+		Bold(true)
 
 	normalStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA"))
+		Foreground(lipgloss.Color(c.Normal))
 
 	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FF5F87")).
-			Bold(true)
+		Foreground(lipgloss.Color(c.Error)).
+		Bold(true)
 
 	searchStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#7D56F4"))
+		Foreground(lipgloss.Color(c.Search))
+
+	matchStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(c.Match)).
+		Bold(true).
+		Underline(true)
 
 	statusStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#04B575"))
+		Foreground(lipgloss.Color(c.Status))
 
 	footerStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#626262"))
-)
+		Foreground(lipgloss.Color(c.Footer))
+}
+
+// keyMatches reports whether msg is one of the bound keys
+func keyMatches(msg tea.KeyMsg, bindings []string) bool {
+	return slices.Contains(bindings, msg.String())
+}
+
+// keyLabel returns the footer label of the first bound key
+func keyLabel(bindings []string) string {
+	if len(bindings) == 0 {
+		return "-"
+	}
+
+	switch bindings[0] {
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	case "home":
+		return "Home"
+	case "end":
+		return "End"
+	case "pgup":
+		return "PgUp"
+	case "pgdown":
+		return "PgDn"
+	case "left":
+		return "←"
+	case "right":
+		return "→"
+	}
+
+	return bindings[0]
+}
 
 // renderError displays error message
 func (m Model) renderError() string {
 	return errorStyle.Render("Error: "+m.err.Error()) + "\n\nPress 'q' to quit"
 }
 
-// renderList displays the host list
+// renderList displays the header, the rows of the list that fit in the
+// terminal and the controls
 func (m Model) renderList() string {
 	var s strings.Builder
+	s.WriteString(m.renderHeader())
+
+	// Host list
+	if len(m.filtered) == 0 {
+		switch {
+		case len(m.hosts) == 0:
+			s.WriteString(normalStyle.Render("No known hosts available"))
+		case m.queryErr != nil:
+			s.WriteString(errorStyle.Render(m.fit("Invalid query: " + m.queryErr.Error())))
+		case m.search != "":
+			s.WriteString(normalStyle.Render(m.fit("No hosts found for filter: " + m.search)))
+		default:
+			s.WriteString(normalStyle.Render("No hosts found"))
+		}
+		s.WriteString("\n")
+	} else {
+		first, last := m.visibleRows()
+		for i := first; i < last; i++ {
+			s.WriteString(m.renderRow(i) + "\n")
+		}
+	}
+
+	s.WriteString(m.renderFooter())
+
+	return s.String()
+}
+
+// renderHeader renders the title, summary, status and search bar, each
+// line ending with a newline
+func (m Model) renderHeader() string {
+	var s strings.Builder
 
 	// Title
-	s.WriteString(titleStyle.Render("Known Hosts Manager") + "\n\n")
+	title := "Known Hosts Manager"
+	if m.authorized {
+		title = "Authorized Keys Manager"
+	}
+	s.WriteString(titleStyle.Render(title) + "\n\n")
 
 	// Summary
-	s.WriteString(footerStyle.Render(m.renderSummary()) + "\n")
+	s.WriteString(footerStyle.Render(m.fit(m.renderSummary())) + "\n")
 	if m.status != "" {
-		s.WriteString(statusStyle.Render(m.status) + "\n")
+		s.WriteString(statusStyle.Render(m.fit(m.status)) + "\n")
 	}
 	s.WriteString("\n")
 
 	// Search bar
 	if m.isSearching {
-		s.WriteString(searchStyle.Render("Search: ") + m.search + "_\n\n")
+		s.WriteString(searchStyle.Render("Search: ") + m.fitAfter("Search: ", m.search+"_") + "\n\n")
 	} else if m.search != "" {
-		s.WriteString(searchStyle.Render("Filter: ") + m.search + "\n\n")
+		s.WriteString(searchStyle.Render("Filter: ") + m.fitAfter("Filter: ", m.search) + "\n\n")
 	}
 
-	// Host list
-	if len(m.filtered) == 0 {
-		switch {
-		case len(m.hosts) == 0:
-			s.WriteString(normalStyle.Render("No known hosts available"))
-		case m.search != "":
-			s.WriteString(normalStyle.Render("No hosts found for filter: " + m.search))
-		default:
-			s.WriteString(normalStyle.Render("No hosts found"))
+	return s.String()
+}
+
+// renderFooter renders the controls below the list
+func (m Model) renderFooter() string {
+	return "\n" + footerStyle.Render(m.fit(renderControls()))
+}
+
+// renderRow renders row i of the list with the cursor prefix
+func (m Model) renderRow(i int) string {
+	style, prefix := normalStyle, "  "
+	if i == m.cursor {
+		style, prefix = selectedStyle, "> "
+	}
+
+	if m.treeView {
+		return style.Render(prefix) + m.renderTreeRow(m.rows[i], style, m.remaining(prefix))
+	}
+
+	line := m.filtered[i]
+	text, err := m.renderEntry(line, style, m.remaining(prefix))
+	if err != nil {
+		text = style.Render(m.fitAfter(prefix, displayHostIdentifier(line)))
+	}
+
+	return style.Render(prefix) + text
+}
+
+// renderTreeRow renders a group with its entry count, or an entry
+// indented under its group
+func (m Model) renderTreeRow(row treeRow, style lipgloss.Style, width int) string {
+	indent := strings.Repeat("  ", row.depth)
+	if row.node != nil {
+		marker := "▸"
+		if m.expanded[row.node.path] {
+			marker = "▾"
 		}
-	} else {
-		for i, hostLine := range m.filtered {
-			cursor := " "
-			if i == m.cursor {
-				cursor = ">"
-			}
+		return style.Render(truncate(fmt.Sprintf("%s%s %s (%d)", indent, marker, row.node.label, row.node.count()), width))
+	}
 
-			host, err := NewHost(hostLine)
-			if err != nil {
-				continue
-			}
+	indent += "  "
+	if width > 0 {
+		width = max(width-lipgloss.Width(indent), 1)
+	}
+	text, err := m.renderEntry(row.line, style, width)
+	if err != nil {
+		text = style.Render(truncate(displayHostIdentifier(row.line), width))
+	}
 
-			var hostDisplay string
-			if host.Name != "" && host.IP != "" {
-				hostDisplay = host.Name + ", " + host.IP
-			} else if host.Name != "" {
-				hostDisplay = host.Name
-			} else {
-				hostDisplay = host.IP
-			}
+	return style.Render(indent) + text
+}
 
-			line := cursor + " " + hostDisplay
-			if i == m.cursor {
-				s.WriteString(selectedStyle.Render(line))
-			} else {
-				s.WriteString(normalStyle.Render(line))
-			}
-			s.WriteString("\n")
+// renderEntry renders the label of a line followed by its tags and note,
+// cut to width cells (0 for no limit). While filtering, the comment is
+// shown too and the fuzzy matched characters are highlighted.
+func (m Model) renderEntry(line string, style lipgloss.Style, width int) (string, error) {
+	label, err := m.lineLabel(line)
+	if err != nil {
+		return "", err
+	}
+
+	positions, filtering := m.highlights[line]
+	if filtering {
+		label = m.matchText(line)
+	}
+	summary := ""
+	if s := m.meta.Summary(line); s != "" {
+		summary = "  " + s
+	}
+
+	// Cut the summary first, then the label
+	full := label + summary
+	cut := []rune(truncate(full, width))
+	if n := len([]rune(label)); len(cut) > n {
+		summary = string(cut[n:])
+	} else {
+		label, summary = string(cut), ""
+		if string(cut) != full {
+			// Don't highlight the ellipsis
+			positions = slices.DeleteFunc(slices.Clone(positions), func(p int) bool { return p >= len(cut)-1 })
 		}
 	}
 
-	// Footer
-	s.WriteString("\n" + footerStyle.Render("Controls: ↑↓/Home/End navigate | d delete | / search | q quit"))
+	text := style.Render(label)
+	if filtering {
+		text = highlight(label, positions, style)
+	}
+	if summary != "" {
+		text += style.Render(summary)
+	}
+
+	return text, nil
+}
+
+// highlight renders text in style, with the runes at positions in
+// matchStyle
+func highlight(text string, positions []int, style lipgloss.Style) string {
+	var s strings.Builder
+	runes := []rune(text)
+	start := 0
+	for start < len(runes) {
+		matched := slices.Contains(positions, start)
+		end := start + 1
+		for end < len(runes) && slices.Contains(positions, end) == matched {
+			end++
+		}
+
+		if matched {
+			s.WriteString(matchStyle.Render(string(runes[start:end])))
+		} else {
+			s.WriteString(style.Render(string(runes[start:end])))
+		}
+		start = end
+	}
 
 	return s.String()
 }
 
+// truncate cuts s to width cells, ending it with an ellipsis. A width of
+// 0 means no limit.
+func truncate(s string, width int) string {
+	if width <= 0 || lipgloss.Width(s) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "…"
+}
+
+// fit cuts s to the terminal width
+func (m Model) fit(s string) string {
+	return truncate(s, m.width)
+}
+
+// remaining returns the cells left on a line after prefix, 0 when the
+// terminal width isn't known
+func (m Model) remaining(prefix string) int {
+	if m.width <= 0 {
+		return 0
+	}
+
+	return max(m.width-lipgloss.Width(prefix), 1)
+}
+
+// fitAfter cuts s to the cells left after prefix
+func (m Model) fitAfter(prefix, s string) string {
+	return truncate(s, m.remaining(prefix))
+}
+
+func renderControls() string {
+	k := cfg.Keys
+	return fmt.Sprintf("Controls: %s%s/%s/%s/%s/%s navigate | %s delete | %s search | %s tree (%s/%s expand/collapse) | %s quit",
+		keyLabel(k.Up), keyLabel(k.Down), keyLabel(k.PageUp), keyLabel(k.PageDown), keyLabel(k.Top), keyLabel(k.Bottom),
+		keyLabel(k.Delete), keyLabel(k.Search), keyLabel(k.Tree), keyLabel(k.Expand), keyLabel(k.Collapse),
+		keyLabel(k.Quit))
+}
+
 func (m Model) renderSummary() string {
 	if len(m.hosts) == 0 {
 		return "Showing 0 hosts"
 	}
 
 	summary := fmt.Sprintf("Showing %d of %d hosts", len(m.filtered), len(m.hosts))
-	if len(m.filtered) > 0 {
-		summary += fmt.Sprintf(" | Selected %d/%d", m.cursor+1, len(m.filtered))
+	if n := m.itemCount(); n > 0 {
+		summary += fmt.Sprintf(" | Selected %d/%d", m.cursor+1, n)
+	}
+	if m.treeView {
+		summary += " | Tree view"
 	}
 
 	return summary
@@ -190,30 +417,76 @@ func (m Model) renderSummary() string {
 
 // renderConfirmDelete displays delete confirmation
 func (m Model) renderConfirmDelete() string {
-	hostLine := m.filtered[m.cursor]
-	host, err := NewHost(hostLine)
+	lines := m.selected()
+	if len(lines) > 1 {
+		var s strings.Builder
+		s.WriteString(titleStyle.Render("Confirm Deletion") + "\n\n")
+		s.WriteString(normalStyle.Render(fmt.Sprintf("Delete these %d hosts?", len(lines))) + "\n\n")
+		// Title, question, footer and the blank lines between them take 6
+		shown := lines
+		if m.height > 0 && len(lines) > max(m.height-6, 1) {
+			shown = lines[:max(m.height-7, 1)]
+		}
+		for _, line := range shown {
+			label, err := m.lineLabel(line)
+			if err != nil {
+				label = displayHostIdentifier(line)
+			}
+			s.WriteString(selectedStyle.Render(m.fit("- "+label)) + "\n")
+		}
+		if more := len(lines) - len(shown); more > 0 {
+			s.WriteString(normalStyle.Render(fmt.Sprintf("… and %d more", more)) + "\n")
+		}
+		s.WriteString("\n" + footerStyle.Render("Press Enter or 'y' to confirm, 'n' to cancel"))
+		return s.String()
+	}
+
+	hostLine := lines[0]
+	hostDisplay, err := m.lineLabel(hostLine)
 	if err != nil {
 		return errorStyle.Render("Error: " + err.Error())
 	}
 
-	var hostDisplay string
-	if host.Name != "" && host.IP != "" {
-		hostDisplay = host.Name + ", " + host.IP
-	} else if host.Name != "" {
-		hostDisplay = host.Name
-	} else {
-		hostDisplay = host.IP
+	question := "Delete this host?\n\n"
+	if m.authorized {
+		question = "Delete this key?\n\n"
 	}
 
 	var s string
 	s += titleStyle.Render("Confirm Deletion") + "\n\n"
-	s += normalStyle.Render("Delete this host?\n\n")
+	s += normalStyle.Render(question)
 	s += selectedStyle.Render(hostDisplay) + "\n\n"
 	s += footerStyle.Render("Press Enter or 'y' to confirm, 'n' to cancel")
 
 	return s
 }
 
+// lineLabel returns how a line is shown in the list
+func (m Model) lineLabel(line string) (string, error) {
+	if m.authorized {
+		if _, err := ParseAuthorizedKey(line); err != nil {
+			return "", err
+		}
+		return displayAuthorizedKey(line), nil
+	}
+
+	return hostLabel(line)
+}
+
+// matchText returns the text fuzzy filtering matches a line against: its
+// label and its comment
+func (m Model) matchText(line string) string {
+	label, err := m.lineLabel(line)
+	if err != nil {
+		label = displayHostIdentifier(line)
+	}
+	if e, err := ParseEntry(line); err == nil && e.Comment != "" {
+		label += "  " + e.Comment
+	}
+
+	return label
+}
+
 // handleKeyMsg processes keyboard input
 func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch m.mode {
@@ -227,59 +500,93 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // handleListKeyMsg processes keys in list view
 func (m Model) handleListKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.Type {
-	case tea.KeyCtrlC, tea.KeyEsc:
+	// While searching, typed characters belong to the query. q and esc
+	// leave the search, the other quit keys such as ctrl+c still quit.
+	if m.isSearching && msg.Type == tea.KeySpace {
+		m.search += " "
+		m.filterHosts()
+		return m, nil
+	}
+	if m.isSearching && msg.Type == tea.KeyEsc {
+		m.isSearching = false
+		m.search = ""
+		m.filterHosts()
+		return m, nil
+	}
+	if m.isSearching && msg.Type == tea.KeyBackspace {
+		msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{127}}
+	}
+	if m.isSearching && msg.Type == tea.KeyRunes {
+		switch msg.String() {
+		case "/":
+			// Ignore repeat slash
+		case "q":
+			m.isSearching = false
+			m.search = ""
+			m.filterHosts()
+		case "\x7f": // Backspace
+			if len(m.search) > 0 {
+				m.search = m.search[:len(m.search)-1]
+				m.filterHosts()
+			}
+		case "\r": // Enter
+			m.isSearching = false
+		default:
+			m.search += msg.String()
+			m.filterHosts()
+		}
+		return m, nil
+	}
+
+	keys := cfg.Keys
+	switch {
+	case keyMatches(msg, keys.Quit):
 		return m, tea.Quit
 
-	case tea.KeyUp:
+	case keyMatches(msg, keys.Up):
 		if m.cursor > 0 {
 			m.cursor--
 		}
-	case tea.KeyDown:
-		if m.cursor < len(m.filtered)-1 {
+	case keyMatches(msg, keys.Down):
+		if m.cursor < m.itemCount()-1 {
 			m.cursor++
 		}
-	case tea.KeyHome:
+	case keyMatches(msg, keys.PageUp):
+		m.cursor = max(m.cursor-m.listHeight(), 0)
+	case keyMatches(msg, keys.PageDown):
+		m.cursor = max(min(m.cursor+m.listHeight(), m.itemCount()-1), 0)
+	case keyMatches(msg, keys.Top):
 		m.cursor = 0
-	case tea.KeyEnd:
-		m.cursor = len(m.filtered) - 1
+	case keyMatches(msg, keys.Bottom):
+		m.cursor = max(m.itemCount()-1, 0)
 
-	case tea.KeyRunes:
-		if m.isSearching {
-			switch msg.String() {
-			case "/":
-				// Ignore repeat slash
-			case "q":
-				m.isSearching = false
-				m.search = ""
-				m.filtered = m.hosts
-			case "\x7f": // Backspace
-				if len(m.search) > 0 {
-					m.search = m.search[:len(m.search)-1]
-					m.filterHosts()
-				}
-			case "\r": // Enter
-				m.isSearching = false
-			default:
-				m.search += msg.String()
-				m.filterHosts()
-			}
-		} else {
-			switch msg.String() {
-			case "/":
-				m.isSearching = true
-				m.search = ""
-				m.cursor = 0
-			case "q":
-				return m, tea.Quit
-			case "d":
-				if len(m.filtered) > 0 {
-					m.mode = viewConfirmDelete
-				}
-			}
+	case keyMatches(msg, keys.Search):
+		m.isSearching = true
+		m.search = ""
+		m.cursor = 0
+	case keyMatches(msg, keys.Delete):
+		if m.itemCount() > 0 {
+			m.mode = viewConfirmDelete
 		}
 
-	case tea.KeyEnter:
+	case keyMatches(msg, keys.Tree):
+		if m.authorized {
+			m.status = "The tree view is only available for known_hosts"
+			break
+		}
+		m.treeView = !m.treeView
+		m.cursor = 0
+		m.refreshTree()
+	case m.treeView && !m.isSearching && keyMatches(msg, keys.Expand):
+		m.setExpanded(true)
+	case m.treeView && !m.isSearching && keyMatches(msg, keys.Collapse):
+		m.setExpanded(false)
+	case m.treeView && !m.isSearching && msg.Type == tea.KeyEnter:
+		if m.cursor < len(m.rows) && m.rows[m.cursor].node != nil {
+			m.setExpanded(!m.expanded[m.rows[m.cursor].node.path])
+		}
+
+	case msg.Type == tea.KeyEnter:
 		if m.isSearching {
 			m.isSearching = false
 		}
@@ -310,30 +617,176 @@ func (m Model) handleConfirmKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) deleteCurrentSelection() (tea.Model, tea.Cmd) {
-	hostLine := m.filtered[m.cursor]
-	m.hosts = Delete(m.hosts, hostLine)
-	m.filtered = Delete(m.filtered, hostLine)
-	if len(m.filtered) == 0 {
-		m.cursor = 0
-	} else if m.cursor >= len(m.filtered) {
-		m.cursor = len(m.filtered) - 1
+	lines := m.selected()
+	for _, hostLine := range lines {
+		if m.authorized {
+			m.hosts, _ = deleteAuthorizedKeys(m.hosts, hostLine)
+			m.filtered, _ = deleteAuthorizedKeys(m.filtered, hostLine)
+		} else {
+			m.hosts = Delete(m.hosts, hostLine)
+			m.filtered = Delete(m.filtered, hostLine)
+		}
 	}
+	m.refreshTree()
+	m.clampCursor()
 	m.mode = viewList
-	m.status = "Deleted " + displayHostIdentifier(hostLine)
-	return m, saveHosts(m.hosts)
+	switch {
+	case len(lines) > 1:
+		m.status = fmt.Sprintf("Deleted %d hosts", len(lines))
+	case m.authorized:
+		m.status = "Deleted " + displayAuthorizedKey(lines[0])
+	default:
+		m.status = "Deleted " + displayHostIdentifier(lines[0])
+	}
+	return m, saveHosts(m.hosts, !m.authorized)
 }
 
-// filterHosts filters the host list based on search query
+// itemCount is the number of rows the cursor moves over
+func (m Model) itemCount() int {
+	if m.treeView {
+		return len(m.rows)
+	}
+
+	return len(m.filtered)
+}
+
+// listHeight is the number of rows the viewport shows, every row until
+// the terminal size is known
+func (m Model) listHeight() int {
+	if m.height <= 0 {
+		return max(m.itemCount(), 1)
+	}
+
+	// The list ends with a newline before the footer
+	used := strings.Count(m.renderHeader(), "\n") + strings.Count(m.renderFooter(), "\n") + 1
+	return max(m.height-used, 1)
+}
+
+// visibleRows returns the range of rows shown in the viewport
+func (m Model) visibleRows() (first, last int) {
+	first = min(m.offset, max(m.itemCount()-1, 0))
+	return first, min(first+m.listHeight(), m.itemCount())
+}
+
+// scrollToCursor moves the viewport the least needed to show the cursor
+func (m *Model) scrollToCursor() {
+	h := m.listHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+h {
+		m.offset = m.cursor - h + 1
+	}
+	m.offset = max(min(m.offset, m.itemCount()-h), 0)
+}
+
+// clampCursor keeps the cursor on an existing row
+func (m *Model) clampCursor() {
+	if m.cursor >= m.itemCount() {
+		m.cursor = m.itemCount() - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// selected returns the entries under the cursor: one entry, or every
+// entry of the group in the tree view
+func (m Model) selected() []string {
+	if m.cursor >= m.itemCount() {
+		return nil
+	}
+	if !m.treeView {
+		return []string{m.filtered[m.cursor]}
+	}
+
+	row := m.rows[m.cursor]
+	if row.node != nil {
+		return row.node.allLines()
+	}
+
+	return []string{row.line}
+}
+
+// refreshTree rebuilds the rows of the tree view from the filtered hosts
+func (m *Model) refreshTree() {
+	if !m.treeView {
+		m.rows = nil
+		return
+	}
+
+	if m.expanded == nil {
+		m.expanded = make(map[string]bool)
+	}
+	m.rows = treeRows(buildTree(m.filtered), m.expanded)
+	m.clampCursor()
+}
+
+// setExpanded opens or closes the group under the cursor. Closing from an
+// entry closes the group it belongs to and moves the cursor there.
+func (m *Model) setExpanded(open bool) {
+	if m.cursor >= len(m.rows) {
+		return
+	}
+
+	row := m.rows[m.cursor]
+	if row.node == nil {
+		if open {
+			return
+		}
+		for i := m.cursor - 1; i >= 0; i-- {
+			if m.rows[i].node != nil && m.rows[i].depth < row.depth {
+				m.cursor, row = i, m.rows[i]
+				break
+			}
+		}
+		if row.node == nil {
+			return
+		}
+	}
+
+	m.expanded[row.node.path] = open
+	m.refreshTree()
+}
+
+// filterHosts filters the host list based on the tag and search query
 func (m *Model) filterHosts() {
+	m.queryErr = nil
+	m.highlights = nil
+	hosts := m.hosts
+	if m.tag != "" {
+		hosts = nil
+		for _, line := range m.hosts {
+			if m.meta.HasTag(line, m.tag) {
+				hosts = append(hosts, line)
+			}
+		}
+	}
+
 	if m.search == "" {
-		m.filtered = m.hosts
+		m.filtered = hosts
+		m.refreshTree()
 		return
 	}
 
-	m.filtered = Search(m.hosts, m.search)
+	if m.authorized {
+		m.filtered = SearchAuthorizedKeys(hosts, m.search)
+	} else if q, err := ParseQuery(m.search); err != nil {
+		// Usually a term still being typed, such as "port:"
+		m.filtered = nil
+		m.queryErr = err
+	} else {
+		m.filtered = nil
+		m.highlights = make(map[string][]int)
+		for _, r := range fuzzyRank(q, hosts, m.meta, m.matchText) {
+			m.filtered = append(m.filtered, r.Line)
+			m.highlights[r.Line] = r.Positions
+		}
+	}
 	if len(m.filtered) > 0 {
 		m.cursor = 0
 	}
+	m.refreshTree()
 }
 
 // Helper messages and commands
@@ -354,11 +807,18 @@ func loadHosts() tea.Cmd {
 	}
 }
 
-func saveHosts(hosts []string) tea.Cmd {
+// saveHosts writes hosts and, with meta, drops the metadata of the
+// deleted entries
+func saveHosts(hosts []string, meta bool) tea.Cmd {
 	return func() tea.Msg {
 		if err := SaveFile(hosts); err != nil {
 			return errMsg{err}
 		}
+		if meta {
+			if err := syncMeta(nil, hosts, "", nil); err != nil {
+				return errMsg{err}
+			}
+		}
 		return nil
 	}
 }
@@ -2,11 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 func TestModelInit(t *testing.T) {
@@ -304,6 +307,20 @@ func TestHandleListKeyMsg(t *testing.T) {
 			wantMode:   viewList,
 			wantSearch: "g",
 		},
+		{
+			name: "backspace key in search mode",
+			model: Model{
+				hosts:       []string{"github.com ssh-rsa key", "gitlab.com ssh-rsa key"},
+				filtered:    []string{"github.com ssh-rsa key", "gitlab.com ssh-rsa key"},
+				search:      "gi",
+				isSearching: true,
+				mode:        viewList,
+			},
+			msg:        tea.KeyMsg{Type: tea.KeyBackspace},
+			wantCursor: 0,
+			wantMode:   viewList,
+			wantSearch: "g",
+		},
 		{
 			name: "exit search with q",
 			model: Model{
@@ -318,6 +335,20 @@ func TestHandleListKeyMsg(t *testing.T) {
 			wantMode:   viewList,
 			wantSearch: "",
 		},
+		{
+			name: "exit search with esc",
+			model: Model{
+				hosts:       []string{"github.com ssh-rsa key", "gitlab.com ssh-rsa key"},
+				filtered:    []string{"github.com ssh-rsa key", "gitlab.com ssh-rsa key"},
+				search:      "gi",
+				isSearching: true,
+				mode:        viewList,
+			},
+			msg:        tea.KeyMsg{Type: tea.KeyEsc},
+			wantCursor: 0,
+			wantMode:   viewList,
+			wantSearch: "",
+		},
 		{
 			name: "unknown key in non-search mode",
 			model: Model{
@@ -353,6 +384,18 @@ func TestHandleListKeyMsg(t *testing.T) {
 	}
 }
 
+func TestCtrlCQuitsWhileSearching(t *testing.T) {
+	m := Model{filtered: []string{"host1"}, search: "h", isSearching: true, mode: viewList}
+
+	_, cmd := m.handleListKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if cmd == nil {
+		t.Fatal("handleListKeyMsg() should quit on ctrl+c while searching")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Errorf("handleListKeyMsg() cmd = %T, want tea.QuitMsg", cmd())
+	}
+}
+
 func TestHandleConfirmKeyMsg(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -588,7 +631,7 @@ func TestSaveHosts(t *testing.T) {
 
 	hosts := []string{"github.com ssh-rsa key", "gitlab.com ssh-rsa key"}
 
-	cmd := saveHosts(hosts)
+	cmd := saveHosts(hosts, true)
 	msg := cmd()
 
 	// saveHosts returns nil on success
@@ -693,3 +736,315 @@ func findInString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestHandleListKeyMsg_CustomBindings(t *testing.T) {
+	c := defaultConfig()
+	c.Keys.Down = []string{"down", "j"}
+	c.Keys.Delete = []string{"x"}
+	setConfig(t, c)
+
+	m := Model{
+		filtered: []string{"host1", "host2"},
+		mode:     viewList,
+	}
+
+	newModel, _ := m.handleListKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	m = newModel.(Model)
+	if m.cursor != 1 {
+		t.Errorf("custom down binding cursor = %d, want 1", m.cursor)
+	}
+
+	newModel, _ = m.handleListKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = newModel.(Model)
+	if m.mode != viewList {
+		t.Error("unbound default delete key should not open confirmation")
+	}
+
+	newModel, _ = m.handleListKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	m = newModel.(Model)
+	if m.mode != viewConfirmDelete {
+		t.Error("custom delete binding should open confirmation")
+	}
+
+	if !contains(renderControls(), "x delete") {
+		t.Errorf("renderControls() = %q, want custom delete key", renderControls())
+	}
+}
+
+func TestTagFilterAndNotes(t *testing.T) {
+	hosts := []string{"github.com ssh-rsa key1", "lab1.corp ssh-rsa key2"}
+	meta := make(metaStore)
+	e, _ := ParseEntry(hosts[1])
+	meta.set(e, EntryMeta{Tags: []string{"lab"}, Note: "rack 4"})
+
+	m := Model{hosts: hosts, mode: viewList, meta: meta, tag: "lab"}
+	m.filterHosts()
+	if len(m.filtered) != 1 || m.filtered[0] != hosts[1] {
+		t.Fatalf("filterHosts() = %v, want lab1.corp only", m.filtered)
+	}
+	if view := m.View(); !contains(view, "lab1.corp  [lab] rack 4") {
+		t.Errorf("renderList() should show tags and note, got:\n%s", view)
+	}
+
+	// Leaving search keeps the tag filter
+	m.isSearching = true
+	m.search = "git"
+	updated, _ := m.handleListKeyMsg(tea.KeyMsg{Type: tea.KeyEsc})
+	if got := updated.(Model).filtered; len(got) != 1 || got[0] != hosts[1] {
+		t.Errorf("filtered after leaving search = %v, want lab1.corp only", got)
+	}
+}
+
+func TestTreeView(t *testing.T) {
+	tmpDir := t.TempDir()
+	setConfig(t, Config{Files: []string{tmpDir + "/known_hosts"}, Keys: defaultConfig().Keys})
+
+	hosts := []string{
+		"db1.db.corp.example ssh-rsa key1",
+		"db2.db.corp.example ssh-rsa key2",
+		"github.com ssh-rsa key3",
+	}
+	m := Model{hosts: hosts, mode: viewList}
+	m.filterHosts()
+
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.handleKeyMsg(msg)
+		m = updated.(Model)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	if !m.treeView || len(m.rows) != 2 {
+		t.Fatalf("tree view rows = %d, want 2 collapsed groups", len(m.rows))
+	}
+	if view := m.View(); !contains(view, "▸ corp.example (2)") || !contains(view, "▸ github.com (1)") {
+		t.Errorf("tree view should show groups with counts, got:\n%s", view)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRight})
+	press(tea.KeyMsg{Type: tea.KeyDown})
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.rows) != 5 {
+		t.Fatalf("expanded rows = %d, want corp.example, db, 2 entries and github.com", len(m.rows))
+	}
+
+	// Collapsing from an entry closes its group
+	press(tea.KeyMsg{Type: tea.KeyDown})
+	press(tea.KeyMsg{Type: tea.KeyLeft})
+	if m.cursor != 1 || len(m.rows) != 3 {
+		t.Errorf("after collapse cursor = %d, rows = %d, want 1 and 3", m.cursor, len(m.rows))
+	}
+
+	// Deleting a group asks once and lists its entries
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	view := m.View()
+	if m.mode != viewConfirmDelete || !contains(view, "Delete these 2 hosts?") || !contains(view, "db1.db.corp.example") || !contains(view, "db2.db.corp.example") {
+		t.Fatalf("confirmation should list the group, got:\n%s", view)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	if len(m.hosts) != 1 || m.hosts[0] != hosts[2] {
+		t.Errorf("hosts after group deletion = %v, want github.com only", m.hosts)
+	}
+	if m.status != "Deleted 2 hosts" {
+		t.Errorf("status = %q", m.status)
+	}
+}
+
+func TestTreeViewAuthorizedKeys(t *testing.T) {
+	m := Model{hosts: []string{"ssh-ed25519 AAAA alice"}, authorized: true, mode: viewList}
+	m.filterHosts()
+
+	updated, _ := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	if updated.(Model).treeView {
+		t.Error("the tree view shouldn't be available for authorized_keys")
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	m := Model{
+		hosts: []string{
+			"github.com ssh-rsa key1",
+			"gitlab.com ssh-ed25519 key2",
+		},
+		mode: viewList,
+	}
+	m.filterHosts()
+
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.handleKeyMsg(msg)
+		m = updated.(Model)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	for _, r := range "GIT" {
+		press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	press(tea.KeyMsg{Type: tea.KeySpace})
+	for _, r := range "type:" {
+		press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	if m.queryErr == nil || !contains(m.View(), "Invalid query") {
+		t.Errorf("an incomplete term should be reported, got:\n%s", m.View())
+	}
+
+	for _, r := range "ed25519" {
+		press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	if m.search != "GIT type:ed25519" || len(m.filtered) != 1 || m.filtered[0] != m.hosts[1] {
+		t.Errorf("filter %q = %v, want gitlab.com only", m.search, m.filtered)
+	}
+	if contains(m.View(), "Invalid query") {
+		t.Error("a complete query shouldn't be reported as invalid")
+	}
+}
+
+func TestFuzzyFilterDeletesOnlySelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	setConfig(t, Config{Files: []string{tmpDir + "/known_hosts"}, Keys: defaultConfig().Keys})
+
+	hosts := []string{
+		"legit.example ssh-rsa key1",
+		"gitlab.com ssh-rsa key2",
+		"bastion ssh-rsa key3 git mirror",
+		"github.com ssh-rsa key4",
+	}
+	m := Model{hosts: hosts, mode: viewList}
+	m.filterHosts()
+
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.handleKeyMsg(msg)
+		m = updated.(Model)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	for _, r := range "gt" {
+		press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	// Ties keep the file order, legit.example matches inside a word
+	want := []string{hosts[1], hosts[2], hosts[3], hosts[0]}
+	if !slicesEqual(m.filtered, want) {
+		t.Fatalf("filtered = %q, want %q", m.filtered, want)
+	}
+	if !contains(m.View(), "bastion  git mirror") {
+		t.Errorf("matched comments should be shown while filtering, got:\n%s", m.View())
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+
+	want = []string{hosts[0], hosts[2], hosts[3]}
+	if !slicesEqual(m.hosts, want) {
+		t.Errorf("hosts = %q, want only gitlab.com removed", m.hosts)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{s: "github.com", width: 0, want: "github.com"},
+		{s: "github.com", width: 10, want: "github.com"},
+		{s: "github.com", width: 7, want: "github…"},
+		{s: "github.com", width: 1, want: "…"},
+		{s: "日本語.example", width: 5, want: "日本…"},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.width); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestViewport(t *testing.T) {
+	setConfig(t, Config{Files: []string{t.TempDir() + "/known_hosts"}, Keys: defaultConfig().Keys})
+
+	var hosts []string
+	for i := range 50 {
+		hosts = append(hosts, fmt.Sprintf("host%02d.example ssh-rsa key%d", i, i))
+	}
+	hosts = append(hosts, "a-very-long-host-name-that-does-not-fit.example.com ssh-rsa key50")
+
+	var m tea.Model = Model{hosts: hosts, mode: viewList}
+	update := func(msg tea.Msg) {
+		t.Helper()
+		m, _ = m.Update(msg)
+	}
+	update(hostsLoadedMsg{hosts: hosts})
+	update(tea.WindowSizeMsg{Width: 40, Height: 12})
+
+	check := func(wantVisible, wantHidden string) {
+		t.Helper()
+		view := m.View()
+		lines := strings.Split(view, "\n")
+		if len(lines) > 12 {
+			t.Errorf("view has %d lines, want at most 12:\n%s", len(lines), view)
+		}
+		for _, line := range lines {
+			if lipgloss.Width(line) > 40 {
+				t.Errorf("line %q is wider than 40 cells", line)
+			}
+		}
+		if !contains(view, "Known Hosts Manager") || !contains(view, "Controls:") {
+			t.Errorf("header and footer should stay visible:\n%s", view)
+		}
+		if !contains(view, "> "+wantVisible) {
+			t.Errorf("cursor row %q should be visible:\n%s", wantVisible, view)
+		}
+		if contains(view, wantHidden) {
+			t.Errorf("%q should be scrolled out:\n%s", wantHidden, view)
+		}
+	}
+
+	check("host00.example", "host10.example")
+
+	update(tea.KeyMsg{Type: tea.KeyEnd})
+	check("a-very-long-host-name-that-does-not-f…", "host00.example")
+
+	rows := m.(Model).listHeight()
+	update(tea.KeyMsg{Type: tea.KeyPgUp})
+	if got := m.(Model).cursor; got != 50-rows {
+		t.Errorf("cursor after PgUp = %d, want %d", got, 50-rows)
+	}
+	check(fmt.Sprintf("host%02d.example", 50-rows), "host00.example")
+
+	update(tea.KeyMsg{Type: tea.KeyHome})
+	update(tea.KeyMsg{Type: tea.KeyPgDown})
+	if got := m.(Model).cursor; got != rows {
+		t.Errorf("cursor after PgDn = %d, want %d", got, rows)
+	}
+	check(fmt.Sprintf("host%02d.example", rows), "host00.example")
+
+	// Moving back up inside the viewport doesn't scroll
+	offset := m.(Model).offset
+	update(tea.KeyMsg{Type: tea.KeyUp})
+	if m.(Model).offset != offset {
+		t.Errorf("offset = %d, want %d", m.(Model).offset, offset)
+	}
+
+	// A smaller terminal still shows the cursor
+	update(tea.WindowSizeMsg{Width: 40, Height: 9})
+	check(fmt.Sprintf("host%02d.example", rows-1), "host00.example")
+}
+
+func TestConfirmDeleteFitsTerminal(t *testing.T) {
+	var hosts []string
+	for i := range 20 {
+		hosts = append(hosts, fmt.Sprintf("host%02d.corp.example ssh-rsa key%d", i, i))
+	}
+	m := Model{hosts: hosts, mode: viewConfirmDelete, treeView: true, height: 10}
+	m.filterHosts()
+
+	view := m.View()
+	if n := strings.Count(view, "\n") + 1; n > 10 {
+		t.Errorf("confirmation has %d lines, want at most 10:\n%s", n, view)
+	}
+	if !contains(view, "Delete these 20 hosts?") || !contains(view, "… and 17 more") {
+		t.Errorf("confirmation should count the hidden entries:\n%s", view)
+	}
+}
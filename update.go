@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// updateOpts are the options of update
+type updateOpts struct {
+	host string
+	yes  bool
+	conn scanOpts
+}
+
+// keyReplacement is a stored line whose key the host replaced, or a
+// duplicate line of the same key type that is removed
+type keyReplacement struct {
+	Index  int // index in the known_hosts lines
+	Old    Entry
+	New    Entry
+	Delete bool
+}
+
+// planUpdate finds the unmarked lines of pattern whose key type the host
+// offered with another key. When several lines hold that key type, the
+// first one with the offered key is kept, or else the first one gets it,
+// and the others with a different key are deleted. Offered types that
+// aren't stored are returned as added, update never adds them.
+func planUpdate(lines []string, pattern string, offered []Entry) (replacements []keyReplacement, added []Entry) {
+	for _, o := range offered {
+		var (
+			indexes []int
+			stored  []Entry
+		)
+		for i, line := range lines {
+			e, err := ParseEntry(line)
+			if err != nil || e.Marker != "" || e.KeyType != o.KeyType || !e.HasHost(pattern) {
+				continue
+			}
+			indexes = append(indexes, i)
+			stored = append(stored, e)
+		}
+
+		if len(stored) == 0 {
+			added = append(added, o)
+			continue
+		}
+
+		keep := slices.IndexFunc(stored, func(e Entry) bool { return e.Key == o.Key })
+		for i, e := range stored {
+			switch {
+			case e.Key == o.Key:
+				continue
+			case keep < 0:
+				keep = i
+				n := e
+				n.Key = o.Key
+				replacements = append(replacements, keyReplacement{Index: indexes[i], Old: e, New: n})
+			default:
+				replacements = append(replacements, keyReplacement{Index: indexes[i], Old: e, Delete: true})
+			}
+		}
+	}
+
+	return replacements, added
+}
+
+// applyUpdate returns lines with the replacements written in place and the
+// deleted lines left out, keeping the patterns, comments and position of
+// every other line
+func applyUpdate(lines []string, replacements []keyReplacement) []string {
+	out := append([]string(nil), lines...)
+	deleted := make(map[int]bool)
+	for _, r := range replacements {
+		if r.Delete {
+			deleted[r.Index] = true
+			continue
+		}
+		out[r.Index] = r.New.String()
+	}
+
+	kept := out[:0]
+	for i, line := range out {
+		if !deleted[i] {
+			kept = append(kept, line)
+		}
+	}
+
+	return kept
+}
+
+// newFingerprint is the fingerprint r writes, or "removed" for a deleted
+// duplicate
+func (r keyReplacement) newFingerprint() string {
+	if r.Delete {
+		return "removed"
+	}
+
+	return r.New.Fingerprint()
+}
+
+// printReplacements shows the old and new fingerprints side by side
+func printReplacements(w io.Writer, pattern string, replacements []keyReplacement) {
+	fmt.Fprintf(w, "Host keys of %s changed:\n", pattern)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  Entry\tKey type\tOld\tNew")
+	for _, r := range replacements {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", displayHostIdentifier(r.Old.String()), r.Old.KeyType, r.Old.Fingerprint(), r.newFingerprint())
+	}
+	tw.Flush()
+}
+
+// confirm asks a yes/no question, anything but y or yes is a no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
+
+// runUpdate fetches the keys of a host and replaces the stored keys that
+// changed after confirmation
+func runUpdate(hosts []string, opt updateOpts) {
+	target, err := parseScanTarget(opt.host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	pattern := hostPattern(target.Host, target.Port)
+
+	if !slices.ContainsFunc(hosts, func(line string) bool {
+		e, err := ParseEntry(line)
+		return err == nil && e.Marker == "" && e.HasHost(pattern)
+	}) {
+		fmt.Fprintf(os.Stderr, "Error: no entry for %s, use add instead\n", pattern)
+		os.Exit(1)
+	}
+
+	conn := opt.conn
+	conn.types = append(append([]string(nil), defaultScanTypes...), "dsa")
+
+	var offered []Entry
+	for _, r := range scanHosts([]scanTarget{target}, conn) {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", target.Addr(), r.Err)
+			os.Exit(1)
+		}
+		offered = append(offered, entryFromPublicKey(nil, r.Key))
+	}
+	if len(offered) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s offered no supported host key\n", target.Addr())
+		os.Exit(1)
+	}
+
+	replacements, added := planUpdate(hosts, pattern, offered)
+	for _, a := range added {
+		fmt.Printf("Not stored, skipped: %s %s %s\n", pattern, a.KeyType, a.Fingerprint())
+	}
+	if len(replacements) == 0 {
+		fmt.Println("No changed keys for", pattern)
+		return
+	}
+
+	printReplacements(os.Stdout, pattern, replacements)
+	question := fmt.Sprintf("Replace %d %s?", len(replacements), plural(len(replacements), "key", "keys"))
+	if !opt.yes && !confirm(os.Stdin, os.Stdout, question) {
+		fmt.Println("Update cancelled")
+		os.Exit(1)
+	}
+
+	updated := applyUpdate(hosts, replacements)
+	if err := SaveFile(updated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save known_hosts: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The tags and notes of an entry survive its key rotation
+	renamed := make(map[string]string)
+	var seen []Entry
+	for _, r := range replacements {
+		if r.Delete {
+			continue
+		}
+		renamed[r.Old.String()] = r.New.String()
+		seen = append(seen, r.New)
+	}
+	err = syncMeta(hosts, updated, "", renamed)
+	if err == nil {
+		err = touchMeta(seen, time.Now())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, r := range replacements {
+		detail := fmt.Sprintf("%s %s %s -> %s", displayHostIdentifier(r.Old.String()), r.Old.KeyType, r.Old.Fingerprint(), r.newFingerprint())
+		if err := logChange(cmdUpdate, detail); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Replaced %d %s\n", len(replacements), plural(len(replacements), "key", "keys"))
+}
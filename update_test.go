@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanUpdate(t *testing.T) {
+	_, oldKey := testPublicKey(t)
+	_, newKey := testPublicKey(t)
+	_, otherKey := testPublicKey(t)
+
+	lines := []string{
+		"# servers",
+		"db.example.com,10.0.0.5 ssh-ed25519 " + oldKey + " rebuilt in june",
+		"db.example.com ssh-rsa AAAA",
+		"web.example.com ssh-ed25519 " + oldKey,
+		"@revoked db.example.com ssh-ed25519 " + otherKey,
+		"|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs= ssh-ed25519 " + oldKey,
+	}
+	offered := []Entry{
+		{KeyType: "ssh-ed25519", Key: newKey},
+		{KeyType: "ecdsa-sha2-nistp256", Key: otherKey},
+	}
+
+	t.Run("replaces only the matching key type", func(t *testing.T) {
+		replacements, added := planUpdate(lines, "db.example.com", offered)
+		if len(replacements) != 1 || replacements[0].Index != 1 {
+			t.Fatalf("planUpdate() = %+v, want line 1 only", replacements)
+		}
+		if len(added) != 1 || added[0].KeyType != "ecdsa-sha2-nistp256" {
+			t.Errorf("planUpdate() added = %v, want the new ecdsa key", added)
+		}
+
+		got := applyUpdate(lines, replacements)
+		want := append([]string(nil), lines...)
+		want[1] = "db.example.com,10.0.0.5 ssh-ed25519 " + newKey + " rebuilt in june"
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("applyUpdate() = %v\nwant %v", got, want)
+		}
+	})
+
+	t.Run("hashed host", func(t *testing.T) {
+		replacements, _ := planUpdate(lines, "localhost", offered)
+		if len(replacements) != 1 || replacements[0].Index != 5 {
+			t.Fatalf("planUpdate() = %+v, want the hashed line", replacements)
+		}
+		if !replacements[0].New.Hashed() {
+			t.Error("planUpdate() should keep the hashed pattern")
+		}
+	})
+
+	t.Run("unchanged key", func(t *testing.T) {
+		replacements, _ := planUpdate(lines, "web.example.com", []Entry{{KeyType: "ssh-ed25519", Key: oldKey}})
+		if len(replacements) != 0 {
+			t.Errorf("planUpdate() = %+v, want nothing", replacements)
+		}
+	})
+
+	t.Run("duplicate lines of one key type", func(t *testing.T) {
+		dup := []string{
+			"db.example.com,10.0.0.5 ssh-ed25519 " + oldKey,
+			"web.example.com ssh-ed25519 " + oldKey,
+			"db.example.com ssh-ed25519 " + otherKey,
+		}
+
+		replacements, _ := planUpdate(dup, "db.example.com", offered[:1])
+		got := applyUpdate(dup, replacements)
+		want := []string{
+			"db.example.com,10.0.0.5 ssh-ed25519 " + newKey,
+			"web.example.com ssh-ed25519 " + oldKey,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("applyUpdate() = %v\nwant %v", got, want)
+		}
+
+		dup[2] = "db.example.com ssh-ed25519 " + newKey
+		replacements, _ = planUpdate(dup, "db.example.com", offered[:1])
+		if len(replacements) != 1 || replacements[0].Index != 0 || !replacements[0].Delete {
+			t.Errorf("planUpdate() = %+v, want line 0 deleted", replacements)
+		}
+	})
+}
+
+func TestPrintReplacements(t *testing.T) {
+	_, oldKey := testPublicKey(t)
+	_, newKey := testPublicKey(t)
+	old := Entry{Patterns: []string{"db.example.com"}, KeyType: "ssh-ed25519", Key: oldKey}
+	n := old
+	n.Key = newKey
+
+	var buf bytes.Buffer
+	printReplacements(&buf, "db.example.com", []keyReplacement{{Old: old, New: n}})
+
+	out := buf.String()
+	for _, want := range []string{"db.example.com", old.Fingerprint(), n.Fingerprint()} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printReplacements() missing %q:\n%s", want, out)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], old.Fingerprint()+"  "+n.Fingerprint()) {
+		t.Errorf("printReplacements() should show fingerprints side by side:\n%s", out)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" y \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+		{"yep\n", false},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if got := confirm(strings.NewReader(tt.in), &out, "Replace?"); got != tt.want {
+			t.Errorf("confirm(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if out.String() != "Replace? [y/N]: " {
+			t.Errorf("confirm() prompt = %q", out.String())
+		}
+	}
+}
+
+func TestLogChange(t *testing.T) {
+	dir := t.TempDir()
+	c := defaultConfig()
+	c.Files = []string{filepath.Join(dir, "known_hosts")}
+	setConfig(t, c)
+
+	if err := logChange(cmdUpdate, "a ssh-ed25519 SHA256:x -> SHA256:y"); err != nil {
+		t.Fatalf("logChange() error = %v", err)
+	}
+	if err := logChange(cmdUpdate, "b ssh-rsa SHA256:x -> SHA256:y"); err != nil {
+		t.Fatalf("logChange() error = %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "known_hosts.log"))
+	if err != nil {
+		t.Fatalf("Failed to read change log: %v", err)
+	}
+	lines := stringToLine(string(b))
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " update a ssh-ed25519 SHA256:x -> SHA256:y") {
+		t.Errorf("change log = %q", lines)
+	}
+
+	c.ChangeLog = filepath.Join(dir, "custom.log")
+	setConfig(t, c)
+	if err := logChange(cmdUpdate, "c"); err != nil {
+		t.Fatalf("logChange() error = %v", err)
+	}
+	if _, err := os.Stat(c.ChangeLog); err != nil {
+		t.Errorf("logChange() should use the configured file: %v", err)
+	}
+}
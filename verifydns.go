@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Results of comparing a stored key with the SSHFP records of its host
+const (
+	dnsMatch    = "match"
+	dnsMismatch = "mismatch"
+	dnsMissing  = "missing"
+	dnsError    = "error"
+)
+
+// dnsCheck is the result for one host and key type
+type dnsCheck struct {
+	Host          string
+	KeyType       string
+	Status        string
+	Err           error
+	Authenticated bool
+}
+
+// sshfpLookup returns the SSHFP records of host, see dnsClient.lookupSSHFP
+type sshfpLookup func(host string) ([]sshfpRecord, bool, error)
+
+// sshfpCandidates groups the entries that can have SSHFP records by host,
+// keeping the order of lines
+func sshfpCandidates(lines []string, hosts []string) (order []string, keys map[string][]Entry) {
+	keys = make(map[string][]Entry)
+
+	for _, line := range lines {
+		e, err := ParseEntry(line)
+		if err != nil || e.Marker != "" {
+			continue
+		}
+		if _, ok := sshfpAlgorithms[e.KeyType]; !ok {
+			continue
+		}
+
+		for _, p := range e.Patterns {
+			host, reason := sshfpHost(p)
+			if reason != "" || (len(hosts) > 0 && !slices.Contains(hosts, host)) {
+				continue
+			}
+
+			if _, ok := keys[host]; !ok {
+				order = append(order, host)
+			}
+			if !slices.ContainsFunc(keys[host], func(x Entry) bool { return x.KeyType == e.KeyType && x.Key == e.Key }) {
+				keys[host] = append(keys[host], e)
+			}
+		}
+	}
+
+	return order, keys
+}
+
+// VerifyDNS compares the stored keys of hosts, or of every eligible entry,
+// with the SSHFP records returned by lookup
+func VerifyDNS(lines []string, hosts []string, lookup sshfpLookup) []dnsCheck {
+	order, keys := sshfpCandidates(lines, hosts)
+
+	var checks []dnsCheck
+	for _, host := range order {
+		records, authenticated, err := lookup(host)
+
+		for _, e := range keys[host] {
+			c := dnsCheck{Host: host, KeyType: e.KeyType, Authenticated: authenticated}
+			if err != nil {
+				c.Status, c.Err = dnsError, err
+				checks = append(checks, c)
+				continue
+			}
+
+			c.Status = compareSSHFP(e, records, keys[host])
+			checks = append(checks, c)
+		}
+	}
+
+	return checks
+}
+
+// compareSSHFP reports whether records vouch for the key of e. The ECDSA
+// curves share one SSHFP algorithm, so records of the stored keys of
+// another type are left out rather than counted as a mismatch.
+func compareSSHFP(e Entry, records []sshfpRecord, stored []Entry) string {
+	alg := sshfpAlgorithms[e.KeyType]
+
+	status := dnsMissing
+	for _, r := range records {
+		if r.Algorithm != alg || sshfpClaimed(r, e.KeyType, stored) {
+			continue
+		}
+
+		fp, err := sshfpFingerprint(e.Key, r.Type)
+		if err != nil {
+			// Unknown fingerprint types can't be compared
+			continue
+		}
+		if fp == r.Fingerprint {
+			return dnsMatch
+		}
+		status = dnsMismatch
+	}
+
+	return status
+}
+
+// sshfpClaimed reports whether r is the record of a stored key whose type
+// isn't keyType
+func sshfpClaimed(r sshfpRecord, keyType string, stored []Entry) bool {
+	for _, e := range stored {
+		if e.KeyType == keyType {
+			continue
+		}
+		if fp, err := sshfpFingerprint(e.Key, r.Type); err == nil && fp == r.Fingerprint {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String formats c for the verify-dns output
+func (c dnsCheck) String() string {
+	s := fmt.Sprintf("%-8s %s %s", c.Status, c.Host, c.KeyType)
+	if c.Err != nil {
+		s += ": " + c.Err.Error()
+	} else if c.Authenticated {
+		s += " (DNSSEC)"
+	}
+
+	return s
+}
+
+// runVerifyDNS prints the result of VerifyDNS and exits with 1 unless every
+// key matched
+func runVerifyDNS(lines []sourceLine, opt verifyDNSOpts) {
+	texts := make([]string, len(lines))
+	for i, sl := range lines {
+		texts[i] = sl.Text
+	}
+
+	server := opt.resolver
+	if server == "" {
+		server = cfg.Resolver
+	}
+	client, err := newDNSClient(server, opt.timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	checks := VerifyDNS(texts, opt.hosts, client.lookupSSHFP)
+
+	ok := true
+	for _, c := range checks {
+		fmt.Println(c)
+		if c.Status != dnsMatch {
+			ok = false
+		}
+	}
+
+	for _, h := range opt.hosts {
+		if !slices.ContainsFunc(checks, func(c dnsCheck) bool { return c.Host == h }) {
+			fmt.Fprintf(os.Stderr, "No entry with an SSHFP key type for %s\n", h)
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// verifyDNSOpts are the options of verify-dns
+type verifyDNSOpts struct {
+	hosts    []string
+	resolver string
+	timeout  time.Duration
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerifyDNS(t *testing.T) {
+	_, otherKey := testPublicKey(t)
+	lines := []string{
+		"server.example.com,10.0.0.1 " + testSignerKey,
+		"db.example.com " + testSignerKey,
+		"web.example.com " + testSignerKey,
+		"down.example.com " + testSignerKey,
+		"server.example.com ssh-ed25519 " + otherKey,
+		"|1|TjpJZejubajyR5p/KPuunV5QFOc=|z2ZLBCg2KzL0ZCr0TuiaKp9SYOs= " + testSignerKey,
+		"@cert-authority *.example.com " + testSignerKey,
+	}
+
+	zone := testSSHFPZone()
+	lookup := func(host string) ([]sshfpRecord, bool, error) {
+		if host == "down.example.com" {
+			return nil, false, errors.New("timeout")
+		}
+		return zone[host+"."], host == "server.example.com", nil
+	}
+
+	type result struct{ host, status string }
+	want := []result{
+		{"server.example.com", dnsMatch},
+		{"server.example.com", dnsMismatch},
+		{"db.example.com", dnsMismatch},
+		{"web.example.com", dnsMissing},
+		{"down.example.com", dnsError},
+	}
+
+	checks := VerifyDNS(lines, nil, lookup)
+	if len(checks) != len(want) {
+		t.Fatalf("VerifyDNS() = %v, want %v", checks, want)
+	}
+	for i, c := range checks {
+		if (result{c.Host, c.Status}) != want[i] {
+			t.Errorf("VerifyDNS()[%d] = %s %s, want %v", i, c.Host, c.Status, want[i])
+		}
+	}
+	if !checks[0].Authenticated {
+		t.Error("VerifyDNS() should pass on the DNSSEC status")
+	}
+
+	selected := VerifyDNS(lines, []string{"db.example.com"}, lookup)
+	if len(selected) != 1 || selected[0].Host != "db.example.com" {
+		t.Errorf("VerifyDNS() selected = %v", selected)
+	}
+}
+
+func TestVerifyDNSECDSACurves(t *testing.T) {
+	const host = "server.example.com"
+
+	var lines []string
+	var entries []Entry
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		pub, err := ssh.NewPublicKey(&priv.PublicKey)
+		if err != nil {
+			t.Fatalf("Failed to convert key: %v", err)
+		}
+		e := entryFromPublicKey([]string{host}, pub)
+		entries = append(entries, e)
+		lines = append(lines, e.String())
+	}
+
+	recordsOf := func(entries ...Entry) []sshfpRecord {
+		var records []sshfpRecord
+		for _, e := range entries {
+			r, err := entrySSHFP(e, host)
+			if err != nil {
+				t.Fatalf("entrySSHFP() error = %v", err)
+			}
+			records = append(records, r...)
+		}
+		return records
+	}
+
+	tests := []struct {
+		name    string
+		records []sshfpRecord
+		want    []string
+	}{
+		{"both curves published", recordsOf(entries...), []string{dnsMatch, dnsMatch}},
+		{"only nistp256 published", recordsOf(entries[0]), []string{dnsMatch, dnsMissing}},
+		{"only nistp384 published", recordsOf(entries[1]), []string{dnsMissing, dnsMatch}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(string) ([]sshfpRecord, bool, error) { return tt.records, false, nil }
+
+			checks := VerifyDNS(lines, nil, lookup)
+			if len(checks) != len(tt.want) {
+				t.Fatalf("VerifyDNS() = %v, want %v", checks, tt.want)
+			}
+			for i, c := range checks {
+				if c.Status != tt.want[i] {
+					t.Errorf("VerifyDNS() %s = %s, want %s", c.KeyType, c.Status, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyDNSStubServer(t *testing.T) {
+	stub := &stubDNS{zone: testSSHFPZone()}
+	c, err := newDNSClient(stub.start(t), time.Second)
+	if err != nil {
+		t.Fatalf("newDNSClient() error = %v", err)
+	}
+
+	checks := VerifyDNS([]string{"server.example.com " + testSignerKey, "new.example.com " + testSignerKey}, nil, c.lookupSSHFP)
+	if len(checks) != 2 || checks[0].Status != dnsMatch || checks[1].Status != dnsMissing {
+		t.Errorf("VerifyDNS() = %v", checks)
+	}
+}
+
+func TestDNSCheckString(t *testing.T) {
+	tests := []struct {
+		c    dnsCheck
+		want string
+	}{
+		{dnsCheck{Host: "a", KeyType: "ssh-rsa", Status: dnsMatch}, "match    a ssh-rsa"},
+		{dnsCheck{Host: "a", KeyType: "ssh-rsa", Status: dnsMatch, Authenticated: true}, "match    a ssh-rsa (DNSSEC)"},
+		{dnsCheck{Host: "a", KeyType: "ssh-rsa", Status: dnsError, Err: errors.New("timeout")}, "error    a ssh-rsa: timeout"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.c.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}